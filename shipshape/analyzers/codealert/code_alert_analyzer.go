@@ -17,12 +17,16 @@
 package codealert
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"path/filepath"
 	"regexp"
 	"strings"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/google/shipshape/shipshape/api"
 
 	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
 	ctxpb "github.com/google/shipshape/shipshape/proto/shipshape_context_proto"
@@ -46,26 +50,60 @@ type CodeAlert struct {
 	Regexp      *regexp.Regexp
 }
 
+// CodeAlertAnalyzer reports the lines that match a code alert.
+// It understands the setting "patterns", a regular expression that replaces the default
+// alerts. To look for several patterns, join them with "|".
 type CodeAlertAnalyzer struct {
 }
 
 func (CodeAlertAnalyzer) Category() string { return "CodeAlert" }
 
-// TODO(emso): Use file filter in code alert
 func (a CodeAlertAnalyzer) Analyze(ctx *ctxpb.ShipshapeContext) ([]*notepb.Note, error) {
-	var notes []*notepb.Note
-	for _, path := range ctx.FilePath {
-		content, err := ioutil.ReadFile(path)
+	return a.AnalyzeContext(context.Background(), ctx)
+}
+
+// AnalyzeContext looks for the code alerts like Analyze, using the patterns from the
+// settings for the category if there are any.
+// TODO(emso): Use file filter in code alert
+func (a CodeAlertAnalyzer) AnalyzeContext(reqCtx context.Context, ctx *ctxpb.ShipshapeContext) ([]*notepb.Note, error) {
+	alerts, err := configuredAlerts(api.OptionsFromContext(reqCtx))
+	if err != nil {
+		return nil, err
+	}
+	return api.AnalyzeFiles(reqCtx, ctx, nil, 0, func(reqCtx context.Context, ctx *ctxpb.ShipshapeContext, path string) ([]*notepb.Note, error) {
+		content, err := ioutil.ReadFile(filepath.Join(ctx.GetRepoRoot(), path))
 		if err != nil {
 			return nil, err
 		}
-		notes = append(notes, a.FindMatches(string(content))...)
+		return a.findMatches(string(content), alerts), nil
+	})
+}
+
+// configuredAlerts returns the alert for the "patterns" setting, or the default alerts if
+// it is not set.
+func configuredAlerts(opts api.Options) ([]*CodeAlert, error) {
+	patterns := opts.Get("patterns", "")
+	if patterns == "" {
+		return alerts, nil
+	}
+	re, err := regexp.Compile(patterns)
+	if err != nil {
+		return nil, fmt.Errorf("invalid patterns setting: %v", err)
 	}
-	return notes, nil
+	return []*CodeAlert{{
+		Name:        "Pattern",
+		File:        "*",
+		Description: fmt.Sprintf("Matches the pattern %q", patterns),
+		Regexp:      re,
+	}}, nil
 }
 
-// FindMatches returns an array of notes for each match in content.
+// FindMatches returns an array of notes for each match of the default alerts in content.
 func (a CodeAlertAnalyzer) FindMatches(content string) []*notepb.Note {
+	return a.findMatches(content, alerts)
+}
+
+func (a CodeAlertAnalyzer) findMatches(content string, alerts []*CodeAlert) []*notepb.Note {
 	var notes []*notepb.Note
 	// Line number will start from zero and should be padded with a one if returned
 	for lineNumber, line := range strings.Split(content, "\n") {
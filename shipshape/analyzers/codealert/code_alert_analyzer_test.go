@@ -18,6 +18,8 @@ package codealert
 
 import (
 	"testing"
+
+	"github.com/google/shipshape/shipshape/api"
 )
 
 func TestSamplePattern(t *testing.T) {
@@ -35,3 +37,37 @@ func TestSamplePattern(t *testing.T) {
 		}
 	}
 }
+
+func TestConfiguredPatterns(t *testing.T) {
+	tests := []struct {
+		label        string
+		opts         api.Options
+		expectCount  int
+		expectSubcat string
+	}{
+		{"No settings", nil, 1, "DoNotSubmitTxtTest"},
+		{"Patterns", api.Options{"patterns": "TODO|FIXME"}, 2, "Pattern"},
+	}
+
+	var a CodeAlertAnalyzer
+	for _, test := range tests {
+		alerts, err := configuredAlerts(test.opts)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.label, err)
+			continue
+		}
+		notes := a.findMatches("TODO: one\ndo not submit\nFIXME\n", alerts)
+		if len(notes) != test.expectCount {
+			t.Errorf("%s: got %d matches, want %d", test.label, len(notes), test.expectCount)
+		}
+		for _, note := range notes {
+			if note.GetSubcategory() != test.expectSubcat {
+				t.Errorf("%s: got subcategory %q, want %q", test.label, note.GetSubcategory(), test.expectSubcat)
+			}
+		}
+	}
+
+	if _, err := configuredAlerts(api.Options{"patterns": "("}); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+}
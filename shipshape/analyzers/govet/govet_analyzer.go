@@ -19,14 +19,15 @@
 package govet
 
 import (
+	"context"
 	"fmt"
 	"os/exec"
-	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/google/shipshape/shipshape/api"
 
 	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
 	ctxpb "github.com/google/shipshape/shipshape/proto/shipshape_context_proto"
@@ -45,18 +46,22 @@ var (
 
 // GoVetAnalyzer is a wrapper around the go vet command line tool.
 // This assumes it runs in a location where go is on the path.
+// It understands the setting "flags", a space-separated list of flags
+// to pass to go vet, such as "-shadow -printf=false".
 type GoVetAnalyzer struct{}
 
 func (GoVetAnalyzer) Category() string { return "go vet" }
 
-func isGoFile(path string) bool {
-	return filepath.Ext(path) == ".go"
-}
-
-func (gva *GoVetAnalyzer) analyzeOneFile(ctx *ctxpb.ShipshapeContext, path string) ([]*notepb.Note, error) {
+func (gva *GoVetAnalyzer) analyzeOneFile(reqCtx context.Context, ctx *ctxpb.ShipshapeContext, path string) ([]*notepb.Note, error) {
 	var notes []*notepb.Note
-	cmd := exec.Command(goCmd, "vet", path)
+	args := append([]string{"vet"}, strings.Fields(api.OptionsFromContext(reqCtx).Get("flags", ""))...)
+	cmd := exec.CommandContext(reqCtx, goCmd, append(args, path)...)
+	cmd.Dir = ctx.GetRepoRoot()
 	buf, err := cmd.CombinedOutput()
+	if reqCtx.Err() != nil {
+		// go vet was killed, so its output is not meaningful.
+		return notes, reqCtx.Err()
+	}
 
 	switch err := err.(type) {
 	case nil:
@@ -71,9 +76,6 @@ func (gva *GoVetAnalyzer) analyzeOneFile(ctx *ctxpb.ShipshapeContext, path strin
 		// the exit code and the last line being empty.
 		var issues = strings.Split(string(buf), "\n")
 		if len(issues) < 3 {
-			// TODO(ciera): We should be able to keep going here
-			// and try the next file. However, our API doesn't allow for
-			// returning multiple errors. We need to reconsider the API.
 			return notes, fmt.Errorf("did not get correct output from `go vet`, output was: %v", string(buf))
 		}
 		for _, issue := range issues[:len(issues)-2] {
@@ -111,22 +113,14 @@ func (gva *GoVetAnalyzer) analyzeOneFile(ctx *ctxpb.ShipshapeContext, path strin
 }
 
 func (gva *GoVetAnalyzer) Analyze(ctx *ctxpb.ShipshapeContext) ([]*notepb.Note, error) {
-	var notes []*notepb.Note
+	return gva.AnalyzeContext(context.Background(), ctx)
+}
 
+// AnalyzeContext runs go vet like Analyze, killing it if reqCtx is done first.
+func (gva *GoVetAnalyzer) AnalyzeContext(reqCtx context.Context, ctx *ctxpb.ShipshapeContext) ([]*notepb.Note, error) {
 	// Call go vet on each go file individually. go vet requires that all files
 	// given be in the same directory, and this is an easy way of achieving that.
-	for _, path := range ctx.FilePath {
-		if !isGoFile(path) {
-			continue
-		}
-
-		ourNotes, err := gva.analyzeOneFile(ctx, path)
-		// TODO(collinwinter): figure out whether analyzers should return an
-		// error XOR notes and impose that everywhere.
-		notes = append(notes, ourNotes...)
-		if err != nil {
-			return notes, err
-		}
-	}
-	return notes, nil
+	// TODO(collinwinter): figure out whether analyzers should return an
+	// error XOR notes and impose that everywhere.
+	return api.AnalyzeFiles(reqCtx, ctx, api.ExtensionFilter(".go"), 0, gva.analyzeOneFile)
 }
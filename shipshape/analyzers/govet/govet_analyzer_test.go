@@ -17,6 +17,7 @@
 package govet
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -38,7 +39,7 @@ func TestNoErrorsInGoFile(t *testing.T) {
 	ctx := &ctxpb.ShipshapeContext{}
 	gva := new(GoVetAnalyzer)
 
-	notes, err := gva.analyzeOneFile(ctx, noErrors)
+	notes, err := gva.analyzeOneFile(context.Background(), ctx, noErrors)
 	if err != nil {
 		t.Errorf("Analysis of %q failed: %v", noErrors, err)
 	}
@@ -61,7 +62,7 @@ func TestErrorsInGoFile(t *testing.T) {
 		{hasErrors, 25, "no formatting directive in Fprintf call"},
 	}
 
-	notes, err := gva.analyzeOneFile(ctx, hasErrors)
+	notes, err := gva.analyzeOneFile(context.Background(), ctx, hasErrors)
 	if err != nil {
 		t.Errorf("Analysis of %q failed: %v", hasErrors, err)
 	}
@@ -17,6 +17,7 @@
 package jshint
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os/exec"
@@ -26,6 +27,7 @@ import (
 	"strings"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/google/shipshape/shipshape/api"
 
 	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
 	ctxpb "github.com/google/shipshape/shipshape/proto/shipshape_context_proto"
@@ -43,7 +45,9 @@ var (
 // JSHintAnalyzer is a wrapper around a the jshint command line tool.
 // This assumes it runs in a location where jshint is on the path.
 // It can run on JS and HTML files. Right now, it just puts the file
-// contents into stdin and uses no configuration
+// contents into stdin. It understands the setting "config", the path of
+// a jshint config file relative to the repository root; without it,
+// jshint looks for a .jshintrc file as usual.
 type JSHintAnalyzer struct{}
 
 func (JSHintAnalyzer) Category() string { return "JSHint" }
@@ -60,72 +64,82 @@ func isJSHintFile(path string) bool {
 }
 
 func (jsa *JSHintAnalyzer) Analyze(ctx *ctxpb.ShipshapeContext) ([]*notepb.Note, error) {
-	var notes []*notepb.Note
+	return jsa.AnalyzeContext(context.Background(), ctx)
+}
 
+// AnalyzeContext runs jshint like Analyze, killing it if reqCtx is done first.
+func (jsa *JSHintAnalyzer) AnalyzeContext(reqCtx context.Context, ctx *ctxpb.ShipshapeContext) ([]*notepb.Note, error) {
 	// Call jshint on each path
-	for _, path := range ctx.FilePath {
-		if !isJSHintFile(path) {
-			continue
-		}
+	return api.AnalyzeFiles(reqCtx, ctx, isJSHintFile, 0, jsa.analyzeOneFile)
+}
+
+// analyzeOneFile runs jshint on a single file.
+func (jsa *JSHintAnalyzer) analyzeOneFile(reqCtx context.Context, ctx *ctxpb.ShipshapeContext, path string) ([]*notepb.Note, error) {
+	var notes []*notepb.Note
+
+	var args []string
+	if config := api.OptionsFromContext(reqCtx).Get("config", ""); config != "" {
+		args = append(args, "--config", config)
+	}
+	cmd := exec.CommandContext(reqCtx, "jshint", append(args, path)...)
+	cmd.Dir = ctx.GetRepoRoot()
+	buf, err := cmd.CombinedOutput()
+	if reqCtx.Err() != nil {
+		// jshint was killed, so its output is not meaningful.
+		return notes, reqCtx.Err()
+	}
 
-		cmd := exec.Command("jshint", path)
-		buf, err := cmd.CombinedOutput()
-
-		switch err := err.(type) {
-		case nil:
-			// no issues. Do nothing.
-		case *exec.ExitError:
-			// jshint gives an exit status when there are issues reporter
-			if err.Error() == exitStatus {
-				// jshint gives one issue per line
-				var issues = strings.Split(string(buf), "\n")
-				if len(issues) <= 3 {
-					// TODO(ciera): We should be able to keep going here
-					// and try the next file. However, our API doesn't allow for
-					// returning multiple errors. We need to reconsider the API
-					return notes, errors.New("did not get correct output from jshint")
+	switch err := err.(type) {
+	case nil:
+		// no issues. Do nothing.
+	case *exec.ExitError:
+		// jshint gives an exit status when there are issues reporter
+		if err.Error() == exitStatus {
+			// jshint gives one issue per line
+			var issues = strings.Split(string(buf), "\n")
+			if len(issues) <= 3 {
+				return notes, errors.New("did not get correct output from jshint")
+			}
+			// ignore the last three lines, they are summary info
+			for _, issue := range issues[:len(issues)-3] {
+				parts := issueRE.FindStringSubmatch(issue)
+				if len(parts) != 5 {
+					return notes, fmt.Errorf("jshint gave incorrectly formatted issue: %q", issue)
 				}
-				// ignore the last three lines, they are summary info
-				for _, issue := range issues[:len(issues)-3] {
-					parts := issueRE.FindStringSubmatch(issue)
-					if len(parts) != 5 {
-						return notes, fmt.Errorf("jshint gave incorrectly formatted issue: %q", issue)
-					}
-
-					// convert into a base-10 32-bit int
-					line, err := strconv.ParseInt(parts[2], 10, 32)
-					if err != nil {
-						return notes, err
-					}
-
-					// convert into a base-10 32-bit int
-					col, err := strconv.ParseInt(parts[3], 10, 32)
-					if err != nil {
-						return notes, err
-					}
-
-					notes = append(notes, &notepb.Note{
-						Category:    proto.String(jsa.Category()),
-						Description: proto.String(parts[4]),
-						MoreInfo:    proto.String("http://www.jshint.com"),
-						Location: &notepb.Location{
-							SourceContext: ctx.SourceContext,
-							Path:          proto.String(parts[1]),
-							Range: &rangepb.TextRange{
-								StartLine:   proto.Int32(int32(line)),
-								StartColumn: proto.Int32(int32(col)),
-							},
-						},
-					})
+
+				// convert into a base-10 32-bit int
+				line, err := strconv.ParseInt(parts[2], 10, 32)
+				if err != nil {
+					return notes, err
+				}
+
+				// convert into a base-10 32-bit int
+				col, err := strconv.ParseInt(parts[3], 10, 32)
+				if err != nil {
+					return notes, err
 				}
-			} else {
-				return notes, err
+
+				notes = append(notes, &notepb.Note{
+					Category:    proto.String(jsa.Category()),
+					Description: proto.String(parts[4]),
+					MoreInfo:    proto.String("http://www.jshint.com"),
+					Location: &notepb.Location{
+						SourceContext: ctx.SourceContext,
+						Path:          proto.String(parts[1]),
+						Range: &rangepb.TextRange{
+							StartLine:   proto.Int32(int32(line)),
+							StartColumn: proto.Int32(int32(col)),
+						},
+					},
+				})
 			}
-		case *exec.Error:
-			return notes, err
-		default:
+		} else {
 			return notes, err
 		}
+	case *exec.Error:
+		return notes, err
+	default:
+		return notes, err
 	}
 	return notes, nil
 }
@@ -17,14 +17,15 @@
 package pylint
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os/exec"
-	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/google/shipshape/shipshape/api"
 
 	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
 	ctxpb "github.com/google/shipshape/shipshape/proto/shipshape_context_proto"
@@ -43,88 +44,97 @@ var ()
 // to run on.
 // After running, it will convert findings to the original directory
 // structure
+// It understands the setting "rcfile", the path of a pylintrc file
+// relative to the repository root.
 type PyLintAnalyzer struct{}
 
 func (PyLintAnalyzer) Category() string { return "PyLint" }
 
 func (pya *PyLintAnalyzer) Analyze(ctx *ctxpb.ShipshapeContext) ([]*notepb.Note, error) {
-	var notes []*notepb.Note
+	return pya.AnalyzeContext(context.Background(), ctx)
+}
+
+// AnalyzeContext runs pylint like Analyze, killing it if reqCtx is done first.
+func (pya *PyLintAnalyzer) AnalyzeContext(reqCtx context.Context, ctx *ctxpb.ShipshapeContext) ([]*notepb.Note, error) {
 	// Call pylint on the files
-	pythonFiles := extractPyFiles(ctx.FilePath)
-	for _, pyFile := range pythonFiles {
-		cmd := exec.Command("pylint",
-			// TODO(ciera): get the python path
-			//"--init-hook='import sys; sys.path.append(" + pythonpath + ")'",
-			"--msg-template='{path}:::{line}:::{msg}'",
-			"--reports=no",
-			pyFile)
-		buf, err := cmd.CombinedOutput()
-
-		switch err := err.(type) {
-		case nil:
-			// no issues. Do nothing.
-		case *exec.ExitError:
-			// pylint uses error codes to signal if there was an
-			// issue discovered. However, a fatal message means that
-			// pylint couldn't even finish processing. There may be partial
-			// results though.
-			if err.Error() == usageError {
-				return notes, err
+	return api.AnalyzeFiles(reqCtx, ctx, api.ExtensionFilter(".py"), 0, pya.analyzeOneFile)
+}
+
+// analyzeOneFile runs pylint on a single Python file.
+func (pya *PyLintAnalyzer) analyzeOneFile(reqCtx context.Context, ctx *ctxpb.ShipshapeContext, pyFile string) ([]*notepb.Note, error) {
+	var notes []*notepb.Note
+
+	args := []string{
+		// TODO(ciera): get the python path
+		//"--init-hook='import sys; sys.path.append(" + pythonpath + ")'",
+		"--msg-template='{path}:::{line}:::{msg}'",
+		"--reports=no",
+	}
+	if rcfile := api.OptionsFromContext(reqCtx).Get("rcfile", ""); rcfile != "" {
+		args = append(args, "--rcfile="+rcfile)
+	}
+	cmd := exec.CommandContext(reqCtx, "pylint", append(args, pyFile)...)
+	cmd.Dir = ctx.GetRepoRoot()
+	buf, err := cmd.CombinedOutput()
+	if reqCtx.Err() != nil {
+		// pylint was killed, so its output is not meaningful.
+		return notes, reqCtx.Err()
+	}
+
+	switch err := err.(type) {
+	case nil:
+		// no issues. Do nothing.
+	case *exec.ExitError:
+		// pylint uses error codes to signal if there was an
+		// issue discovered. However, a fatal message means that
+		// pylint couldn't even finish processing. There may be partial
+		// results though.
+		if err.Error() == usageError {
+			return notes, err
+		}
+
+		var issues = strings.Split(string(buf), "\n")
+
+		if len(issues) < 2 {
+			return notes, errors.New("Output contains no issues")
+		}
+		// one issue per line
+		// skip first line; just where config is at
+		// skip the empty last line
+		for _, issue := range issues[1 : len(issues)-1] {
+			if strings.HasPrefix(issue, modulePrefix) {
+				continue
 			}
 
-			var issues = strings.Split(string(buf), "\n")
+			parts := strings.Split(issue, ":::")
 
-			if len(issues) < 2 {
-				return notes, errors.New("Output contains no issues")
+			if len(parts) != 3 {
+				return notes, fmt.Errorf("Found ill-formated issue: %s", issue)
 			}
-			// one issue per line
-			// skip first line; just where config is at
-			// skip the empty last line
-			for _, issue := range issues[1 : len(issues)-1] {
-				if strings.HasPrefix(issue, modulePrefix) {
-					continue
-				}
-
-				parts := strings.Split(issue, ":::")
-
-				if len(parts) != 3 {
-					return notes, fmt.Errorf("Found ill-formated issue: %s", issue)
-				}
-
-				// convert into a base-10 32-bit int
-				line, err := strconv.ParseInt(parts[1], 10, 32)
-				if err != nil {
-					return notes, err
-				}
-
-				notes = append(notes, &notepb.Note{
-					Category:    proto.String(pya.Category()),
-					Description: proto.String(strings.TrimSpace(parts[2])),
-					Location: &notepb.Location{
-						SourceContext: ctx.SourceContext,
-						Path:          proto.String(parts[0]),
-						Range: &rangepb.TextRange{
-							StartLine: proto.Int32(int32(line)),
-						},
-					},
-				})
 
+			// convert into a base-10 32-bit int
+			line, err := strconv.ParseInt(parts[1], 10, 32)
+			if err != nil {
+				return notes, err
 			}
-		case *exec.Error:
-			return notes, err
-		default:
-			return notes, err
-		}
-	}
-	return notes, nil
-}
 
-func extractPyFiles(paths []string) []string {
-	pyFiles := []string{}
-	for _, path := range paths {
-		if filepath.Ext(path) == ".py" {
-			pyFiles = append(pyFiles, path)
+			notes = append(notes, &notepb.Note{
+				Category:    proto.String(pya.Category()),
+				Description: proto.String(strings.TrimSpace(parts[2])),
+				Location: &notepb.Location{
+					SourceContext: ctx.SourceContext,
+					Path:          proto.String(parts[0]),
+					Range: &rangepb.TextRange{
+						StartLine: proto.Int32(int32(line)),
+					},
+				},
+			})
+
 		}
+	case *exec.Error:
+		return notes, err
+	default:
+		return notes, err
 	}
-	return pyFiles
+	return notes, nil
 }
@@ -17,11 +17,14 @@
 package wordcount
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
 	"strings"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/google/shipshape/shipshape/api"
 
 	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
 	ctxpb "github.com/google/shipshape/shipshape/proto/shipshape_context_proto"
@@ -33,16 +36,18 @@ type WordCountAnalyzer struct {
 func (WordCountAnalyzer) Category() string { return "WordCount" }
 
 func (p WordCountAnalyzer) Analyze(ctx *ctxpb.ShipshapeContext) ([]*notepb.Note, error) {
-	var notes []*notepb.Note
-	notes = make([]*notepb.Note, len(ctx.FilePath))
-	for i, path := range ctx.FilePath {
-		bytes, err := ioutil.ReadFile(path)
-		if err != nil {
-			return nil, fmt.Errorf("could not get file contents for %s: %v", path, err)
-		}
-		content := string(bytes)
-		count := p.CountWords(content)
-		notes[i] = &notepb.Note{
+	return api.AnalyzeFiles(context.Background(), ctx, nil, 0, p.analyzeOneFile)
+}
+
+func (p WordCountAnalyzer) analyzeOneFile(reqCtx context.Context, ctx *ctxpb.ShipshapeContext, path string) ([]*notepb.Note, error) {
+	bytes, err := ioutil.ReadFile(filepath.Join(ctx.GetRepoRoot(), path))
+	if err != nil {
+		return nil, fmt.Errorf("could not get file contents: %v", err)
+	}
+	content := string(bytes)
+	count := p.CountWords(content)
+	return []*notepb.Note{
+		&notepb.Note{
 			Location: &notepb.Location{
 				Path:          proto.String(path),
 				SourceContext: ctx.SourceContext,
@@ -50,9 +55,8 @@ func (p WordCountAnalyzer) Analyze(ctx *ctxpb.ShipshapeContext) ([]*notepb.Note,
 			Category:    proto.String(p.Category()),
 			Description: proto.String(fmt.Sprintf("Word count: %v", count)),
 			Severity:    notepb.Note_OTHER.Enum(),
-		}
-	}
-	return notes, nil
+		},
+	}, nil
 }
 
 // CountWords returns the number of words found in content
@@ -102,3 +102,25 @@ func TestAnalyzeFailure(t *testing.T) {
 		}
 	}
 }
+
+func TestAnalyzeContinuesPastFailure(t *testing.T) {
+	ctx, err := test.CreateContext(dataDir, []string{"nonexistentfile.txt", "simple.txt"})
+	if err != nil {
+		t.Fatalf("error from CreateContext: %v", err)
+	}
+
+	var w WordCountAnalyzer
+	notes, err := w.Analyze(ctx)
+	if err == nil {
+		t.Errorf("expected an analysis failure for nonexistentfile.txt")
+	}
+	expectedNotes := []*notespb.Note{
+		&notespb.Note{
+			Category:    proto.String("WordCount"),
+			Description: proto.String("Word count: 6"),
+		},
+	}
+	if pass, message := test.CheckNoteContainsContent(expectedNotes, notes); !pass {
+		t.Error(message)
+	}
+}
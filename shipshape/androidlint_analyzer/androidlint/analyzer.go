@@ -17,6 +17,7 @@
 package androidlint
 
 import (
+	"context"
 	"encoding/xml"
 	"fmt"
 	"io/ioutil"
@@ -24,8 +25,10 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/google/shipshape/shipshape/api"
 
 	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
 	ctxpb "github.com/google/shipshape/shipshape/proto/shipshape_context_proto"
@@ -53,83 +56,118 @@ func (Analyzer) Category() string { return "AndroidLint" }
 // referenced by the list of files on the depot path. In case of an error, it
 // returns partial results.
 func (ala Analyzer) Analyze(ctx *ctxpb.ShipshapeContext) ([]*notepb.Note, error) {
-	var notes []*notepb.Note
+	return ala.AnalyzeContext(context.Background(), ctx)
+}
 
-	// Get the list of Android Projects
-	projects := getAndroidProjects(ctx.FilePath)
+// AnalyzeContext runs android lint like Analyze, killing it if reqCtx is done
+// first.
+func (ala Analyzer) AnalyzeContext(reqCtx context.Context, ctx *ctxpb.ShipshapeContext) ([]*notepb.Note, error) {
+	var notes []*notepb.Note
+	var errs api.MultiError
 
-	for prj := range projects {
-		tempReport, err := ioutil.TempFile("", report)
+	// Get the list of Android Projects, in a stable order.
+	var projects []string
+	for prj := range getAndroidProjects(ctx.GetRepoRoot(), ctx.FilePath) {
+		projects = append(projects, prj)
+	}
+	sort.Strings(projects)
+
+	// A failure in one project should not stop the others from being analyzed.
+	for _, prj := range projects {
+		prjNotes, err := ala.analyzeProject(reqCtx, ctx, prj)
+		notes = append(notes, prjNotes...)
+		if reqCtx.Err() != nil {
+			return notes, reqCtx.Err()
+		}
 		if err != nil {
-			return notes, fmt.Errorf("Could not create temp report file %s: %v", report, err)
+			errs = append(errs, &api.FileError{Path: prj, Err: err})
+		}
+	}
+
+	return notes, errs.ErrorOrNil()
+}
+
+// analyzeProject runs android lint on a single Android project, given by its
+// path relative to the repo root.
+func (ala Analyzer) analyzeProject(reqCtx context.Context, ctx *ctxpb.ShipshapeContext, prj string) ([]*notepb.Note, error) {
+	var notes []*notepb.Note
+
+	tempReport, err := ioutil.TempFile("", report)
+	if err != nil {
+		return notes, fmt.Errorf("Could not create temp report file %s: %v", report, err)
+	}
+	defer os.Remove(tempReport.Name())
+
+	// TODO(ciera): Add project options (--classpath) when we have build information.
+	// TODO(clconway): The path to the binary should be configurable, especially since
+	// the "lint" command name is overloaded.
+	cmd := exec.CommandContext(reqCtx, lintBin,
+		"--showall",
+		"--quiet",
+		"--exitcode",
+		"--xml", tempReport.Name(),
+		prj)
+	cmd.Dir = ctx.GetRepoRoot()
+	out, err := cmd.CombinedOutput()
+
+	log.Printf("lint output is %q", out)
+	if reqCtx.Err() != nil {
+		// lint was killed, so its output and report are not meaningful.
+		return notes, reqCtx.Err()
+	}
+
+	switch err := err.(type) {
+	case nil:
+		// no issues. Do nothing.
+	case *exec.ExitError:
+		if err.Error() != exitStatus {
+			return notes, fmt.Errorf("Unexpected error code from android lint: %v", err)
 		}
-		defer os.Remove(tempReport.Name())
-
-		// TODO(ciera): Add project options (--classpath) when we have build information.
-		// TODO(clconway): The path to the binary should be configurable, especially since
-		// the "lint" command name is overloaded.
-		cmd := exec.Command(lintBin,
-			"--showall",
-			"--quiet",
-			"--exitcode",
-			"--xml", tempReport.Name(),
-			prj)
-		out, err := cmd.CombinedOutput()
-
-		log.Printf("lint output is %q", out)
-
-		switch err := err.(type) {
-		case nil:
-			// no issues. Do nothing.
-		case *exec.ExitError:
-			if err.Error() != exitStatus {
-				return notes, fmt.Errorf("Unexpected error code from android lint: %v", err)
-			}
-
-			// Get the results from xml
-			data, xmlErr := ioutil.ReadFile(tempReport.Name())
-			if xmlErr != nil {
-				return notes, fmt.Errorf("could not read %s : %v", tempReport.Name(), xmlErr)
-			}
-
-			var issues IssuesList
-			xmlErr = xml.Unmarshal(data, &issues)
-			if xmlErr != nil {
-				return notes, fmt.Errorf("could not unmarshal XML from %s: %v", tempReport.Name(), xmlErr)
-			}
-
-			// Create a bunch of notes to return, one per line from the output.
-			for _, issue := range issues.Issues {
-				notes = append(notes, &notepb.Note{
-					Category:    proto.String(ala.Category()),
-					Subcategory: proto.String(issue.Subcategory),
-					Description: proto.String(issue.Message),
-					Location: &notepb.Location{
-						SourceContext: ctx.SourceContext,
-						Path:          proto.String(filepath.Join(prj, issue.Location.File)),
-						Range: &rangepb.TextRange{
-							StartLine:   proto.Int(issue.Location.Line),
-							StartColumn: proto.Int(issue.Location.Column),
-						},
+
+		// Get the results from xml
+		data, xmlErr := ioutil.ReadFile(tempReport.Name())
+		if xmlErr != nil {
+			return notes, fmt.Errorf("could not read %s : %v", tempReport.Name(), xmlErr)
+		}
+
+		var issues IssuesList
+		xmlErr = xml.Unmarshal(data, &issues)
+		if xmlErr != nil {
+			return notes, fmt.Errorf("could not unmarshal XML from %s: %v", tempReport.Name(), xmlErr)
+		}
+
+		// Create a bunch of notes to return, one per line from the output.
+		for _, issue := range issues.Issues {
+			notes = append(notes, &notepb.Note{
+				Category:    proto.String(ala.Category()),
+				Subcategory: proto.String(issue.Subcategory),
+				Description: proto.String(issue.Message),
+				Location: &notepb.Location{
+					SourceContext: ctx.SourceContext,
+					Path:          proto.String(filepath.Join(prj, issue.Location.File)),
+					Range: &rangepb.TextRange{
+						StartLine:   proto.Int(issue.Location.Line),
+						StartColumn: proto.Int(issue.Location.Column),
 					},
-				})
-			}
-		case *exec.Error:
-			return notes, err
-		default:
-			return notes, err
+				},
+			})
 		}
+	case *exec.Error:
+		return notes, err
+	default:
+		return notes, err
 	}
-
 	return notes, nil
 }
 
 // Methods for determining where the android projects exist
 
-func getAndroidProjects(paths []string) map[string]bool {
+// getAndroidProjects returns the Android projects that contain the given paths.
+// The paths, and the returned projects, are relative to root.
+func getAndroidProjects(root string, paths []string) map[string]bool {
 	pPaths := make(map[string]bool)
 	for _, path := range paths {
-		project, ok := getProject(filepath.Clean(path))
+		project, ok := getProject(root, filepath.Clean(path))
 		if ok {
 			pPaths[project] = true
 		}
@@ -137,19 +175,19 @@ func getAndroidProjects(paths []string) map[string]bool {
 	return pPaths
 }
 
-func getProject(path string) (string, bool) {
-	fi, err := os.Stat(path)
+func getProject(root, path string) (string, bool) {
+	fi, err := os.Stat(filepath.Join(root, path))
 	if err != nil {
 		log.Printf("Could not find path %s: %v", path, err)
 		return "", false
 	}
 	if fi.IsDir() {
-		isAndroid := isAndroidRoot(path)
+		isAndroid := isAndroidRoot(filepath.Join(root, path))
 		if isAndroid || path == "." || path == string(filepath.Separator) {
 			return path, isAndroid
 		}
 	}
-	return getProject(filepath.Dir(path))
+	return getProject(root, filepath.Dir(path))
 }
 
 func isAndroidRoot(path string) bool {
@@ -18,6 +18,8 @@
 package api
 
 import (
+	"context"
+
 	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
 	ctxpb "github.com/google/shipshape/shipshape/proto/shipshape_context_proto"
 )
@@ -38,3 +40,17 @@ type Analyzer interface {
 	// that case.
 	Analyze(*ctxpb.ShipshapeContext) ([]*notepb.Note, error)
 }
+
+// A ContextAnalyzer is an Analyzer that can stop analyzing when the request it
+// is analyzing for is cancelled, or its deadline passes. The analyzer service
+// calls AnalyzeContext instead of Analyze for any analyzer that implements it.
+type ContextAnalyzer interface {
+	Analyzer
+
+	// AnalyzeContext runs this analyzer's analysis, just like Analyze.
+	// Once reqCtx is done, it should stop as soon as possible (killing any
+	// processes that it started) and return reqCtx.Err() along with any
+	// partial results. reqCtx also carries the settings that the Shipshape
+	// config gives for the analyzer's category; see OptionsFromContext.
+	AnalyzeContext(reqCtx context.Context, ctx *ctxpb.ShipshapeContext) ([]*notepb.Note, error)
+}
@@ -17,14 +17,23 @@
 package api
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/golang/protobuf/proto"
-	"github.com/google/shipshape/shipshape/util/file"
 	"github.com/google/shipshape/shipshape/util/rpc/server"
 	strset "github.com/google/shipshape/shipshape/util/strings"
 
 	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+	configpb "github.com/google/shipshape/shipshape/proto/shipshape_config_proto"
 	ctxpb "github.com/google/shipshape/shipshape/proto/shipshape_context_proto"
 	rpcpb "github.com/google/shipshape/shipshape/proto/shipshape_rpc_proto"
 )
@@ -34,19 +43,42 @@ import (
 // analyzers that they wish to run, and then starting this service using kythe/go/rpc/server.
 // Third parties will need to provide an appropriate Docker image that includes the relevant
 // dependencies, starts up the service, and exposes the port. It requires that all analyzers
-// be run at the same stage.
+// be run at the same stage. Analyzers are run concurrently, but no more than concurrency
+// of them at once.
 type analyzerService struct {
-	analyzers []Analyzer
-	stage     ctxpb.Stage
+	analyzers   []Analyzer
+	stage       ctxpb.Stage
+	concurrency int
 }
 
+// CreateAnalyzerService creates an analyzer service that runs as many analyzers at once as there
+// are CPUs.
 func CreateAnalyzerService(analyzers []Analyzer, stage ctxpb.Stage) *analyzerService {
-	return &analyzerService{analyzers, stage}
+	return &analyzerService{analyzers, stage, runtime.NumCPU()}
 }
 
-// Analyze will determine which analyzers to run and call them as appropriate. If necessary, it will
-// also modify the context before calling the analyzers. It recovers from all analyzer panics with a
-// note that the analyzer failed.
+// SetConcurrency sets the maximum number of analyzers that will run at once. Values less than 1
+// are treated as 1, which runs the analyzers one at a time.
+func (s *analyzerService) SetConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	s.concurrency = n
+}
+
+// byCategory sorts analyzers by their category.
+type byCategory []Analyzer
+
+func (b byCategory) Len() int           { return len(b) }
+func (b byCategory) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byCategory) Less(i, j int) bool { return b[i].Category() < b[j].Category() }
+
+// Analyze will determine which analyzers to run and call them as appropriate. Before calling the
+// analyzers, it makes the repo root in the context absolute; analyzers should resolve the files in
+// the context against it rather than the working directory, which is shared by all requests. It
+// recovers from all analyzer panics with a note that the analyzer failed. The analyzers run
+// concurrently, but the notes and failures are always returned ordered by the category of the
+// analyzer that produced them.
 func (s analyzerService) Analyze(ctx server.Context, in *rpcpb.AnalyzeRequest) (resp *rpcpb.AnalyzeResponse, err error) {
 	resp = new(rpcpb.AnalyzeResponse)
 
@@ -60,24 +92,28 @@ func (s analyzerService) Analyze(ctx server.Context, in *rpcpb.AnalyzeRequest) (
 		resp.Failure = errs
 	}()
 
-	orgDir, restore, err := file.ChangeDir(*in.ShipshapeContext.RepoRoot)
+	root, err := filepath.Abs(in.ShipshapeContext.GetRepoRoot())
 	if err != nil {
 		log.Printf("Internal error before analyzing: %v", err)
 		appendFailure(&errs, "InternalFailure", err)
 		return resp, err
 	}
-	defer func() {
-		if err := restore(); err != nil {
-			log.Printf("could not return back into %s from %s: %v", orgDir, *in.ShipshapeContext.RepoRoot, err)
-		}
-	}()
+	shipshapeCtx := proto.Clone(in.ShipshapeContext).(*ctxpb.ShipshapeContext)
+	shipshapeCtx.RepoRoot = proto.String(root)
 
-	reqCats := strset.New(in.Category...)
+	// Categories are matched ignoring case.
+	reqCats := strset.New()
+	for _, cat := range in.Category {
+		reqCats.Add(strings.ToLower(cat))
+	}
+	var toRun []Analyzer
 	for _, a := range s.analyzers {
-		if reqCats.Contains(a.Category()) {
-			runAnalyzer(a, in.ShipshapeContext, &nts, &errs)
+		if reqCats.Contains(strings.ToLower(a.Category())) {
+			toRun = append(toRun, a)
 		}
 	}
+	sort.Stable(byCategory(toRun))
+	s.runAnalyzers(server.RequestContext(ctx), toRun, shipshapeCtx, parseOptions(in.Options), parseTimeouts(in.Timeout), &nts, &errs)
 	log.Printf("finished analyzing, sending back %d notes and %d errors", len(nts), len(errs))
 	return resp, nil
 }
@@ -99,23 +135,136 @@ func (s analyzerService) GetStage(ctx server.Context, in *rpcpb.GetStageRequest)
 	return &rpcpb.GetStageResponse{Stage: s.stage.Enum()}, nil
 }
 
+// parseTimeouts returns the timeouts in the request, keyed by their lowercased category.
+// Timeouts that are not positive are left out.
+func parseTimeouts(timeouts []*configpb.TimeoutConfig) map[string]time.Duration {
+	result := make(map[string]time.Duration)
+	for _, t := range timeouts {
+		if t.GetSeconds() > 0 {
+			result[strings.ToLower(t.GetCategory())] = time.Duration(t.GetSeconds()) * time.Second
+		}
+	}
+	return result
+}
+
+// runAnalyzers runs the given analyzers on the provided context using a pool of s.concurrency
+// workers. Each analyzer gets the options and the timeout for its category, as returned by
+// parseOptions and parseTimeouts. The notes and failures are appended to nts and errs in the
+// same order as analyzers, regardless of the order in which the analyzers finish.
+func (s analyzerService) runAnalyzers(reqCtx context.Context, analyzers []Analyzer, ctx *ctxpb.ShipshapeContext, options map[string]Options, timeouts map[string]time.Duration, nts *[]*notepb.Note, errs *[]*rpcpb.AnalysisFailure) {
+	type result struct {
+		notes []*notepb.Note
+		errs  []*rpcpb.AnalysisFailure
+	}
+	results := make([]result, len(analyzers))
+
+	workers := s.concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(analyzers) {
+		workers = len(analyzers)
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				cat := strings.ToLower(analyzers[i].Category())
+				analyzerCtx := reqCtx
+				if opts, ok := options[cat]; ok {
+					analyzerCtx = withOptions(reqCtx, opts)
+				}
+				runAnalyzer(analyzerCtx, analyzers[i], ctx, timeouts[cat], &results[i].notes, &results[i].errs)
+			}
+		}()
+	}
+	for i := range analyzers {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for _, r := range results {
+		*nts = append(*nts, r.notes...)
+		*errs = append(*errs, r.errs...)
+	}
+}
+
 // runAnalyzer attempts to run the given analyzer on the provided context. It returns the list of notes
-// and errors that occured in the process.
-func runAnalyzer(analyzer Analyzer, ctx *ctxpb.ShipshapeContext, nts *[]*notepb.Note, errs *[]*rpcpb.AnalysisFailure) {
+// and errors that occured in the process. If timeout is positive, the analyzer gets that long to
+// finish. Once reqCtx is done or the timeout passes, a failure is added for the analyzer's category
+// and its results are no longer waited for; a ContextAnalyzer is also stopped. Once reqCtx is done,
+// no more analyzers are started. If the analyzer panics, the panic and its stack trace are added as
+// a failure for the analyzer's category.
+func runAnalyzer(reqCtx context.Context, analyzer Analyzer, ctx *ctxpb.ShipshapeContext, timeout time.Duration, nts *[]*notepb.Note, errs *[]*rpcpb.AnalysisFailure) {
 	c := analyzer.Category()
+	if err := reqCtx.Err(); err != nil {
+		log.Printf("Not running analyzer %v: %v", c, err)
+		appendFailure(errs, c, err)
+		return
+	}
+	analyzerCtx := reqCtx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		analyzerCtx, cancel = context.WithTimeout(reqCtx, timeout)
+		defer cancel()
+	}
 	log.Printf("About to run analyzer: %v", c)
 
-	notes, err := analyzer.Analyze(ctx)
-	if err != nil {
+	type result struct {
+		notes []*notepb.Note
+		err   error
+	}
+	// Buffered, so that an analyzer that is no longer waited for can still finish.
+	done := make(chan result, 1)
+	go func() {
+		var r result
+		defer func() {
+			if p := recover(); p != nil {
+				log.Printf("Analyzer %v panicked: %v", c, p)
+				r = result{err: fmt.Errorf("analyzer panicked: %v\n%s", p, debug.Stack())}
+			}
+			done <- r
+		}()
+		if ca, ok := analyzer.(ContextAnalyzer); ok {
+			r.notes, r.err = ca.AnalyzeContext(analyzerCtx, ctx)
+		} else {
+			r.notes, r.err = analyzer.Analyze(ctx)
+		}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			appendFailure(errs, c, r.err)
+		}
+		*nts = append(*nts, r.notes...)
+	case <-analyzerCtx.Done():
+		err := analyzerCtx.Err()
+		if reqCtx.Err() == nil {
+			err = fmt.Errorf("analyzer timed out after %v", timeout)
+		}
+		log.Printf("Stopped waiting for analyzer %v: %v", c, err)
 		appendFailure(errs, c, err)
 	}
-	*nts = append(*nts, notes...)
 }
 
-// appendFailure adds a new analysis failure to the list in errs
+// appendFailure adds a new analysis failure to the list in errs. If err is a MultiError, a
+// failure is added for each of its errors instead, and any FileErrors are attributed to
+// their file.
 func appendFailure(errs *[]*rpcpb.AnalysisFailure, cat string, err error) {
-	*errs = append(*errs, &rpcpb.AnalysisFailure{
-		Category:       proto.String(cat),
-		FailureMessage: proto.String(err.Error()),
-	})
+	for _, e := range flattenErrors(err) {
+		failure := &rpcpb.AnalysisFailure{
+			Category:       proto.String(cat),
+			FailureMessage: proto.String(e.Error()),
+		}
+		if fe, ok := e.(*FileError); ok {
+			failure.FilePath = proto.String(fe.Path)
+		}
+		*errs = append(*errs, failure)
+	}
 }
@@ -17,11 +17,21 @@
 package api
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	gostrings "strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/google/shipshape/shipshape/util/rpc/server"
 	"github.com/google/shipshape/shipshape/util/strings"
 
 	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+	configpb "github.com/google/shipshape/shipshape/proto/shipshape_config_proto"
 	ctxpb "github.com/google/shipshape/shipshape/proto/shipshape_context_proto"
 	rpcpb "github.com/google/shipshape/shipshape/proto/shipshape_rpc_proto"
 )
@@ -35,6 +45,77 @@ type fakeAnalyzer struct {
 func (f fakeAnalyzer) Category() string                                        { return f.category }
 func (f fakeAnalyzer) Analyze(*ctxpb.ShipshapeContext) ([]*notepb.Note, error) { return f.notes, f.err }
 
+// fakeContextAnalyzer returns its notes only if it was called through AnalyzeContext and its
+// context was not cancelled.
+type fakeContextAnalyzer struct {
+	category string
+	notes    []*notepb.Note
+}
+
+func (f fakeContextAnalyzer) Category() string { return f.category }
+func (f fakeContextAnalyzer) Analyze(*ctxpb.ShipshapeContext) ([]*notepb.Note, error) {
+	return nil, nil
+}
+func (f fakeContextAnalyzer) AnalyzeContext(reqCtx context.Context, ctx *ctxpb.ShipshapeContext) ([]*notepb.Note, error) {
+	if err := reqCtx.Err(); err != nil {
+		return nil, err
+	}
+	return f.notes, nil
+}
+
+// blockingAnalyzer waits for release to be closed before returning a single note. It tracks how
+// many blockingAnalyzers are running at once.
+type blockingAnalyzer struct {
+	category string
+	release  chan struct{}
+	running  *int32
+	maxSeen  *int32
+}
+
+func (b blockingAnalyzer) Category() string { return b.category }
+func (b blockingAnalyzer) Analyze(*ctxpb.ShipshapeContext) ([]*notepb.Note, error) {
+	n := atomic.AddInt32(b.running, 1)
+	defer atomic.AddInt32(b.running, -1)
+	for {
+		max := atomic.LoadInt32(b.maxSeen)
+		if n <= max || atomic.CompareAndSwapInt32(b.maxSeen, max, n) {
+			break
+		}
+	}
+	<-b.release
+	return []*notepb.Note{&notepb.Note{Category: proto.String(b.category)}}, nil
+}
+
+// rootAnalyzer returns a note describing the repo root that it was given.
+type rootAnalyzer struct{}
+
+func (rootAnalyzer) Category() string { return "Root" }
+func (rootAnalyzer) Analyze(ctx *ctxpb.ShipshapeContext) ([]*notepb.Note, error) {
+	return []*notepb.Note{&notepb.Note{Description: proto.String(ctx.GetRepoRoot())}}, nil
+}
+
+// optionsAnalyzer returns a note for each of the settings it was given.
+type optionsAnalyzer struct {
+	category string
+}
+
+func (o optionsAnalyzer) Category() string { return o.category }
+func (o optionsAnalyzer) Analyze(*ctxpb.ShipshapeContext) ([]*notepb.Note, error) {
+	return nil, nil
+}
+func (o optionsAnalyzer) AnalyzeContext(reqCtx context.Context, ctx *ctxpb.ShipshapeContext) ([]*notepb.Note, error) {
+	var notes []*notepb.Note
+	for name, value := range OptionsFromContext(reqCtx) {
+		notes = append(notes, &notepb.Note{Category: proto.String(o.category), Description: proto.String(name + "=" + value)})
+	}
+	return notes, nil
+}
+
+type panicAnalyzer struct{}
+
+func (panicAnalyzer) Category() string                                        { return "Panic" }
+func (panicAnalyzer) Analyze(*ctxpb.ShipshapeContext) ([]*notepb.Note, error) { panic("oh no") }
+
 func TestGetCategory(t *testing.T) {
 	tests := []struct {
 		analyzers []Analyzer
@@ -64,4 +145,231 @@ func TestGetCategory(t *testing.T) {
 	}
 }
 
-// TODO(ciera): test analyze!
+func TestAnalyzePrefersContext(t *testing.T) {
+	note := &notepb.Note{Category: proto.String("Foo"), Description: proto.String("A note")}
+	a := CreateAnalyzerService([]Analyzer{fakeContextAnalyzer{"Foo", []*notepb.Note{note}}}, ctxpb.Stage_PRE_BUILD)
+
+	in := &rpcpb.AnalyzeRequest{
+		ShipshapeContext: &ctxpb.ShipshapeContext{RepoRoot: proto.String(".")},
+		Category:         []string{"Foo"},
+	}
+	resp, err := a.Analyze(server.Map{}, in)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if len(resp.Note) != 1 || !proto.Equal(resp.Note[0], note) {
+		t.Errorf("Incorrect notes: got %v, want %v", resp.Note, note)
+	}
+	if len(resp.Failure) != 0 {
+		t.Errorf("Unexpected failures: %v", resp.Failure)
+	}
+}
+
+func TestAnalyzeIgnoresCategoryCase(t *testing.T) {
+	note := &notepb.Note{Category: proto.String("PyLint"), Description: proto.String("A note")}
+	a := CreateAnalyzerService([]Analyzer{
+		fakeAnalyzer{category: "PyLint", notes: []*notepb.Note{note}},
+		fakeAnalyzer{category: "JSHint", notes: []*notepb.Note{{Category: proto.String("JSHint")}}},
+	}, ctxpb.Stage_PRE_BUILD)
+
+	in := &rpcpb.AnalyzeRequest{
+		ShipshapeContext: &ctxpb.ShipshapeContext{RepoRoot: proto.String(".")},
+		Category:         []string{"pylint"},
+	}
+	resp, err := a.Analyze(server.Map{}, in)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if len(resp.Note) != 1 || !proto.Equal(resp.Note[0], note) {
+		t.Errorf("Incorrect notes: got %v, want %v", resp.Note, note)
+	}
+}
+
+func TestAnalyzePassesOptions(t *testing.T) {
+	a := CreateAnalyzerService([]Analyzer{optionsAnalyzer{"PyLint"}, optionsAnalyzer{"JSHint"}}, ctxpb.Stage_PRE_BUILD)
+
+	in := &rpcpb.AnalyzeRequest{
+		ShipshapeContext: &ctxpb.ShipshapeContext{RepoRoot: proto.String(".")},
+		Category:         []string{"PyLint", "JSHint"},
+		Options: []*configpb.CategoryOptions{
+			{Category: proto.String("pylint"), Settings: []string{"rcfile=tools/pylintrc"}},
+		},
+	}
+	resp, err := a.Analyze(server.Map{}, in)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	expect := []*notepb.Note{{Category: proto.String("PyLint"), Description: proto.String("rcfile=tools/pylintrc")}}
+	if len(resp.Note) != len(expect) || !proto.Equal(resp.Note[0], expect[0]) {
+		t.Errorf("Incorrect notes: got %v, want %v", resp.Note, expect)
+	}
+}
+
+func TestAnalyzeCancelled(t *testing.T) {
+	a := CreateAnalyzerService([]Analyzer{
+		fakeContextAnalyzer{"Foo", nil},
+		fakeAnalyzer{"Bar", nil, nil},
+	}, ctxpb.Stage_PRE_BUILD)
+
+	reqCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	in := &rpcpb.AnalyzeRequest{
+		ShipshapeContext: &ctxpb.ShipshapeContext{RepoRoot: proto.String(".")},
+		Category:         []string{"Foo", "Bar"},
+	}
+	resp, err := a.Analyze(server.WithRequestContext(server.Map{}, reqCtx), in)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	var cats []string
+	for _, f := range resp.Failure {
+		if f.GetFailureMessage() != context.Canceled.Error() {
+			t.Errorf("Incorrect failure message for %s: got %q, want %q", f.GetCategory(), f.GetFailureMessage(), context.Canceled.Error())
+		}
+		cats = append(cats, f.GetCategory())
+	}
+	if expect := []string{"Bar", "Foo"}; !strings.Equal(cats, expect) {
+		t.Errorf("Incorrect failed categories: got %v, want %v", cats, expect)
+	}
+}
+
+func TestAnalyzeCategoryTimeout(t *testing.T) {
+	var running, maxSeen int32
+	release := make(chan struct{})
+	defer close(release)
+	note := &notepb.Note{Category: proto.String("Fast"), Description: proto.String("A note")}
+	a := CreateAnalyzerService([]Analyzer{
+		blockingAnalyzer{"Slow", release, &running, &maxSeen},
+		fakeAnalyzer{"Fast", []*notepb.Note{note}, nil},
+	}, ctxpb.Stage_PRE_BUILD)
+
+	in := &rpcpb.AnalyzeRequest{
+		ShipshapeContext: &ctxpb.ShipshapeContext{RepoRoot: proto.String(".")},
+		Category:         []string{"Slow", "Fast"},
+		Timeout: []*configpb.TimeoutConfig{
+			{Category: proto.String("slow"), Seconds: proto.Int32(1)},
+			{Category: proto.String("Fast"), Seconds: proto.Int32(60)},
+		},
+	}
+	start := time.Now()
+	resp, err := a.Analyze(server.Map{}, in)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 10*time.Second {
+		t.Errorf("The slow analyzer was not stopped at its timeout: took %v", elapsed)
+	}
+	if len(resp.Note) != 1 || !proto.Equal(resp.Note[0], note) {
+		t.Errorf("Incorrect notes: got %v, want %v", resp.Note, note)
+	}
+	expect := &rpcpb.AnalysisFailure{Category: proto.String("Slow"), FailureMessage: proto.String("analyzer timed out after 1s")}
+	if len(resp.Failure) != 1 || !proto.Equal(resp.Failure[0], expect) {
+		t.Errorf("Incorrect failures: got %v, want %v", resp.Failure, expect)
+	}
+}
+
+func TestParseTimeouts(t *testing.T) {
+	got := parseTimeouts([]*configpb.TimeoutConfig{
+		{Category: proto.String("PyLint"), Seconds: proto.Int32(60)},
+		{Category: proto.String("JSHint"), Seconds: proto.Int32(0)},
+	})
+	if expect := map[string]time.Duration{"pylint": time.Minute}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Incorrect timeouts: got %v, want %v", got, expect)
+	}
+}
+
+func TestAnalyzeRecoversFromPanic(t *testing.T) {
+	note := &notepb.Note{Category: proto.String("Foo"), Description: proto.String("A note")}
+	a := CreateAnalyzerService([]Analyzer{
+		panicAnalyzer{},
+		fakeAnalyzer{"Foo", []*notepb.Note{note}, nil},
+	}, ctxpb.Stage_PRE_BUILD)
+
+	in := &rpcpb.AnalyzeRequest{
+		ShipshapeContext: &ctxpb.ShipshapeContext{RepoRoot: proto.String(".")},
+		Category:         []string{"Panic", "Foo"},
+	}
+	resp, err := a.Analyze(server.Map{}, in)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if len(resp.Note) != 1 || !proto.Equal(resp.Note[0], note) {
+		t.Errorf("Incorrect notes: got %v, want %v", resp.Note, note)
+	}
+	if len(resp.Failure) != 1 {
+		t.Fatalf("Expected one failure, got %v", resp.Failure)
+	}
+	f := resp.Failure[0]
+	if f.GetCategory() != "Panic" {
+		t.Errorf("Incorrect failure category: got %q, want %q", f.GetCategory(), "Panic")
+	}
+	msg := f.GetFailureMessage()
+	if !gostrings.HasPrefix(msg, "analyzer panicked: oh no\n") || !gostrings.Contains(msg, "panicAnalyzer.Analyze") {
+		t.Errorf("Failure message should contain the panic and its stack trace, got %q", msg)
+	}
+}
+
+func TestAnalyzeConcurrently(t *testing.T) {
+	release := make(chan struct{})
+	var running, maxSeen int32
+	cats := []string{"E", "C", "A", "D", "B"}
+	var analyzers []Analyzer
+	for _, cat := range cats {
+		analyzers = append(analyzers, blockingAnalyzer{cat, release, &running, &maxSeen})
+	}
+	a := CreateAnalyzerService(analyzers, ctxpb.Stage_PRE_BUILD)
+	a.SetConcurrency(2)
+
+	in := &rpcpb.AnalyzeRequest{
+		ShipshapeContext: &ctxpb.ShipshapeContext{RepoRoot: proto.String(".")},
+		Category:         cats,
+	}
+	go func() {
+		// Give the workers a chance to start more analyzers than they should.
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+	}()
+	resp, err := a.Analyze(server.Map{}, in)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+
+	if maxSeen != 2 {
+		t.Errorf("Incorrect number of analyzers run at once: got %d, want 2", maxSeen)
+	}
+	var got []string
+	for _, note := range resp.Note {
+		got = append(got, note.GetCategory())
+	}
+	if expect := []string{"A", "B", "C", "D", "E"}; !strings.Equal(got, expect) {
+		t.Errorf("Notes are not ordered by category: got %v, want %v", got, expect)
+	}
+}
+
+func TestAnalyzeAbsoluteRoot(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Could not get the current directory: %v", err)
+	}
+	a := CreateAnalyzerService([]Analyzer{rootAnalyzer{}}, ctxpb.Stage_PRE_BUILD)
+
+	in := &rpcpb.AnalyzeRequest{
+		ShipshapeContext: &ctxpb.ShipshapeContext{RepoRoot: proto.String("testdata")},
+		Category:         []string{"Root"},
+	}
+	resp, err := a.Analyze(server.Map{}, in)
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	expect := filepath.Join(wd, "testdata")
+	if len(resp.Note) != 1 || resp.Note[0].GetDescription() != expect {
+		t.Errorf("Incorrect repo root given to analyzer: got %v, want %q", resp.Note, expect)
+	}
+	if got, err := os.Getwd(); err != nil || got != wd {
+		t.Errorf("Working directory changed: got %q (%v), want %q", got, err, wd)
+	}
+	if in.ShipshapeContext.GetRepoRoot() != "testdata" {
+		t.Errorf("Request was modified: got repo root %q", in.ShipshapeContext.GetRepoRoot())
+	}
+}
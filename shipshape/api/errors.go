@@ -0,0 +1,67 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A FileError is an error that occurred while analyzing a single file. The analyzer service
+// reports it as an AnalysisFailure for that file.
+type FileError struct {
+	// Path is the path of the file, relative to the repo root.
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string { return fmt.Sprintf("%s: %v", e.Path, e.Err) }
+
+// A MultiError is a list of errors from a single analysis, such as one for each file that
+// could not be analyzed. Analyzers can return a MultiError to keep going after an error, and
+// the analyzer service reports each of its errors as a separate AnalysisFailure.
+type MultiError []error
+
+func (m MultiError) Error() string {
+	var msgs []string
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// ErrorOrNil returns nil if m is empty, and m otherwise. This avoids returning a non-nil
+// error interface that holds an empty MultiError.
+func (m MultiError) ErrorOrNil() error {
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+// flattenErrors returns the individual errors that make up err, expanding any MultiErrors.
+func flattenErrors(err error) []error {
+	m, ok := err.(MultiError)
+	if !ok {
+		return []error{err}
+	}
+	var errs []error
+	for _, e := range m {
+		errs = append(errs, flattenErrors(e)...)
+	}
+	return errs
+}
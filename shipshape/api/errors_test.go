@@ -0,0 +1,89 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	rpcpb "github.com/google/shipshape/shipshape/proto/shipshape_rpc_proto"
+)
+
+func TestMultiErrorOrNil(t *testing.T) {
+	var empty MultiError
+	if err := empty.ErrorOrNil(); err != nil {
+		t.Errorf("Expected nil error for empty MultiError, got %v", err)
+	}
+	m := MultiError{errors.New("one"), &FileError{"a/b.go", errors.New("two")}}
+	if err := m.ErrorOrNil(); err == nil {
+		t.Errorf("Expected error for non-empty MultiError")
+	}
+	if got, expect := m.Error(), "one\na/b.go: two"; got != expect {
+		t.Errorf("Incorrect message: got %q, want %q", got, expect)
+	}
+}
+
+func TestAppendFailure(t *testing.T) {
+	tests := []struct {
+		label  string
+		err    error
+		expect []*rpcpb.AnalysisFailure
+	}{
+		{
+			"Plain error",
+			errors.New("bad"),
+			[]*rpcpb.AnalysisFailure{
+				{Category: proto.String("Foo"), FailureMessage: proto.String("bad")},
+			},
+		},
+		{
+			"File error",
+			&FileError{"a.go", errors.New("bad")},
+			[]*rpcpb.AnalysisFailure{
+				{Category: proto.String("Foo"), FailureMessage: proto.String("a.go: bad"), FilePath: proto.String("a.go")},
+			},
+		},
+		{
+			"Nested multiple errors",
+			MultiError{
+				&FileError{"a.go", errors.New("bad")},
+				MultiError{errors.New("worse"), &FileError{"b.go", errors.New("worst")}},
+			},
+			[]*rpcpb.AnalysisFailure{
+				{Category: proto.String("Foo"), FailureMessage: proto.String("a.go: bad"), FilePath: proto.String("a.go")},
+				{Category: proto.String("Foo"), FailureMessage: proto.String("worse")},
+				{Category: proto.String("Foo"), FailureMessage: proto.String("b.go: worst"), FilePath: proto.String("b.go")},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		var failures []*rpcpb.AnalysisFailure
+		appendFailure(&failures, "Foo", test.err)
+		if len(failures) != len(test.expect) {
+			t.Errorf("Incorrect failures for %q: got %v, want %v", test.label, failures, test.expect)
+			continue
+		}
+		for i := range failures {
+			if failures[i].String() != test.expect[i].String() {
+				t.Errorf("Incorrect failure %d for %q: got %v, want %v", i, test.label, failures[i], test.expect[i])
+			}
+		}
+	}
+}
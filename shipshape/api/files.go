@@ -0,0 +1,148 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+	ctxpb "github.com/google/shipshape/shipshape/proto/shipshape_context_proto"
+)
+
+// A FileFilter decides whether a file, given by its path relative to the repo root,
+// should be analyzed.
+type FileFilter func(path string) bool
+
+// ExtensionFilter returns a FileFilter that accepts files with any of the given
+// extensions, such as ".go".
+func ExtensionFilter(exts ...string) FileFilter {
+	return func(path string) bool {
+		ext := filepath.Ext(path)
+		for _, e := range exts {
+			if ext == e {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// GlobFilter returns a FileFilter that accepts files matching any of the given
+// patterns, using the syntax of filepath.Match. Patterns without a separator are
+// matched against the base name of the file, and all other patterns are matched
+// against the whole path.
+func GlobFilter(patterns ...string) FileFilter {
+	return func(path string) bool {
+		for _, p := range patterns {
+			name := path
+			if !strings.Contains(p, "/") {
+				name = filepath.Base(path)
+			}
+			if ok, _ := filepath.Match(p, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// A FileAnalysis analyzes a single file, given by its path relative to the repo
+// root of ctx. It should stop early if reqCtx is done.
+type FileAnalysis func(reqCtx context.Context, ctx *ctxpb.ShipshapeContext, path string) ([]*notepb.Note, error)
+
+// AnalyzeFiles runs analyze on each file in ctx that filter accepts, with up to
+// workers files being analyzed at once. If workers is less than 1, it uses one
+// worker per CPU. A failure to analyze one file does not stop the others from
+// being analyzed, and a panic while analyzing a file is reported as an error for
+// that file. The notes are returned in the order of the files in ctx, along with
+// a MultiError holding a FileError for every file that could not be analyzed. If
+// reqCtx is done before all the files are analyzed, the remaining files are
+// skipped and reqCtx.Err() is returned instead.
+func AnalyzeFiles(reqCtx context.Context, ctx *ctxpb.ShipshapeContext, filter FileFilter, workers int, analyze FileAnalysis) ([]*notepb.Note, error) {
+	var paths []string
+	for _, path := range ctx.FilePath {
+		if filter == nil || filter(path) {
+			paths = append(paths, path)
+		}
+	}
+
+	type result struct {
+		notes []*notepb.Note
+		err   error
+	}
+	results := make([]result, len(paths))
+
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(paths) {
+		workers = len(paths)
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if reqCtx.Err() != nil {
+					continue
+				}
+				results[i].notes, results[i].err = analyzeFile(reqCtx, ctx, paths[i], analyze)
+			}
+		}()
+	}
+	for i := range paths {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	var notes []*notepb.Note
+	var errs MultiError
+	for i, r := range results {
+		notes = append(notes, r.notes...)
+		if r.err != nil {
+			errs = append(errs, &FileError{paths[i], r.err})
+		}
+	}
+	if err := reqCtx.Err(); err != nil {
+		return notes, err
+	}
+	return notes, errs.ErrorOrNil()
+}
+
+// analyzeFile runs analyze on a single file. Since it runs on a worker goroutine,
+// the recover in runAnalyzer cannot catch its panics, so they are turned into an
+// error for the file here.
+func analyzeFile(reqCtx context.Context, ctx *ctxpb.ShipshapeContext, path string, analyze FileAnalysis) (notes []*notepb.Note, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Analysis of %s panicked: %v", path, r)
+			notes, err = nil, fmt.Errorf("analysis panicked: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return analyze(reqCtx, ctx, path)
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"errors"
+	gostrings "strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/shipshape/shipshape/util/strings"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+	ctxpb "github.com/google/shipshape/shipshape/proto/shipshape_context_proto"
+)
+
+func TestExtensionFilter(t *testing.T) {
+	filter := ExtensionFilter(".go", ".py")
+	tests := []struct {
+		path   string
+		expect bool
+	}{
+		{"a.go", true},
+		{"dir/b.py", true},
+		{"c.js", false},
+		{"go", false},
+		{"dir.go/d", false},
+	}
+
+	for _, test := range tests {
+		if got := filter(test.path); got != test.expect {
+			t.Errorf("ExtensionFilter(.go, .py)(%q): got %v, want %v", test.path, got, test.expect)
+		}
+	}
+}
+
+func TestGlobFilter(t *testing.T) {
+	filter := GlobFilter("*_test.go", "third_party/*.js")
+	tests := []struct {
+		path   string
+		expect bool
+	}{
+		{"a_test.go", true},
+		{"dir/b_test.go", true},
+		{"a.go", false},
+		{"third_party/c.js", true},
+		{"c.js", false},
+		{"third_party/dir/c.js", false},
+	}
+
+	for _, test := range tests {
+		if got := filter(test.path); got != test.expect {
+			t.Errorf("GlobFilter(*_test.go, third_party/*.js)(%q): got %v, want %v", test.path, got, test.expect)
+		}
+	}
+}
+
+// noteForFile returns a note describing the file, or an error if the file is named "bad".
+func noteForFile(reqCtx context.Context, ctx *ctxpb.ShipshapeContext, path string) ([]*notepb.Note, error) {
+	if path == "bad" {
+		return nil, errors.New("bad file")
+	}
+	return []*notepb.Note{&notepb.Note{Description: proto.String(path)}}, nil
+}
+
+func TestAnalyzeFiles(t *testing.T) {
+	ctx := &ctxpb.ShipshapeContext{FilePath: []string{"e.go", "d.go", "bad", "skip.js", "c.go", "b.go", "a.go"}}
+	filter := func(path string) bool { return path != "skip.js" }
+
+	for _, workers := range []int{0, 1, 3, 10} {
+		notes, err := AnalyzeFiles(context.Background(), ctx, filter, workers, noteForFile)
+		var got []string
+		for _, note := range notes {
+			got = append(got, note.GetDescription())
+		}
+		if expect := []string{"e.go", "d.go", "c.go", "b.go", "a.go"}; !strings.Equal(got, expect) {
+			t.Errorf("Incorrect notes with %d workers: got %v, want %v", workers, got, expect)
+		}
+		if err == nil || err.Error() != "bad: bad file" {
+			t.Errorf("Incorrect error with %d workers: got %v, want %q", workers, err, "bad: bad file")
+		}
+	}
+}
+
+func TestAnalyzeFilesPanic(t *testing.T) {
+	ctx := &ctxpb.ShipshapeContext{FilePath: []string{"a.go", "panic.go", "b.go"}}
+	var analyze FileAnalysis = func(reqCtx context.Context, ctx *ctxpb.ShipshapeContext, path string) ([]*notepb.Note, error) {
+		if path == "panic.go" {
+			panic("cannot parse the output")
+		}
+		return noteForFile(reqCtx, ctx, path)
+	}
+
+	notes, err := AnalyzeFiles(context.Background(), ctx, nil, 2, analyze)
+	if len(notes) != 2 {
+		t.Errorf("Incorrect number of notes: got %v, want 2", notes)
+	}
+	errs, ok := err.(MultiError)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("Incorrect error: got %v, want a FileError for panic.go", err)
+	}
+	if fe, ok := errs[0].(*FileError); !ok || fe.Path != "panic.go" || !gostrings.Contains(fe.Error(), "cannot parse the output") {
+		t.Errorf("Incorrect error: got %v, want a FileError for panic.go", errs[0])
+	}
+}
+
+func TestAnalyzeFilesLimitsWorkers(t *testing.T) {
+	ctx := &ctxpb.ShipshapeContext{FilePath: []string{"a", "b", "c", "d", "e", "f"}}
+	var running, maxSeen int32
+	var analyze FileAnalysis = func(reqCtx context.Context, ctx *ctxpb.ShipshapeContext, path string) ([]*notepb.Note, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxSeen)
+			if n <= max || atomic.CompareAndSwapInt32(&maxSeen, max, n) {
+				break
+			}
+		}
+		return nil, nil
+	}
+
+	if _, err := AnalyzeFiles(context.Background(), ctx, nil, 2, analyze); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if maxSeen > 2 {
+		t.Errorf("Too many files analyzed at once: got %d, want at most 2", maxSeen)
+	}
+}
+
+func TestAnalyzeFilesCancelled(t *testing.T) {
+	ctx := &ctxpb.ShipshapeContext{FilePath: []string{"a", "b", "c"}}
+	reqCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var calls int32
+	var analyze FileAnalysis = func(reqCtx context.Context, ctx *ctxpb.ShipshapeContext, path string) ([]*notepb.Note, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, nil
+	}
+
+	if _, err := AnalyzeFiles(reqCtx, ctx, nil, 1, analyze); err != context.Canceled {
+		t.Errorf("Incorrect error: got %v, want %v", err, context.Canceled)
+	}
+	if calls != 0 {
+		t.Errorf("Files were analyzed after cancellation: %d", calls)
+	}
+}
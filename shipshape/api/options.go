@@ -0,0 +1,73 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"strings"
+
+	configpb "github.com/google/shipshape/shipshape/proto/shipshape_config_proto"
+)
+
+// Options are the settings that the Shipshape config gives for an analyzer's category,
+// by name. Each analyzer documents the settings it understands.
+type Options map[string]string
+
+// Get returns the value of the named setting, or def if it is not set.
+func (o Options) Get(name, def string) string {
+	if v, ok := o[name]; ok {
+		return v
+	}
+	return def
+}
+
+type optionsKey struct{}
+
+// OptionsFromContext returns the settings for the category of the analyzer that reqCtx
+// was passed to, or nil if the config has none. Only ContextAnalyzers can read their
+// settings, since Analyze is not given a context.
+func OptionsFromContext(reqCtx context.Context) Options {
+	opts, _ := reqCtx.Value(optionsKey{}).(Options)
+	return opts
+}
+
+// withOptions returns a copy of reqCtx that carries the given settings.
+func withOptions(reqCtx context.Context, opts Options) context.Context {
+	return context.WithValue(reqCtx, optionsKey{}, opts)
+}
+
+// parseOptions returns the settings for each category in the request, keyed by the
+// lowercased category name. Space around names and values is dropped. A setting without
+// an "=" is treated as set to the empty string, and later settings override earlier ones
+// with the same name.
+func parseOptions(options []*configpb.CategoryOptions) map[string]Options {
+	byCat := make(map[string]Options)
+	for _, co := range options {
+		cat := strings.ToLower(co.GetCategory())
+		if byCat[cat] == nil {
+			byCat[cat] = make(Options)
+		}
+		for _, setting := range co.Settings {
+			name, value := setting, ""
+			if i := strings.Index(setting, "="); i >= 0 {
+				name, value = setting[:i], setting[i+1:]
+			}
+			byCat[cat][strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	return byCat
+}
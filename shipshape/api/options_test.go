@@ -0,0 +1,61 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	configpb "github.com/google/shipshape/shipshape/proto/shipshape_config_proto"
+)
+
+func TestParseOptions(t *testing.T) {
+	options := []*configpb.CategoryOptions{
+		{Category: proto.String("PyLint"), Settings: []string{"rcfile=tools/pylintrc", "jobs = 4"}},
+		{Category: proto.String("go vet"), Settings: []string{"flags=-shadow -printf=false", "verbose"}},
+		{Category: proto.String("pylint"), Settings: []string{"rcfile=other/pylintrc"}},
+		{Category: proto.String("JSHint")},
+	}
+	expect := map[string]Options{
+		"pylint": {"rcfile": "other/pylintrc", "jobs": "4"},
+		"go vet": {"flags": "-shadow -printf=false", "verbose": ""},
+		"jshint": {},
+	}
+	if got := parseOptions(options); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Incorrect options: got %v, want %v", got, expect)
+	}
+}
+
+func TestOptionsFromContext(t *testing.T) {
+	if got := OptionsFromContext(context.Background()); got != nil {
+		t.Errorf("Expected no options, got %v", got)
+	}
+	opts := Options{"rcfile": "tools/pylintrc"}
+	got := OptionsFromContext(withOptions(context.Background(), opts))
+	if !reflect.DeepEqual(got, opts) {
+		t.Errorf("Incorrect options: got %v, want %v", got, opts)
+	}
+	if v := got.Get("rcfile", "pylintrc"); v != "tools/pylintrc" {
+		t.Errorf("Incorrect setting: got %q, want %q", v, "tools/pylintrc")
+	}
+	if v := got.Get("jobs", "1"); v != "1" {
+		t.Errorf("Incorrect default: got %q, want %q", v, "1")
+	}
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"log"
+
+	"github.com/google/shipshape/shipshape/util/rpc/server"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+	reporterpb "github.com/google/shipshape/shipshape/proto/shipshape_reporter_proto"
+)
+
+// A Reporter receives live progress from the Shipshape driver while analysis is running,
+// as defined by the Reporter service in shipshape_reporter.proto.
+type Reporter interface {
+	// ReportStatus is called whenever the analysis for a category changes status.
+	// The message is only expected to be set when the status is FAILED.
+	ReportStatus(category string, status reporterpb.AnalyzerStatus, message string) error
+
+	// ReportNotes is called with a batch of notes as soon as they are available.
+	// All notes in a batch have the same category.
+	ReportNotes(notes []*notepb.Note) error
+}
+
+// reporterService is a service that accepts the Reporter requests defined by
+// shipshape_reporter_proto and hands them off to a Reporter. Third parties can receive
+// reports by registering this service under the name "Reporter" using util/rpc/server,
+// and then passing its address to the Shipshape driver.
+type reporterService struct {
+	reporter Reporter
+}
+
+func CreateReporterService(reporter Reporter) *reporterService {
+	return &reporterService{reporter}
+}
+
+// ReportNotes passes the notes on to the underlying Reporter.
+func (s reporterService) ReportNotes(ctx server.Context, in *reporterpb.ReportNotesRequest) (*reporterpb.ReportNotesResponse, error) {
+	log.Printf("Received %d notes", len(in.Notes))
+	if err := s.reporter.ReportNotes(in.Notes); err != nil {
+		return nil, err
+	}
+	return &reporterpb.ReportNotesResponse{}, nil
+}
+
+// ReportStatus passes the status change on to the underlying Reporter.
+func (s reporterService) ReportStatus(ctx server.Context, in *reporterpb.ReportAnalyzerStatusRequest) (*reporterpb.ReportAnalyzerStatusResponse, error) {
+	log.Printf("Received status %v for category %s", in.GetStatus(), in.GetCategory())
+	if err := s.reporter.ReportStatus(in.GetCategory(), in.GetStatus(), in.GetMessage()); err != nil {
+		return nil, err
+	}
+	return &reporterpb.ReportAnalyzerStatusResponse{}, nil
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+	reporterpb "github.com/google/shipshape/shipshape/proto/shipshape_reporter_proto"
+)
+
+type status struct {
+	category string
+	status   reporterpb.AnalyzerStatus
+	message  string
+}
+
+type fakeReporter struct {
+	statuses []status
+	notes    []*notepb.Note
+	err      error
+}
+
+func (f *fakeReporter) ReportStatus(category string, s reporterpb.AnalyzerStatus, message string) error {
+	f.statuses = append(f.statuses, status{category, s, message})
+	return f.err
+}
+
+func (f *fakeReporter) ReportNotes(notes []*notepb.Note) error {
+	f.notes = append(f.notes, notes...)
+	return f.err
+}
+
+func TestReportStatus(t *testing.T) {
+	tests := []struct {
+		in     *reporterpb.ReportAnalyzerStatusRequest
+		expect status
+	}{
+		{
+			&reporterpb.ReportAnalyzerStatusRequest{
+				Category: proto.String("Foo"),
+				Status:   reporterpb.AnalyzerStatus_RUNNING.Enum(),
+			},
+			status{"Foo", reporterpb.AnalyzerStatus_RUNNING, ""},
+		},
+		{
+			&reporterpb.ReportAnalyzerStatusRequest{
+				Category: proto.String("Foo"),
+				Status:   reporterpb.AnalyzerStatus_FAILED.Enum(),
+				Message:  proto.String("badbadbad"),
+			},
+			status{"Foo", reporterpb.AnalyzerStatus_FAILED, "badbadbad"},
+		},
+	}
+
+	for _, test := range tests {
+		reporter := new(fakeReporter)
+		s := CreateReporterService(reporter)
+		if _, err := s.ReportStatus(nil, test.in); err != nil {
+			t.Errorf("Unexpected error for %v: %v", test.in, err)
+		}
+		if want := []status{test.expect}; !reflect.DeepEqual(reporter.statuses, want) {
+			t.Errorf("Incorrect status for %v: got %v, want %v", test.in, reporter.statuses, want)
+		}
+	}
+}
+
+func TestReportNotes(t *testing.T) {
+	notes := []*notepb.Note{
+		{Category: proto.String("Foo"), Description: proto.String("A note")},
+		{Category: proto.String("Foo"), Description: proto.String("Another note")},
+	}
+	reporter := new(fakeReporter)
+	s := CreateReporterService(reporter)
+	if _, err := s.ReportNotes(nil, &reporterpb.ReportNotesRequest{Notes: notes}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(reporter.notes, notes) {
+		t.Errorf("Incorrect notes: got %v, want %v", reporter.notes, notes)
+	}
+}
+
+func TestReporterError(t *testing.T) {
+	reporter := &fakeReporter{err: errors.New("badbadbad")}
+	s := CreateReporterService(reporter)
+	if _, err := s.ReportNotes(nil, &reporterpb.ReportNotesRequest{}); err == nil {
+		t.Error("Expected an error from ReportNotes")
+	}
+	if _, err := s.ReportStatus(nil, &reporterpb.ReportAnalyzerStatusRequest{}); err == nil {
+		t.Error("Expected an error from ReportStatus")
+	}
+}
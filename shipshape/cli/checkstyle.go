@@ -0,0 +1,132 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+)
+
+// CheckstyleOutput writes the results of an analysis as a Checkstyle XML report, which
+// CI servers such as Jenkins understand. Its HandleResponse and Done methods can be used
+// as the HandleResponse and ResponsesDone options. The report is written once all
+// responses are in.
+//
+// Each note is an error element under the file it is in, with the category, or category
+// and subcategory, as its source. Analyzers that failed to run are reported as errors of
+// severity "error". Notes and failures that do not belong to a file are reported under
+// the analyzed directory.
+type CheckstyleOutput struct {
+	Out io.Writer
+	collector
+}
+
+// Done writes out the Checkstyle report.
+func (c *CheckstyleOutput) Done() error {
+	sort.Stable(byPosition(c.notes))
+
+	report := checkstyleReport{Version: "4.3"}
+	files := make(map[string]*checkstyleFile)
+	file := func(name string) *checkstyleFile {
+		name = filepath.Clean(name)
+		if files[name] == nil {
+			report.Files = append(report.Files, &checkstyleFile{Name: name})
+			files[name] = report.Files[len(report.Files)-1]
+		}
+		return files[name]
+	}
+
+	for _, f := range c.failures {
+		name := f.dir
+		if f.failure.GetFilePath() != "" {
+			name = filepath.Join(f.dir, f.failure.GetFilePath())
+		}
+		cf := file(name)
+		cf.Errors = append(cf.Errors, checkstyleError{
+			Severity: "error",
+			Message:  fmt.Sprintf("Analyzer %s failed to run: %s", f.failure.GetCategory(), f.failure.GetFailureMessage()),
+			Source:   f.failure.GetCategory(),
+		})
+	}
+	for _, n := range c.notes {
+		name := n.path
+		if name == "" {
+			name = n.dir
+		}
+		e := checkstyleError{
+			Severity: checkstyleSeverity(n.note.GetSeverity()),
+			Message:  n.note.GetDescription(),
+			Source:   ruleID(n.note),
+		}
+		if r := lineRange(n.note); r != nil {
+			e.Line = int(r.GetStartLine())
+			e.Column = int(r.GetStartColumn())
+		}
+		cf := file(name)
+		cf.Errors = append(cf.Errors, e)
+	}
+
+	return writeXML(c.Out, report)
+}
+
+func checkstyleSeverity(severity notepb.Note_Severity) string {
+	switch severity {
+	case notepb.Note_BUILD_ERROR:
+		return "error"
+	case notepb.Note_OTHER:
+		return "info"
+	default:
+		return "warning"
+	}
+}
+
+// writeXML writes v as an indented XML document.
+func writeXML(out io.Writer, v interface{}) error {
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+	_, err = out.Write(append(b, '\n'))
+	return err
+}
+
+type checkstyleReport struct {
+	XMLName xml.Name          `xml:"checkstyle"`
+	Version string            `xml:"version,attr"`
+	Files   []*checkstyleFile `xml:"file"`
+}
+
+type checkstyleFile struct {
+	Name   string            `xml:"name,attr"`
+	Errors []checkstyleError `xml:"error"`
+}
+
+type checkstyleError struct {
+	Line     int    `xml:"line,attr,omitempty"`
+	Column   int    `xml:"column,attr,omitempty"`
+	Severity string `xml:"severity,attr"`
+	Message  string `xml:"message,attr"`
+	Source   string `xml:"source,attr"`
+}
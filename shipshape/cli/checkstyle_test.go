@@ -0,0 +1,103 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+	rpcpb "github.com/google/shipshape/shipshape/proto/shipshape_rpc_proto"
+	rangepb "github.com/google/shipshape/shipshape/proto/textrange_proto"
+)
+
+func TestCheckstyleOutput(t *testing.T) {
+	msg := &rpcpb.ShipshapeResponse{
+		AnalyzeResponse: []*rpcpb.AnalyzeResponse{{
+			Note: []*notepb.Note{
+				{
+					Category:    proto.String("JSHint"),
+					Description: proto.String("Missing semicolon."),
+					Location: &notepb.Location{
+						Path:  proto.String("a.js"),
+						Range: &rangepb.TextRange{StartLine: proto.Int32(18), StartColumn: proto.Int32(22)},
+					},
+				},
+				{
+					Category:    proto.String("go vet"),
+					Subcategory: proto.String("printf"),
+					Description: proto.String(`Too few arguments for "%d"`),
+					Severity:    notepb.Note_BUILD_ERROR.Enum(),
+					Location: &notepb.Location{
+						Path:  proto.String("a.go"),
+						Range: &rangepb.TextRange{StartLine: proto.Int32(3)},
+					},
+				},
+				{
+					Category:    proto.String("PostMessage"),
+					Description: proto.String("Hello"),
+					Severity:    notepb.Note_OTHER.Enum(),
+				},
+				{
+					Category:    proto.String("JSHint"),
+					Description: proto.String("Unused variable."),
+					Location: &notepb.Location{
+						Path:  proto.String("a.js"),
+						Range: &rangepb.TextRange{StartLine: proto.Int32(2)},
+					},
+				},
+			},
+			Failure: []*rpcpb.AnalysisFailure{
+				{Category: proto.String("PyLint"), FailureMessage: proto.String("could not parse"), FilePath: proto.String("b.py")},
+				{Category: proto.String("ErrorProne"), FailureMessage: proto.String("no build")},
+			},
+		}},
+	}
+
+	var out bytes.Buffer
+	c := &CheckstyleOutput{Out: &out}
+	if err := c.HandleResponse(msg, "src"); err != nil {
+		t.Fatalf("HandleResponse: %v", err)
+	}
+	if err := c.Done(); err != nil {
+		t.Fatalf("Done: %v", err)
+	}
+
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<checkstyle version="4.3">
+  <file name="src/b.py">
+    <error severity="error" message="Analyzer PyLint failed to run: could not parse" source="PyLint"></error>
+  </file>
+  <file name="src">
+    <error severity="error" message="Analyzer ErrorProne failed to run: no build" source="ErrorProne"></error>
+    <error severity="info" message="Hello" source="PostMessage"></error>
+  </file>
+  <file name="src/a.go">
+    <error line="3" severity="error" message="Too few arguments for &#34;%d&#34;" source="go vet:printf"></error>
+  </file>
+  <file name="src/a.js">
+    <error line="2" severity="warning" message="Unused variable." source="JSHint"></error>
+    <error line="18" column="22" severity="warning" message="Missing semicolon." source="JSHint"></error>
+  </file>
+</checkstyle>
+`
+	if got := out.String(); got != want {
+		t.Errorf("Checkstyle output: got\n%s\nwant\n%s", got, want)
+	}
+}
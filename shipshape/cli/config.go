@@ -0,0 +1,102 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/shipshape/shipshape/service"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+)
+
+// ValidateConfig checks the Shipshape config files of the repository at dir without
+// starting any containers, and writes each problem to out. Categories are checked
+// against the ones built into the Shipshape service. When the config lists analyzer
+// images, which can provide other categories, unknown categories are written as warnings
+// and not counted. It returns the number of problems.
+func ValidateConfig(dir string, out io.Writer) (int, error) {
+	notes, err := service.ValidateConfig(dir, service.BuiltinCategories)
+	if err != nil {
+		return 0, fmt.Errorf("could not read config: %v", err)
+	}
+	problems := 0
+	for _, note := range notes {
+		loc := filepath.Join(dir, note.GetLocation().GetPath())
+		if r := note.GetLocation().GetRange(); r.StartLine != nil {
+			loc = fmt.Sprintf("%s:%d", loc, r.GetStartLine())
+			if r.StartColumn != nil {
+				loc = fmt.Sprintf("%s:%d", loc, r.GetStartColumn())
+			}
+		}
+		if note.GetSeverity() == notepb.Note_OTHER {
+			fmt.Fprintf(out, "%s: warning: %s\n", loc, note.GetDescription())
+			continue
+		}
+		fmt.Fprintf(out, "%s: %s\n", loc, note.GetDescription())
+		problems++
+	}
+	if problems == 0 {
+		fmt.Fprintln(out, "No problems found.")
+	}
+	if images, err := service.GlobalConfig(dir); err == nil && len(images) > 0 {
+		fmt.Fprintf(out, "The categories of the analyzer images %s were not checked, since that needs docker.\n", strings.Join(images, ", "))
+	}
+	return problems, nil
+}
+
+// ExplainConfig writes out which categories Shipshape would run on file for the given
+// event, and how the Shipshape config files of the repository at dir select them. If
+// file is ignored, it writes out the rule that ignores it instead. The file is given
+// relative to the current directory. If cats is not empty, it is treated as the
+// categories requested on the command line. No containers are started.
+func ExplainConfig(dir, file, event string, cats []string, out io.Writer) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(absDir, absFile)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s is not inside %s", file, dir)
+	}
+
+	exp, err := service.ExplainConfig(absDir, event, rel, cats)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s (event %q):\n", filepath.ToSlash(rel), event)
+	if exp.IgnoredBy != "" {
+		fmt.Fprintf(out, "  Not analyzed: %s\n", exp.IgnoredBy)
+		return nil
+	}
+	for _, step := range exp.Steps {
+		fmt.Fprintf(out, "  %s\n", step)
+	}
+	if len(exp.Categories) == 0 {
+		fmt.Fprintln(out, "No categories run on this file.")
+	} else {
+		fmt.Fprintf(out, "Categories: %s\n", strings.Join(exp.Categories, ", "))
+	}
+	return nil
+}
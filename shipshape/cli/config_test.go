@@ -0,0 +1,160 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfig(t *testing.T, dir, content string) {
+	if err := ioutil.WriteFile(filepath.Join(dir, ".shipshape"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config_test")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		label        string
+		config       string
+		expectCount  int
+		expectOutput string
+	}{
+		{
+			"Valid config",
+			"events:\n  - event: review\n    categories:\n      - JSHint\n",
+			0,
+			"No problems found.\n",
+		},
+		{
+			"Unknown key and category",
+			"events:\n  - event: review\n    categories:\n      - JSHnit\n    categorys:\n      - go vet\n",
+			2,
+			filepath.Join(dir, ".shipshape") + ":4:7: Unknown category \"JSHnit\"; did you mean \"JSHint\"?\n" +
+				filepath.Join(dir, ".shipshape") + ":5:5: Unknown key \"categorys\"\n",
+		},
+		{
+			"Third-party images",
+			"global:\n  images:\n    - foo/bar:prod\n",
+			0,
+			"No problems found.\nThe categories of the analyzer images foo/bar:prod were not checked, since that needs docker.\n",
+		},
+		{
+			"Category from a third-party image",
+			"global:\n  images:\n    - foo/bar:prod\nevents:\n  - event: review\n    categories:\n      - AndroidLint\n",
+			0,
+			filepath.Join(dir, ".shipshape") + ":7:7: warning: Unknown category \"AndroidLint\"\n" +
+				"No problems found.\nThe categories of the analyzer images foo/bar:prod were not checked, since that needs docker.\n",
+		},
+	}
+
+	for _, test := range tests {
+		writeConfig(t, dir, test.config)
+		var out bytes.Buffer
+		count, err := ValidateConfig(dir, &out)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.label, err)
+			continue
+		}
+		if count != test.expectCount {
+			t.Errorf("%s: got %d problems, want %d", test.label, count, test.expectCount)
+		}
+		if out.String() != test.expectOutput {
+			t.Errorf("%s: incorrect output:\n got %q\nwant %q", test.label, out.String(), test.expectOutput)
+		}
+	}
+}
+
+func TestExplainConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config_test")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	writeConfig(t, dir, `
+global:
+  ignore:
+    - third_party/
+events:
+  - event: review
+    categories:
+      - JSHint
+paths:
+  - path: tools/
+    enable:
+      - PyLint
+`)
+
+	tests := []struct {
+		label  string
+		file   string
+		cats   []string
+		expect string
+	}{
+		{
+			"Path rule",
+			"tools/a.py",
+			nil,
+			`tools/a.py (event "review"):
+  Event "review" in .shipshape selects [JSHint]
+  path rule 0 ("tools/") in .shipshape enables [PyLint]
+Categories: JSHint, PyLint
+`,
+		},
+		{
+			"Ignored",
+			"third_party/a.js",
+			nil,
+			`third_party/a.js (event "review"):
+  Not analyzed: Ignore entry 0 ("third_party/") in .shipshape
+`,
+		},
+		{
+			"Explicit categories",
+			"a.js",
+			[]string{"go vet"},
+			`a.js (event "review"):
+  Categories requested explicitly: [go vet]
+Categories: go vet
+`,
+		},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		if err := ExplainConfig(dir, filepath.Join(dir, test.file), "review", test.cats, &out); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.label, err)
+			continue
+		}
+		if out.String() != test.expect {
+			t.Errorf("%s: incorrect output:\n got %q\nwant %q", test.label, out.String(), test.expect)
+		}
+	}
+
+	if err := ExplainConfig(dir, os.TempDir(), "review", nil, &bytes.Buffer{}); err == nil {
+		t.Error("Expected an error for a file outside the directory")
+	}
+}
@@ -0,0 +1,184 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/google/shipshape/shipshape/util/fixes"
+)
+
+// diffContext is the number of unchanged lines shown around the changes in a diff.
+const diffContext = 3
+
+// lineChange replaces the lines [start, end) of a file with lines.
+type lineChange struct {
+	start, end int
+	lines      []string
+}
+
+// writeDiff writes a unified diff of the changes that the edits, which are sorted and do
+// not overlap, make to the file at path with the given content.
+func writeDiff(w io.Writer, path string, content []byte, edits []fixes.Edit) error {
+	old := splitLines(string(content))
+	changes := lineChanges(string(content), old, edits)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", path, path)
+	delta := 0
+	for i := 0; i < len(changes); {
+		// Changes that are close enough for their context to touch go in the same hunk.
+		j := i + 1
+		for j < len(changes) && changes[j].start-changes[j-1].end <= 2*diffContext {
+			j++
+		}
+		delta = writeHunk(&buf, old, changes[i:j], delta)
+		i = j
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeHunk writes the changes as a single hunk. delta is the difference between the
+// number of lines in the new and the old file before the hunk, and the difference after
+// it is returned.
+func writeHunk(buf *bytes.Buffer, old []string, changes []lineChange, delta int) int {
+	start := changes[0].start - diffContext
+	if start < 0 {
+		start = 0
+	}
+	end := changes[len(changes)-1].end + diffContext
+	if end > len(old) {
+		end = len(old)
+	}
+	newDelta := delta
+	for _, c := range changes {
+		newDelta += len(c.lines) - (c.end - c.start)
+	}
+	fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(start, end-start), hunkRange(start+delta, end-start+newDelta-delta))
+
+	pos := start
+	for _, c := range changes {
+		writeDiffLines(buf, " ", old[pos:c.start])
+		writeDiffLines(buf, "-", old[c.start:c.end])
+		writeDiffLines(buf, "+", c.lines)
+		pos = c.end
+	}
+	writeDiffLines(buf, " ", old[pos:end])
+	return newDelta
+}
+
+// hunkRange formats the zero-based start and the length of a range of lines for a hunk
+// header. An empty range is given by the line before it.
+func hunkRange(start, n int) string {
+	switch n {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, n)
+	}
+}
+
+func writeDiffLines(buf *bytes.Buffer, prefix string, lines []string) {
+	for _, line := range lines {
+		buf.WriteString(prefix)
+		buf.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			buf.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// lineChanges converts the edits to content, which are sorted and do not overlap, to the
+// whole lines that they change. old holds the lines of content. Edits that share a line
+// become a single change, and changes that leave their lines as they were are left out.
+func lineChanges(content string, old []string, edits []fixes.Edit) []lineChange {
+	// starts[i] is the offset of line i, and starts[len(old)] is the end of content.
+	starts := make([]int, len(old)+1)
+	for i, line := range old {
+		starts[i+1] = starts[i] + len(line)
+	}
+	lineOf := func(offset int) int {
+		return sort.Search(len(starts), func(i int) bool { return starts[i] > offset }) - 1
+	}
+	endLine := func(offset int) int {
+		line := lineOf(offset)
+		if starts[line] < offset {
+			line++
+		}
+		return line
+	}
+
+	var changes []lineChange
+	for i := 0; i < len(edits); {
+		start, end := lineOf(edits[i].Start), endLine(edits[i].End)
+		if start == len(old) && start > 0 && !strings.HasSuffix(old[start-1], "\n") {
+			// Text added at the end of a file without a final newline extends its last line.
+			start--
+		}
+		j := i + 1
+		var text string
+		for {
+			for j < len(edits) && lineOf(edits[j].Start) < end {
+				if e := endLine(edits[j].End); e > end {
+					end = e
+				}
+				j++
+			}
+			pos := starts[start]
+			text = ""
+			for _, e := range edits[i:j] {
+				text += content[pos:e.Start] + e.Content
+				pos = e.End
+			}
+			text += content[pos:starts[end]]
+			if text == "" || strings.HasSuffix(text, "\n") || end == len(old) {
+				break
+			}
+			// The new text runs into the next line, which changes as well.
+			end++
+		}
+		if text != strings.Join(old[start:end], "") {
+			changes = append(changes, lineChange{start, end, splitLines(text)})
+		}
+		i = j
+	}
+	return changes
+}
+
+// splitLines splits s into lines, keeping the newlines at their ends.
+func splitLines(s string) []string {
+	var lines []string
+	for s != "" {
+		i := strings.IndexByte(s, '\n') + 1
+		if i == 0 {
+			i = len(s)
+		}
+		lines = append(lines, s[:i])
+		s = s[i:]
+	}
+	return lines
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/shipshape/shipshape/util/fixes"
+)
+
+func TestWriteDiff(t *testing.T) {
+	tests := []struct {
+		desc    string
+		content string
+		edits   []fixes.Edit
+		want    string
+	}{
+		{
+			desc:    "No edits",
+			content: "a\nb\n",
+			want:    "",
+		},
+		{
+			desc:    "Edit that changes nothing",
+			content: "a\nb\n",
+			edits:   []fixes.Edit{{Start: 2, End: 3, Content: "b"}},
+			want:    "",
+		},
+		{
+			desc:    "Edit within a line",
+			content: "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			edits:   []fixes.Edit{{Start: 8, End: 9, Content: "five"}},
+			want: "--- f\n+++ f\n@@ -2,7 +2,7 @@\n" +
+				" 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			desc:    "Insert and delete whole lines",
+			content: "a\nb\nc\n",
+			edits:   []fixes.Edit{{Start: 0, End: 0, Content: "new\n"}, {Start: 2, End: 4, Content: ""}},
+			want:    "--- f\n+++ f\n@@ -1,3 +1,3 @@\n+new\n a\n-b\n c\n",
+		},
+		{
+			desc:    "Edits on the same line",
+			content: "f(a, b)\n",
+			edits:   []fixes.Edit{{Start: 2, End: 3, Content: "x"}, {Start: 5, End: 6, Content: "y"}},
+			want:    "--- f\n+++ f\n@@ -1 +1 @@\n-f(a, b)\n+f(x, y)\n",
+		},
+		{
+			desc:    "Joined lines",
+			content: "a\nb\nc\n",
+			edits:   []fixes.Edit{{Start: 1, End: 2, Content: " "}},
+			want:    "--- f\n+++ f\n@@ -1,3 +1,2 @@\n-a\n-b\n+a b\n c\n",
+		},
+		{
+			desc:    "Separate hunks",
+			content: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			edits:   []fixes.Edit{{Start: 0, End: 2, Content: ""}, {Start: 18, End: 21, Content: "ten\n"}},
+			want: "--- f\n+++ f\n@@ -1,4 +1,3 @@\n-1\n 2\n 3\n 4\n" +
+				"@@ -7,4 +6,4 @@\n 7\n 8\n 9\n-10\n+ten\n",
+		},
+		{
+			desc:    "No newline at the end",
+			content: "a\nb",
+			edits:   []fixes.Edit{{Start: 3, End: 3, Content: "c"}},
+			want:    "--- f\n+++ f\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+bc\n\\ No newline at end of file\n",
+		},
+		{
+			desc:    "Empty file",
+			content: "",
+			edits:   []fixes.Edit{{Start: 0, End: 0, Content: "a\n"}},
+			want:    "--- f\n+++ f\n@@ -0,0 +1 @@\n+a\n",
+		},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		if err := writeDiff(&out, "f", []byte(test.content), test.edits); err != nil {
+			t.Errorf("%s: writeDiff: %v", test.desc, err)
+			continue
+		}
+		if got := out.String(); got != test.want {
+			t.Errorf("%s: got diff\n%s\nwant\n%s", test.desc, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/shipshape/shipshape/util/fixes"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+	rpcpb "github.com/google/shipshape/shipshape/proto/shipshape_rpc_proto"
+)
+
+// FixOutput applies the fixes suggested by the notes of an analysis. Its HandleResponse
+// and Done methods can be used as the HandleResponse and ResponsesDone options. The fixes
+// are applied once all responses are in.
+//
+// A note can suggest several alternative fixes, and the first one that can be applied is
+// used. A fix is applied as a whole or not at all: it is skipped if it is invalid, if a
+// file it changes cannot be read, or if it overlaps a fix from a note that comes earlier
+// by position. See fixes.Merger for how the fixes are merged.
+type FixOutput struct {
+	// Out is where the skipped fixes and a summary are written.
+	Out io.Writer
+	// Diff, if set, is where a unified diff of the fixed files is written.
+	Diff io.Writer
+	// Write writes the fixed files back. Otherwise, no file is changed.
+	Write bool
+	collector
+}
+
+// ApplyFixes makes the options also write back the fixes in the responses, after the
+// output that they are already set up for. The skipped fixes and a summary are written to
+// report, which should not be where a SARIF or XML document is being written.
+func (o *Options) ApplyFixes(report io.Writer) {
+	f := &FixOutput{Out: report, Write: true}
+	handleResponse, responsesDone := o.HandleResponse, o.ResponsesDone
+	o.HandleResponse = func(msg *rpcpb.ShipshapeResponse, directory string) error {
+		if err := handleResponse(msg, directory); err != nil {
+			return err
+		}
+		return f.HandleResponse(msg, directory)
+	}
+	o.ResponsesDone = func() error {
+		if err := responsesDone(); err != nil {
+			return err
+		}
+		return f.Done()
+	}
+}
+
+// Done applies the fixes collected so far and writes out the diff and the report.
+func (f *FixOutput) Done() error {
+	sort.Stable(byPosition(f.notes))
+
+	contents := make(map[string][]byte)
+	merger := fixes.NewMerger(contents)
+	total, applied := 0, 0
+	for _, n := range f.notes {
+		if len(n.note.Fix) == 0 {
+			continue
+		}
+		total++
+		var reason error
+		for _, fix := range n.note.Fix {
+			fix, err := resolvePaths(fix, n.dir, contents)
+			if err == nil {
+				err = merger.Add(fix)
+			}
+			if err == nil {
+				reason = nil
+				applied++
+				break
+			}
+			if reason == nil {
+				reason = err
+			}
+		}
+		if reason != nil {
+			fmt.Fprintf(f.Out, "Skipped the fix for %s [%s]: %v\n", notePosition(n), ruleID(n.note), reason)
+		}
+	}
+
+	edits := merger.Edits()
+	var paths []string
+	for path := range edits {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if f.Diff != nil {
+			if err := writeDiff(f.Diff, path, contents[path], edits[path]); err != nil {
+				return err
+			}
+		}
+		if f.Write {
+			if err := writeFixed(path, fixes.ApplyEdits(contents[path], edits[path])); err != nil {
+				return fmt.Errorf("could not apply fixes to %s: %v", path, err)
+			}
+		}
+	}
+
+	verb := "Applied"
+	if !f.Write {
+		verb = "Can apply"
+	}
+	fmt.Fprintf(f.Out, "%s %d of %d fixes, changing %d files.\n", verb, applied, total, len(paths))
+	return nil
+}
+
+// resolvePaths returns a copy of fix with the paths of its replacements joined to dir,
+// after reading the files they name into contents as needed. The paths come from the
+// analyzers, so a fix that would change a file outside of dir is rejected.
+func resolvePaths(fix *notepb.Fix, dir string, contents map[string][]byte) (*notepb.Fix, error) {
+	fix = proto.Clone(fix).(*notepb.Fix)
+	for _, r := range fix.Replacement {
+		if r.GetPath() == "" || strings.HasSuffix(r.GetPath(), "/") {
+			// Left for fixes.Validate and fixes.Edits to report.
+			continue
+		}
+		if filepath.IsAbs(r.GetPath()) {
+			return nil, fmt.Errorf("replacement path %s is absolute", r.GetPath())
+		}
+		path := filepath.Join(dir, r.GetPath())
+		if rel, err := filepath.Rel(dir, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("replacement path %s is outside of %s", r.GetPath(), dir)
+		}
+		r.Path = proto.String(path)
+		if _, ok := contents[path]; ok {
+			continue
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		contents[path] = content
+	}
+	return fix, nil
+}
+
+// writeFixed replaces the contents of the file at path, keeping its permissions.
+func writeFixed(path string, content []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, content, info.Mode())
+}
@@ -0,0 +1,264 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+	rpcpb "github.com/google/shipshape/shipshape/proto/shipshape_rpc_proto"
+	rangepb "github.com/google/shipshape/shipshape/proto/textrange_proto"
+)
+
+func byteFix(path string, start, end uint32, content string) *notepb.Fix {
+	return &notepb.Fix{Replacement: []*notepb.Replacement{{
+		Path:       proto.String(path),
+		Range:      &notepb.FixRange{Start: &notepb.FixRange_Position{Byte: proto.Uint32(start)}, End: &notepb.FixRange_Position{Byte: proto.Uint32(end)}},
+		NewContent: proto.String(content),
+	}}}
+}
+
+func lineFix(path string, start, end uint32, content string) *notepb.Fix {
+	return &notepb.Fix{Replacement: []*notepb.Replacement{{
+		Path:       proto.String(path),
+		Range:      &notepb.FixRange{Start: &notepb.FixRange_Position{Line: proto.Uint32(start)}, End: &notepb.FixRange_Position{Line: proto.Uint32(end)}},
+		NewContent: proto.String(content),
+	}}}
+}
+
+func fixNote(path string, line int32, fixes ...*notepb.Fix) *notepb.Note {
+	return &notepb.Note{
+		Category:    proto.String("Lint"),
+		Description: proto.String("Fixable"),
+		Location: &notepb.Location{
+			Path:  proto.String(path),
+			Range: &rangepb.TextRange{StartLine: proto.Int32(line)},
+		},
+		Fix: fixes,
+	}
+}
+
+func TestFixOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixes_test")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"a.js": "var a = 1\nvar b = 2\n",
+		"b.py": "import os\nimport sys\nprint 'hi'\n",
+		"c.go": "package c\n",
+	}
+	for path, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, path), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mixed := byteFix("c.go", 0, 1, "x")
+	mixed.Replacement[0].Range.End = &notepb.FixRange_Position{Line: proto.Uint32(1)}
+	msg := &rpcpb.ShipshapeResponse{
+		AnalyzeResponse: []*rpcpb.AnalyzeResponse{{
+			Note: []*notepb.Note{
+				fixNote("a.js", 1, byteFix("a.js", 9, 9, ";")),
+				fixNote("a.js", 2, byteFix("a.js", 19, 19, ";")),
+				// The same fix from another analyzer.
+				fixNote("a.js", 2, byteFix("a.js", 19, 19, ";")),
+				// Conflicts with the fix for line 1, so the alternative is used.
+				fixNote("a.js", 1, byteFix("a.js", 4, 10, "c = 1\n"), byteFix("a.js", 0, 3, "let")),
+				fixNote("b.py", 1, lineFix("b.py", 0, 1, "")),
+				// Conflicts with the fix that removes the first import.
+				fixNote("b.py", 1, lineFix("b.py", 0, 2, "import os, sys\n")),
+				fixNote("b.py", 3, lineFix("b.py", 2, 3, "print('hi')\n")),
+				fixNote("c.go", 1, mixed),
+				fixNote("c.go", 1, byteFix("c.go", 8, 100, "")),
+				fixNote("missing.go", 1, byteFix("missing.go", 0, 0, "")),
+				fixNote("c.go", 1),
+			},
+		}},
+	}
+
+	var out, diff bytes.Buffer
+	f := &FixOutput{Out: &out, Diff: &diff, Write: true}
+	if err := f.HandleResponse(msg, dir); err != nil {
+		t.Fatalf("HandleResponse: %v", err)
+	}
+	if err := f.Done(); err != nil {
+		t.Fatalf("Done: %v", err)
+	}
+
+	wantFiles := map[string]string{
+		"a.js": "let a = 1;\nvar b = 2;\n",
+		"b.py": "import sys\nprint('hi')\n",
+		"c.go": "package c\n",
+	}
+	for path, want := range wantFiles {
+		got, err := ioutil.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("Fixed %s: got %q, want %q", path, got, want)
+		}
+	}
+
+	a, b, c, missing := filepath.Join(dir, "a.js"), filepath.Join(dir, "b.py"), filepath.Join(dir, "c.go"), filepath.Join(dir, "missing.go")
+	wantOut := "Skipped the fix for " + b + ":1 [Lint]: the fix conflicts with an earlier one in " + b + "\n" +
+		"Skipped the fix for " + c + ":1 [Lint]: invalid replacement for " + c + ": the range must use either lines or bytes for both its start and end\n" +
+		"Skipped the fix for " + c + ":1 [Lint]: invalid replacement for " + c + ": byte 100 is past the end of the file\n" +
+		"Skipped the fix for " + missing + ":1 [Lint]: open " + missing + ": no such file or directory\n" +
+		"Applied 6 of 10 fixes, changing 2 files.\n"
+	if got := out.String(); got != wantOut {
+		t.Errorf("Report: got\n%s\nwant\n%s", got, wantOut)
+	}
+	wantDiff := "--- " + a + "\n+++ " + a + "\n@@ -1,2 +1,2 @@\n-var a = 1\n+let a = 1;\n-var b = 2\n+var b = 2;\n" +
+		"--- " + b + "\n+++ " + b + "\n@@ -1,3 +1,2 @@\n-import os\n import sys\n-print 'hi'\n+print('hi')\n"
+	if got := diff.String(); got != wantDiff {
+		t.Errorf("Diff: got\n%s\nwant\n%s", got, wantDiff)
+	}
+}
+
+func TestFixOutputDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixes_test")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a.js")
+	if err := ioutil.WriteFile(path, []byte("var a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &rpcpb.ShipshapeResponse{
+		AnalyzeResponse: []*rpcpb.AnalyzeResponse{{
+			Note: []*notepb.Note{fixNote("a.js", 1, byteFix("a.js", 5, 5, ";"))},
+		}},
+	}
+	var out bytes.Buffer
+	f := &FixOutput{Out: &out}
+	if err := f.HandleResponse(msg, dir); err != nil {
+		t.Fatalf("HandleResponse: %v", err)
+	}
+	if err := f.Done(); err != nil {
+		t.Fatalf("Done: %v", err)
+	}
+
+	if got, want := out.String(), "Can apply 1 of 1 fixes, changing 1 files.\n"; got != want {
+		t.Errorf("Report: got %q, want %q", got, want)
+	}
+	if got, err := ioutil.ReadFile(path); err != nil || string(got) != "var a\n" {
+		t.Errorf("File changed by a dry run: got %q, %v", got, err)
+	}
+}
+
+func TestFixOutputOutsideDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "fixes_test")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "repo")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	escape := filepath.Join(root, "escape")
+	for _, path := range []string{escape, filepath.Join(dir, "a.js")} {
+		if err := ioutil.WriteFile(path, []byte("keep\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msg := &rpcpb.ShipshapeResponse{
+		AnalyzeResponse: []*rpcpb.AnalyzeResponse{{
+			Note: []*notepb.Note{
+				fixNote("a.js", 1, byteFix("../escape", 0, 4, "gone")),
+				fixNote("a.js", 2, byteFix(escape, 0, 4, "gone")),
+				fixNote("a.js", 3, byteFix("sub/../../escape", 0, 4, "gone")),
+			},
+		}},
+	}
+	var out bytes.Buffer
+	f := &FixOutput{Out: &out, Write: true}
+	if err := f.HandleResponse(msg, dir); err != nil {
+		t.Fatalf("HandleResponse: %v", err)
+	}
+	if err := f.Done(); err != nil {
+		t.Fatalf("Done: %v", err)
+	}
+
+	a := filepath.Join(dir, "a.js")
+	wantOut := "Skipped the fix for " + a + ":1 [Lint]: replacement path ../escape is outside of " + dir + "\n" +
+		"Skipped the fix for " + a + ":2 [Lint]: replacement path " + escape + " is absolute\n" +
+		"Skipped the fix for " + a + ":3 [Lint]: replacement path sub/../../escape is outside of " + dir + "\n" +
+		"Applied 0 of 3 fixes, changing 0 files.\n"
+	if got := out.String(); got != wantOut {
+		t.Errorf("Report: got\n%s\nwant\n%s", got, wantOut)
+	}
+	if got, err := ioutil.ReadFile(escape); err != nil || string(got) != "keep\n" {
+		t.Errorf("File outside of the directory changed: got %q, %v", got, err)
+	}
+}
+
+func TestApplyFixesWithSARIF(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixes_test")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a.js")
+	if err := ioutil.WriteFile(path, []byte("var a = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	sarif := &SARIFOutput{Out: &stdout}
+	options := Options{HandleResponse: sarif.HandleResponse, ResponsesDone: sarif.Done}
+	options.ApplyFixes(&stderr)
+	msg := &rpcpb.ShipshapeResponse{
+		AnalyzeResponse: []*rpcpb.AnalyzeResponse{{
+			Note: []*notepb.Note{
+				fixNote("a.js", 1, byteFix("a.js", 9, 9, ";")),
+				fixNote("a.js", 1, byteFix("a.js", 0, 100, "")),
+			},
+		}},
+	}
+	if err := options.HandleResponse(msg, dir); err != nil {
+		t.Fatalf("HandleResponse: %v", err)
+	}
+	if err := options.ResponsesDone(); err != nil {
+		t.Fatalf("ResponsesDone: %v", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(stdout.Bytes(), &log); err != nil {
+		t.Errorf("The SARIF log is not valid JSON: %v\n%s", err, stdout.String())
+	}
+	if got := stderr.String(); !strings.Contains(got, "Skipped the fix") || !strings.Contains(got, "Applied 1 of 2 fixes") {
+		t.Errorf("Incorrect fix report: %q", got)
+	}
+	if got, err := ioutil.ReadFile(path); err != nil || string(got) != "var a = 1;\n" {
+		t.Errorf("Fixed a.js: got %q, %v", got, err)
+	}
+}
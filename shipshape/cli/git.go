@@ -0,0 +1,113 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// gitSelection describes which files git should select for analysis. At most
+// one of the fields may be set.
+type gitSelection struct {
+	// diffBase selects files that differ between the working tree and this ref.
+	diffBase string
+	// staged selects files that are staged in the index.
+	staged bool
+	// modified selects files that are untracked or modified in the working tree.
+	modified bool
+}
+
+func (s gitSelection) enabled() bool {
+	return s.diffBase != "" || s.staged || s.modified
+}
+
+func (s gitSelection) validate() error {
+	modes := 0
+	for _, set := range []bool{s.diffBase != "", s.staged, s.modified} {
+		if set {
+			modes++
+		}
+	}
+	if modes > 1 {
+		return fmt.Errorf("only one of --diff_base, --staged and --modified may be used")
+	}
+	// git would take a ref starting with "-", such as --output=<file>, as an option.
+	if strings.HasPrefix(s.diffBase, "-") {
+		return fmt.Errorf("invalid --diff_base %q", s.diffBase)
+	}
+	return nil
+}
+
+// gitFiles returns the files selected by sel under dir, relative to dir and
+// sorted. Files that have been deleted are left out, since there is nothing
+// left to analyze.
+func gitFiles(dir string, sel gitSelection) ([]string, error) {
+	if err := sel.validate(); err != nil {
+		return nil, err
+	}
+	var args []string
+	switch {
+	case sel.diffBase != "":
+		args = []string{"diff", "--name-only", "--relative", "-z", sel.diffBase, "--"}
+	case sel.staged:
+		args = []string{"diff", "--name-only", "--relative", "-z", "--cached", "--"}
+	case sel.modified:
+		// ls-files reports paths relative to dir and only below it.
+		args = []string{"ls-files", "--modified", "--others", "--exclude-standard", "-z"}
+	default:
+		return nil, nil
+	}
+
+	out, err := runGit(dir, args...)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var files []string
+	for _, path := range strings.Split(out, "\x00") {
+		// ls-files lists a file twice if it has unmerged changes.
+		if path == "" || seen[path] {
+			continue
+		}
+		seen[path] = true
+		if fs, err := os.Stat(filepath.Join(dir, path)); err != nil || fs.IsDir() {
+			continue
+		}
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// runGit runs git with the given arguments in dir and returns its stdout.
+func runGit(dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %v\n%s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// setupRepo creates a git repository with a committed, a staged, a modified,
+// an untracked and a deleted file. The caller must remove the returned directory.
+func setupRepo(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "git_test")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	git := func(args ...string) {
+		if _, err := runGit(dir, args...); err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+	}
+	write := func(path, content string) {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+	}
+
+	git("init", "-q")
+	git("config", "user.email", "test@example.com")
+	git("config", "user.name", "Test")
+	for _, path := range []string{"clean.go", "staged.go", "modified.go", "deleted.go", "sub/nested.go"} {
+		write(path, "package foo\n")
+	}
+	write(".gitignore", "ignored.go\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "base")
+	git("tag", "base")
+
+	write("staged.go", "package bar\n")
+	git("add", "staged.go")
+	write("modified.go", "package bar\n")
+	write("sub/nested.go", "package bar\n")
+	write("untracked.go", "package bar\n")
+	write("ignored.go", "package bar\n")
+	if err := os.Remove(filepath.Join(dir, "deleted.go")); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestGitFiles(t *testing.T) {
+	dir := setupRepo(t)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		label  string
+		subdir string
+		sel    gitSelection
+		expect []string
+	}{
+		{"DiffBase", "", gitSelection{diffBase: "base"}, []string{"modified.go", "staged.go", "sub/nested.go"}},
+		{"Staged", "", gitSelection{staged: true}, []string{"staged.go"}},
+		{"Modified", "", gitSelection{modified: true}, []string{"modified.go", "sub/nested.go", "untracked.go"}},
+		{"Subdirectory", "sub", gitSelection{diffBase: "base"}, []string{"nested.go"}},
+		{"None", "", gitSelection{}, nil},
+	}
+
+	for _, test := range tests {
+		files, err := gitFiles(filepath.Join(dir, test.subdir), test.sel)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.label, err)
+			continue
+		}
+		if !reflect.DeepEqual(files, test.expect) {
+			t.Errorf("%s: got %v, want %v", test.label, files, test.expect)
+		}
+	}
+}
+
+func TestGitFilesErrors(t *testing.T) {
+	dir := setupRepo(t)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		label string
+		sel   gitSelection
+	}{
+		{"Unknown ref", gitSelection{diffBase: "no-such-ref"}},
+		{"Multiple modes", gitSelection{staged: true, modified: true}},
+		{"Option as ref", gitSelection{diffBase: "--output=" + filepath.Join(dir, "written")}},
+		{"Short option as ref", gitSelection{diffBase: "-p"}},
+	}
+
+	for _, test := range tests {
+		if files, err := gitFiles(dir, test.sel); err == nil {
+			t.Errorf("%s: expected an error, got files %v", test.label, files)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "written")); !os.IsNotExist(err) {
+		t.Errorf("A ref was passed to git as an option: %s exists", filepath.Join(dir, "written"))
+	}
+}
+
+func TestRunNoChangedFiles(t *testing.T) {
+	dir := setupRepo(t)
+	defer os.RemoveAll(dir)
+	if _, err := runGit(dir, "reset", "-q"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	out := JUnitOutput{Out: &buf}
+	numNotes, err := New(Options{
+		File:           dir,
+		Staged:         true,
+		HandleResponse: out.HandleResponse,
+		ResponsesDone:  out.Done,
+	}).Run()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if numNotes != 0 {
+		t.Errorf("Incorrect number of notes: got %d, want 0", numNotes)
+	}
+	var report junitReport
+	if err := xml.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("Expected an empty JUnit report, got %q: %v", buf.String(), err)
+	}
+	if report.Tests != 0 || len(report.Suites) != 0 {
+		t.Errorf("Expected an empty JUnit report, got %s", buf.String())
+	}
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+)
+
+// JUnitOutput writes the results of an analysis as a JUnit XML report, which CI servers
+// such as Jenkins understand. Its HandleResponse and Done methods can be used as the
+// HandleResponse and ResponsesDone options. The report is written once all responses
+// are in.
+//
+// There is one test suite per category, and each note is a failed test case in it,
+// named after the position of the note. Analyzers that failed to run are test cases
+// with an error.
+type JUnitOutput struct {
+	Out io.Writer
+	collector
+}
+
+// Done writes out the JUnit report.
+func (j *JUnitOutput) Done() error {
+	sort.Stable(byPosition(j.notes))
+
+	report := junitReport{Name: "Shipshape"}
+	suites := make(map[string]*junitSuite)
+	suite := func(cat string) *junitSuite {
+		if suites[cat] == nil {
+			suites[cat] = &junitSuite{Name: cat}
+		}
+		return suites[cat]
+	}
+
+	for _, f := range j.failures {
+		name := f.dir
+		if f.failure.GetFilePath() != "" {
+			name = filepath.Join(f.dir, f.failure.GetFilePath())
+		}
+		s := suite(f.failure.GetCategory())
+		s.Errors++
+		s.Cases = append(s.Cases, junitCase{
+			Name:      filepath.Clean(name),
+			ClassName: f.failure.GetCategory(),
+			Error: &junitResult{
+				Message: fmt.Sprintf("Analyzer %s failed to run: %s", f.failure.GetCategory(), f.failure.GetFailureMessage()),
+			},
+		})
+	}
+	for _, n := range j.notes {
+		s := suite(n.note.GetCategory())
+		s.Failures++
+		s.Cases = append(s.Cases, junitCase{
+			Name:      notePosition(n),
+			ClassName: ruleID(n.note),
+			Failure: &junitResult{
+				Type:    n.note.GetSeverity().String(),
+				Message: n.note.GetDescription(),
+				Text:    n.note.GetDescription(),
+			},
+		})
+	}
+
+	var cats []string
+	for cat := range suites {
+		cats = append(cats, cat)
+	}
+	sort.Strings(cats)
+	for _, cat := range cats {
+		s := suites[cat]
+		s.Tests = len(s.Cases)
+		report.Tests += s.Tests
+		report.Failures += s.Failures
+		report.Errors += s.Errors
+		report.Suites = append(report.Suites, s)
+	}
+
+	return writeXML(j.Out, report)
+}
+
+type junitReport struct {
+	XMLName  xml.Name      `xml:"testsuites"`
+	Name     string        `xml:"name,attr"`
+	Tests    int           `xml:"tests,attr"`
+	Failures int           `xml:"failures,attr"`
+	Errors   int           `xml:"errors,attr"`
+	Suites   []*junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string       `xml:"name,attr"`
+	ClassName string       `xml:"classname,attr"`
+	Failure   *junitResult `xml:"failure"`
+	Error     *junitResult `xml:"error"`
+}
+
+type junitResult struct {
+	Type    string `xml:"type,attr,omitempty"`
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
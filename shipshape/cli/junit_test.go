@@ -0,0 +1,118 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+	rpcpb "github.com/google/shipshape/shipshape/proto/shipshape_rpc_proto"
+	rangepb "github.com/google/shipshape/shipshape/proto/textrange_proto"
+)
+
+func TestJUnitOutput(t *testing.T) {
+	msgs := []*rpcpb.ShipshapeResponse{
+		{
+			AnalyzeResponse: []*rpcpb.AnalyzeResponse{{
+				Note: []*notepb.Note{
+					{
+						Category:    proto.String("JSHint"),
+						Description: proto.String("Missing semicolon."),
+						Location: &notepb.Location{
+							Path:  proto.String("a.js"),
+							Range: &rangepb.TextRange{StartLine: proto.Int32(18), StartColumn: proto.Int32(22)},
+						},
+					},
+					{
+						Category:    proto.String("PostMessage"),
+						Description: proto.String("Hello"),
+						Severity:    notepb.Note_OTHER.Enum(),
+					},
+				},
+				Failure: []*rpcpb.AnalysisFailure{
+					{Category: proto.String("PyLint"), FailureMessage: proto.String("could not parse"), FilePath: proto.String("b.py")},
+				},
+			}},
+		},
+		{
+			AnalyzeResponse: []*rpcpb.AnalyzeResponse{{
+				Note: []*notepb.Note{
+					{
+						Category:    proto.String("go vet"),
+						Subcategory: proto.String("printf"),
+						Description: proto.String("Too few arguments <3"),
+						Severity:    notepb.Note_BUILD_ERROR.Enum(),
+						Location: &notepb.Location{
+							Path:  proto.String("a.go"),
+							Range: &rangepb.TextRange{StartLine: proto.Int32(3)},
+						},
+					},
+					{
+						Category:    proto.String("JSHint"),
+						Description: proto.String("Bad file."),
+						Location:    &notepb.Location{Path: proto.String("a.js")},
+					},
+				},
+			}},
+		},
+	}
+
+	var out bytes.Buffer
+	j := &JUnitOutput{Out: &out}
+	for _, msg := range msgs {
+		if err := j.HandleResponse(msg, "src"); err != nil {
+			t.Fatalf("HandleResponse: %v", err)
+		}
+	}
+	if err := j.Done(); err != nil {
+		t.Fatalf("Done: %v", err)
+	}
+
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites name="Shipshape" tests="5" failures="4" errors="1">
+  <testsuite name="JSHint" tests="2" failures="2" errors="0">
+    <testcase name="src/a.js" classname="JSHint">
+      <failure type="WARNING" message="Bad file.">Bad file.</failure>
+    </testcase>
+    <testcase name="src/a.js:18:22" classname="JSHint">
+      <failure type="WARNING" message="Missing semicolon.">Missing semicolon.</failure>
+    </testcase>
+  </testsuite>
+  <testsuite name="PostMessage" tests="1" failures="1" errors="0">
+    <testcase name="Global" classname="PostMessage">
+      <failure type="OTHER" message="Hello">Hello</failure>
+    </testcase>
+  </testsuite>
+  <testsuite name="PyLint" tests="1" failures="0" errors="1">
+    <testcase name="src/b.py" classname="PyLint">
+      <error message="Analyzer PyLint failed to run: could not parse"></error>
+    </testcase>
+  </testsuite>
+  <testsuite name="go vet" tests="1" failures="1" errors="0">
+    <testcase name="src/a.go:3" classname="go vet:printf">
+      <failure type="BUILD_ERROR" message="Too few arguments &lt;3">Too few arguments &lt;3</failure>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+	if got := out.String(); got != want {
+		t.Errorf("JUnit output: got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+	rpcpb "github.com/google/shipshape/shipshape/proto/shipshape_rpc_proto"
+	rangepb "github.com/google/shipshape/shipshape/proto/textrange_proto"
+)
+
+// outputNote is a note together with the path to write for it, which is empty for a
+// note that does not belong to a file, and the directory that the paths in the note
+// are relative to.
+type outputNote struct {
+	path string
+	dir  string
+	note *notepb.Note
+}
+
+// outputFailure is an analysis failure together with the directory its path is
+// relative to.
+type outputFailure struct {
+	dir     string
+	failure *rpcpb.AnalysisFailure
+}
+
+// collector collects the notes and failures streamed in by the service, for the output
+// formats that are written once all responses are in.
+type collector struct {
+	notes    []outputNote
+	failures []outputFailure
+}
+
+// HandleResponse collects the notes and failures in msg. The paths in them are relative
+// to directory.
+func (c *collector) HandleResponse(msg *rpcpb.ShipshapeResponse, directory string) error {
+	c.notes = append(c.notes, outputNotes(msg, directory)...)
+	for _, analysis := range msg.AnalyzeResponse {
+		for _, failure := range analysis.Failure {
+			c.failures = append(c.failures, outputFailure{directory, failure})
+		}
+	}
+	return nil
+}
+
+// outputNotes returns the notes in msg, with their paths made relative to the current
+// directory rather than to directory.
+func outputNotes(msg *rpcpb.ShipshapeResponse, directory string) []outputNote {
+	var notes []outputNote
+	for _, analysis := range msg.AnalyzeResponse {
+		for _, note := range analysis.Note {
+			path := ""
+			if note.GetLocation().GetPath() != "" {
+				path = filepath.Join(directory, note.GetLocation().GetPath())
+			}
+			notes = append(notes, outputNote{path, directory, note})
+		}
+	}
+	return notes
+}
+
+// notePosition returns the position of the note, as "path:line:col", or "Global" for
+// a note that does not belong to a file.
+func notePosition(n outputNote) string {
+	if n.path == "" {
+		return "Global"
+	}
+	pos := n.path
+	if r := lineRange(n.note); r != nil {
+		pos += fmt.Sprintf(":%d", r.GetStartLine())
+		if r.GetStartColumn() > 0 {
+			pos += fmt.Sprintf(":%d", r.GetStartColumn())
+		}
+	}
+	return pos
+}
+
+// byPosition sorts notes by path, then by line and column. Notes without a path come
+// first, and notes without a line come before the other notes in their file.
+type byPosition []outputNote
+
+func (b byPosition) Len() int      { return len(b) }
+func (b byPosition) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byPosition) Less(i, j int) bool {
+	if b[i].path != b[j].path {
+		return b[i].path < b[j].path
+	}
+	ri, rj := lineRange(b[i].note), lineRange(b[j].note)
+	if ri == nil || rj == nil {
+		return ri == nil && rj != nil
+	}
+	if ri.GetStartLine() != rj.GetStartLine() {
+		return ri.GetStartLine() < rj.GetStartLine()
+	}
+	return ri.GetStartColumn() < rj.GetStartColumn()
+}
+
+// lineRange returns the range of the note, or nil if it does not have a start line, in
+// which case it applies to the whole file.
+func lineRange(note *notepb.Note) *rangepb.TextRange {
+	r := note.GetLocation().GetRange()
+	if r == nil || r.GetStartLine() <= 0 {
+		return nil
+	}
+	return r
+}
@@ -0,0 +1,360 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	toolName     = "Shipshape"
+	toolURI      = "https://github.com/google/shipshape"
+	// srcRoot is the base id that the artifact URIs are relative to. It stands for the
+	// analyzed directory.
+	srcRoot = "SRCROOT"
+)
+
+// SARIFOutput writes the results of an analysis as a SARIF 2.1.0 log, for code scanning
+// tools. Its HandleResponse and Done methods can be used as the HandleResponse and
+// ResponsesDone options. The log is written once all responses are in.
+//
+// Each category, or category and subcategory, is a rule. Suggested fixes become SARIF
+// fixes, and analyzers that failed to run are reported as tool execution notifications.
+// Paths are URIs relative to the SRCROOT base id, which is declared as the analyzed
+// directory, the one that the paths in the responses are relative to.
+type SARIFOutput struct {
+	Out io.Writer
+	collector
+}
+
+// Done writes out the SARIF log.
+func (s *SARIFOutput) Done() error {
+	sort.Stable(byPosition(s.notes))
+	root, err := filepath.Abs(s.root())
+	if err != nil {
+		return err
+	}
+
+	driver := sarifDriver{Name: toolName, InformationURI: toolURI, Rules: []sarifRule{}}
+	ruleIndex := make(map[string]int)
+	results := []sarifResult{}
+	for _, n := range s.notes {
+		id := ruleID(n.note)
+		index, ok := ruleIndex[id]
+		if !ok {
+			index = len(driver.Rules)
+			ruleIndex[id] = index
+			driver.Rules = append(driver.Rules, sarifRule{ID: id})
+		}
+		if driver.Rules[index].HelpURI == "" {
+			driver.Rules[index].HelpURI = n.note.GetMoreInfo()
+		}
+		results = append(results, sarifResultFor(root, n, id, index))
+	}
+
+	notifications := []sarifNotification{}
+	for _, f := range s.failures {
+		failure := f.failure
+		notification := sarifNotification{
+			Level:      "error",
+			Message:    sarifMessage{Text: failure.GetFailureMessage()},
+			Descriptor: &sarifDescriptor{ID: failure.GetCategory()},
+		}
+		if failure.GetFilePath() != "" {
+			notification.Locations = []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifact(root, f.dir, failure.GetFilePath()),
+			}}}
+		}
+		notifications = append(notifications, notification)
+	}
+
+	log := sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: driver},
+			OriginalURIBaseIDs: map[string]sarifArtifactLocation{
+				srcRoot: {URI: sarifDirURI(root)},
+			},
+			Results: results,
+			Invocations: []sarifInvocation{{
+				ExecutionSuccessful:        len(s.failures) == 0,
+				ToolExecutionNotifications: notifications,
+			}},
+		}},
+	}
+	b, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = s.Out.Write(append(b, '\n'))
+	return err
+}
+
+// root returns the directory that the paths in the responses are relative to.
+func (s *SARIFOutput) root() string {
+	if len(s.notes) > 0 {
+		return s.notes[0].dir
+	}
+	if len(s.failures) > 0 {
+		return s.failures[0].dir
+	}
+	return "."
+}
+
+// ruleID returns the id of the rule for the note: its category, followed by its
+// subcategory if it has one.
+func ruleID(note *notepb.Note) string {
+	if note.Subcategory != nil {
+		return note.GetCategory() + ":" + note.GetSubcategory()
+	}
+	return note.GetCategory()
+}
+
+func sarifResultFor(root string, n outputNote, id string, index int) sarifResult {
+	result := sarifResult{
+		RuleID:    id,
+		RuleIndex: index,
+		Level:     sarifLevel(n.note.GetSeverity()),
+		Message:   sarifMessage{Text: n.note.GetDescription()},
+	}
+	if n.path != "" {
+		location := sarifPhysicalLocation{ArtifactLocation: sarifArtifact(root, n.dir, n.note.GetLocation().GetPath())}
+		if r := lineRange(n.note); r != nil {
+			region := &sarifRegion{StartLine: int(r.GetStartLine())}
+			if r.GetEndLine() > 0 {
+				region.EndLine = int(r.GetEndLine())
+			}
+			if r.GetStartColumn() > 0 {
+				region.StartColumn = int(r.GetStartColumn())
+				// SARIF end columns are exclusive, but Shipshape's are inclusive.
+				if r.GetEndColumn() > 0 {
+					region.EndColumn = int(r.GetEndColumn()) + 1
+				}
+			}
+			location.Region = region
+		}
+		result.Locations = []sarifLocation{{PhysicalLocation: location}}
+	}
+	for _, fix := range n.note.Fix {
+		result.Fixes = append(result.Fixes, sarifFixFor(root, fix, n.dir))
+	}
+	return result
+}
+
+// sarifFixFor converts a fix, whose paths are relative to dir.
+func sarifFixFor(root string, fix *notepb.Fix, dir string) sarifFix {
+	result := sarifFix{ArtifactChanges: []sarifArtifactChange{}}
+	if fix.Description != nil {
+		result.Description = &sarifMessage{Text: fix.GetDescription()}
+	}
+	// The replacements are grouped by file, so a change starts whenever the path does.
+	for _, r := range fix.Replacement {
+		location := sarifArtifact(root, dir, r.GetPath())
+		if len(result.ArtifactChanges) == 0 || result.ArtifactChanges[len(result.ArtifactChanges)-1].ArtifactLocation != location {
+			result.ArtifactChanges = append(result.ArtifactChanges, sarifArtifactChange{
+				ArtifactLocation: location,
+			})
+		}
+		change := &result.ArtifactChanges[len(result.ArtifactChanges)-1]
+		change.Replacements = append(change.Replacements, sarifReplacement{
+			DeletedRegion:   sarifDeletedRegion(r.GetRange()),
+			InsertedContent: &sarifContent{Text: r.GetNewContent()},
+		})
+	}
+	return result
+}
+
+// sarifDeletedRegion converts the range of a replacement. Fix ranges are zero-based with
+// an exclusive end, and are either byte or line based. A replacement without a range
+// replaces the whole file, which has no region, so it returns nil then.
+func sarifDeletedRegion(r *notepb.FixRange) *sarifRegion {
+	if r.GetStart() == nil {
+		return nil
+	}
+	start, end := r.GetStart(), r.GetEnd()
+	if start.Byte != nil {
+		return &sarifRegion{ByteOffset: intPtr(int(start.GetByte())), ByteLength: intPtr(int(end.GetByte()) - int(start.GetByte()))}
+	}
+	// Whole lines, from the start of the first line up to the start of the end line.
+	return &sarifRegion{
+		StartLine:   int(start.GetLine()) + 1,
+		StartColumn: 1,
+		EndLine:     int(end.GetLine()) + 1,
+		EndColumn:   1,
+	}
+}
+
+func sarifLevel(severity notepb.Note_Severity) string {
+	switch severity {
+	case notepb.Note_BUILD_ERROR:
+		return "error"
+	case notepb.Note_OTHER:
+		return "note"
+	default:
+		return "warning"
+	}
+}
+
+// sarifArtifact returns the location of the file at path, which is relative to dir. It is
+// a URI relative to the SRCROOT base id for the absolute directory root, unless the file
+// is outside of root, in which case it is an absolute file URI.
+func sarifArtifact(root, dir, path string) sarifArtifactLocation {
+	abs, err := filepath.Abs(filepath.Join(dir, path))
+	if err != nil {
+		return sarifArtifactLocation{URI: (&url.URL{Path: filepath.ToSlash(filepath.Clean(path))}).String()}
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return sarifArtifactLocation{URI: sarifFileURI(abs)}
+	}
+	return sarifArtifactLocation{URI: (&url.URL{Path: filepath.ToSlash(rel)}).String(), URIBaseID: srcRoot}
+}
+
+// sarifDirURI returns the file URI for the absolute directory dir. It ends in a slash, as
+// SARIF requires for base URIs.
+func sarifDirURI(dir string) string {
+	uri := sarifFileURI(dir)
+	if !strings.HasSuffix(uri, "/") {
+		uri += "/"
+	}
+	return uri
+}
+
+// sarifFileURI returns the file URI for the absolute path.
+func sarifFileURI(path string) string {
+	path = filepath.ToSlash(path)
+	// Windows paths such as C:/src need a leading slash in a file URI.
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+// The types below are the parts of the SARIF 2.1.0 object model that Shipshape uses.
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                        `json:"tool"`
+	OriginalURIBaseIDs map[string]sarifArtifactLocation `json:"originalUriBaseIds,omitempty"`
+	Invocations        []sarifInvocation                `json:"invocations"`
+	Results            []sarifResult                    `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID      string `json:"id"`
+	HelpURI string `json:"helpUri,omitempty"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful        bool                `json:"executionSuccessful"`
+	ToolExecutionNotifications []sarifNotification `json:"toolExecutionNotifications"`
+}
+
+type sarifNotification struct {
+	Level      string           `json:"level"`
+	Message    sarifMessage     `json:"message"`
+	Descriptor *sarifDescriptor `json:"descriptor,omitempty"`
+	Locations  []sarifLocation  `json:"locations,omitempty"`
+}
+
+type sarifDescriptor struct {
+	ID string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+	Fixes     []sarifFix      `json:"fixes,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int  `json:"startLine,omitempty"`
+	StartColumn int  `json:"startColumn,omitempty"`
+	EndLine     int  `json:"endLine,omitempty"`
+	EndColumn   int  `json:"endColumn,omitempty"`
+	ByteOffset  *int `json:"byteOffset,omitempty"`
+	ByteLength  *int `json:"byteLength,omitempty"`
+}
+
+type sarifFix struct {
+	Description     *sarifMessage         `json:"description,omitempty"`
+	ArtifactChanges []sarifArtifactChange `json:"artifactChanges"`
+}
+
+type sarifArtifactChange struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Replacements     []sarifReplacement    `json:"replacements"`
+}
+
+type sarifReplacement struct {
+	DeletedRegion   *sarifRegion  `json:"deletedRegion,omitempty"`
+	InsertedContent *sarifContent `json:"insertedContent,omitempty"`
+}
+
+type sarifContent struct {
+	Text string `json:"text"`
+}
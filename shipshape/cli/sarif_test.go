@@ -0,0 +1,287 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+	rpcpb "github.com/google/shipshape/shipshape/proto/shipshape_rpc_proto"
+	rangepb "github.com/google/shipshape/shipshape/proto/textrange_proto"
+)
+
+func TestSARIFOutput(t *testing.T) {
+	msgs := []*rpcpb.ShipshapeResponse{
+		{
+			AnalyzeResponse: []*rpcpb.AnalyzeResponse{{
+				Note: []*notepb.Note{
+					{
+						Category:    proto.String("JSHint"),
+						Description: proto.String("Missing semicolon."),
+						MoreInfo:    proto.String("http://www.jshint.com"),
+						Location: &notepb.Location{
+							Path:  proto.String("js/a.js"),
+							Range: &rangepb.TextRange{StartLine: proto.Int32(18), StartColumn: proto.Int32(22), EndColumn: proto.Int32(23)},
+						},
+						Fix: []*notepb.Fix{{
+							Description: proto.String("Add a semicolon"),
+							Replacement: []*notepb.Replacement{{
+								Path:       proto.String("js/a.js"),
+								Range:      &notepb.FixRange{Start: &notepb.FixRange_Position{Byte: proto.Uint32(120)}, End: &notepb.FixRange_Position{Byte: proto.Uint32(120)}},
+								NewContent: proto.String(";"),
+							}},
+						}},
+					},
+				},
+				Failure: []*rpcpb.AnalysisFailure{
+					{Category: proto.String("PyLint"), FailureMessage: proto.String("could not parse"), FilePath: proto.String("b.py")},
+				},
+			}},
+		},
+		{
+			AnalyzeResponse: []*rpcpb.AnalyzeResponse{{
+				Note: []*notepb.Note{
+					{
+						Category:    proto.String("go vet"),
+						Subcategory: proto.String("printf"),
+						Description: proto.String("Too few arguments"),
+						Severity:    notepb.Note_BUILD_ERROR.Enum(),
+						Location: &notepb.Location{
+							Path:  proto.String("a.go"),
+							Range: &rangepb.TextRange{StartLine: proto.Int32(3), EndLine: proto.Int32(4)},
+						},
+						Fix: []*notepb.Fix{{
+							Replacement: []*notepb.Replacement{
+								{
+									Path:       proto.String("a.go"),
+									Range:      &notepb.FixRange{Start: &notepb.FixRange_Position{Line: proto.Uint32(2)}, End: &notepb.FixRange_Position{Line: proto.Uint32(4)}},
+									NewContent: proto.String("fixed\n"),
+								},
+								{
+									Path:       proto.String("b.go"),
+									Range:      &notepb.FixRange{Start: &notepb.FixRange_Position{Line: proto.Uint32(0)}, End: &notepb.FixRange_Position{Line: proto.Uint32(0)}},
+									NewContent: proto.String("// header\n"),
+								},
+							},
+						}},
+					},
+					{
+						Category:    proto.String("WordCount"),
+						Description: proto.String("42 words"),
+						Severity:    notepb.Note_OTHER.Enum(),
+						Location:    &notepb.Location{},
+					},
+				},
+			}},
+		},
+	}
+
+	var buf bytes.Buffer
+	out := SARIFOutput{Out: &buf}
+	for _, msg := range msgs {
+		if err := out.HandleResponse(msg, "src"); err != nil {
+			t.Fatalf("HandleResponse failed: %v", err)
+		}
+	}
+	if err := out.Done(); err != nil {
+		t.Fatalf("Done failed: %v", err)
+	}
+
+	var got sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Could not parse the SARIF log: %v\n%s", err, buf.String())
+	}
+	root, err := filepath.Abs("src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := sarifLog{
+		Schema:  sarifSchema,
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "Shipshape",
+				InformationURI: "https://github.com/google/shipshape",
+				Rules: []sarifRule{
+					{ID: "WordCount"},
+					{ID: "go vet:printf"},
+					{ID: "JSHint", HelpURI: "http://www.jshint.com"},
+				},
+			}},
+			OriginalURIBaseIDs: map[string]sarifArtifactLocation{
+				"SRCROOT": {URI: "file://" + filepath.ToSlash(root) + "/"},
+			},
+			Invocations: []sarifInvocation{{
+				ExecutionSuccessful: false,
+				ToolExecutionNotifications: []sarifNotification{{
+					Level:      "error",
+					Message:    sarifMessage{Text: "could not parse"},
+					Descriptor: &sarifDescriptor{ID: "PyLint"},
+					Locations:  []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: "b.py", URIBaseID: "SRCROOT"}}}},
+				}},
+			}},
+			Results: []sarifResult{
+				{
+					RuleID:    "WordCount",
+					RuleIndex: 0,
+					Level:     "note",
+					Message:   sarifMessage{Text: "42 words"},
+				},
+				{
+					RuleID:    "go vet:printf",
+					RuleIndex: 1,
+					Level:     "error",
+					Message:   sarifMessage{Text: "Too few arguments"},
+					Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+						ArtifactLocation: sarifArtifactLocation{URI: "a.go", URIBaseID: "SRCROOT"},
+						Region:           &sarifRegion{StartLine: 3, EndLine: 4},
+					}}},
+					Fixes: []sarifFix{{
+						ArtifactChanges: []sarifArtifactChange{
+							{
+								ArtifactLocation: sarifArtifactLocation{URI: "a.go", URIBaseID: "SRCROOT"},
+								Replacements: []sarifReplacement{{
+									DeletedRegion:   &sarifRegion{StartLine: 3, StartColumn: 1, EndLine: 5, EndColumn: 1},
+									InsertedContent: &sarifContent{Text: "fixed\n"},
+								}},
+							},
+							{
+								ArtifactLocation: sarifArtifactLocation{URI: "b.go", URIBaseID: "SRCROOT"},
+								Replacements: []sarifReplacement{{
+									DeletedRegion:   &sarifRegion{StartLine: 1, StartColumn: 1, EndLine: 1, EndColumn: 1},
+									InsertedContent: &sarifContent{Text: "// header\n"},
+								}},
+							},
+						},
+					}},
+				},
+				{
+					RuleID:    "JSHint",
+					RuleIndex: 2,
+					Level:     "warning",
+					Message:   sarifMessage{Text: "Missing semicolon."},
+					Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+						ArtifactLocation: sarifArtifactLocation{URI: "js/a.js", URIBaseID: "SRCROOT"},
+						Region:           &sarifRegion{StartLine: 18, StartColumn: 22, EndColumn: 24},
+					}}},
+					Fixes: []sarifFix{{
+						Description: &sarifMessage{Text: "Add a semicolon"},
+						ArtifactChanges: []sarifArtifactChange{{
+							ArtifactLocation: sarifArtifactLocation{URI: "js/a.js", URIBaseID: "SRCROOT"},
+							Replacements: []sarifReplacement{{
+								DeletedRegion:   &sarifRegion{ByteOffset: intPtr(120), ByteLength: intPtr(0)},
+								InsertedContent: &sarifContent{Text: ";"},
+							}},
+						}},
+					}},
+				},
+			},
+		}},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		gotJSON, _ := json.MarshalIndent(got, "", "  ")
+		expectJSON, _ := json.MarshalIndent(expect, "", "  ")
+		t.Errorf("Incorrect SARIF log:\n got %s\nwant %s", gotJSON, expectJSON)
+	}
+}
+
+func TestSARIFOutputEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	out := SARIFOutput{Out: &buf}
+	if err := out.Done(); err != nil {
+		t.Fatalf("Done failed: %v", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Could not parse the SARIF log: %v\n%s", err, buf.String())
+	}
+	run := got["runs"].([]interface{})[0].(map[string]interface{})
+	invocation := run["invocations"].([]interface{})[0].(map[string]interface{})
+	if invocation["executionSuccessful"] != true {
+		t.Errorf("Expected a successful execution, got %v", invocation["executionSuccessful"])
+	}
+	// SARIF requires results to be an empty array, rather than missing, if there are none.
+	if results, ok := run["results"].([]interface{}); !ok || len(results) != 0 {
+		t.Errorf("Expected an empty results array, got %v", run["results"])
+	}
+}
+
+func TestSARIFArtifact(t *testing.T) {
+	tests := []struct {
+		label  string
+		dir    string
+		path   string
+		expect sarifArtifactLocation
+	}{
+		{"In the root", "/src", "a.go", sarifArtifactLocation{URI: "a.go", URIBaseID: "SRCROOT"}},
+		{"In a subdirectory", "/src/sub", "../lib/b.go", sarifArtifactLocation{URI: "lib/b.go", URIBaseID: "SRCROOT"}},
+		{"Escaped", "/src", "my file.go", sarifArtifactLocation{URI: "my%20file.go", URIBaseID: "SRCROOT"}},
+		{"Outside of the root", "/src", "../other/c.go", sarifArtifactLocation{URI: "file:///other/c.go"}},
+	}
+
+	for _, test := range tests {
+		if got := sarifArtifact("/src", test.dir, test.path); got != test.expect {
+			t.Errorf("%s: got %+v, want %+v", test.label, got, test.expect)
+		}
+	}
+}
+
+func TestSARIFOutputWholeFileFix(t *testing.T) {
+	msg := &rpcpb.ShipshapeResponse{
+		AnalyzeResponse: []*rpcpb.AnalyzeResponse{{
+			Note: []*notepb.Note{{
+				Category:    proto.String("gofmt"),
+				Description: proto.String("Not formatted"),
+				Location:    &notepb.Location{Path: proto.String("a.go")},
+				Fix: []*notepb.Fix{{
+					Replacement: []*notepb.Replacement{{
+						Path:       proto.String("a.go"),
+						NewContent: proto.String("package a\n"),
+					}},
+				}},
+			}},
+		}},
+	}
+
+	var buf bytes.Buffer
+	out := SARIFOutput{Out: &buf}
+	if err := out.HandleResponse(msg, "."); err != nil {
+		t.Fatalf("HandleResponse failed: %v", err)
+	}
+	if err := out.Done(); err != nil {
+		t.Fatalf("Done failed: %v", err)
+	}
+	var got sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Could not parse the SARIF log: %v\n%s", err, buf.String())
+	}
+	expect := []sarifFix{{
+		ArtifactChanges: []sarifArtifactChange{{
+			ArtifactLocation: sarifArtifactLocation{URI: "a.go", URIBaseID: "SRCROOT"},
+			Replacements:     []sarifReplacement{{InsertedContent: &sarifContent{Text: "package a\n"}}},
+		}},
+	}}
+	if fixes := got.Runs[0].Results[0].Fixes; !reflect.DeepEqual(fixes, expect) {
+		t.Errorf("Incorrect fixes: got %+v, want %+v", fixes, expect)
+	}
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+	rpcpb "github.com/google/shipshape/shipshape/proto/shipshape_rpc_proto"
+)
+
+// ParseSeverity returns the note severity with the given name, such as "WARNING",
+// ignoring case.
+func ParseSeverity(name string) (notepb.Note_Severity, error) {
+	value, ok := notepb.Note_Severity_value[strings.ToUpper(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown severity %q, must be one of BUILD_ERROR, WARNING or OTHER", name)
+	}
+	return notepb.Note_Severity(value), nil
+}
+
+// fails reports whether the note is at least as severe as failOn. BUILD_ERROR is
+// the most severe and OTHER the least, so with failOn set to OTHER every note fails.
+// An unset failOn is treated as OTHER.
+func fails(note *notepb.Note, failOn notepb.Note_Severity) bool {
+	if failOn == 0 {
+		failOn = notepb.Note_OTHER
+	}
+	return note.GetSeverity() <= failOn
+}
+
+// numNotes returns the number of notes in msg that are at least as severe as failOn.
+func numNotes(msg *rpcpb.ShipshapeResponse, failOn notepb.Note_Severity) int {
+	numNotes := 0
+	for _, analysis := range msg.AnalyzeResponse {
+		for _, note := range analysis.Note {
+			if fails(note, failOn) {
+				numNotes++
+			}
+		}
+	}
+	return numNotes
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+	rpcpb "github.com/google/shipshape/shipshape/proto/shipshape_rpc_proto"
+)
+
+func TestParseSeverity(t *testing.T) {
+	tests := []struct {
+		name   string
+		expect notepb.Note_Severity
+		err    bool
+	}{
+		{"BUILD_ERROR", notepb.Note_BUILD_ERROR, false},
+		{"warning", notepb.Note_WARNING, false},
+		{"Other", notepb.Note_OTHER, false},
+		{"ERROR", 0, true},
+		{"", 0, true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseSeverity(test.name)
+		if test.err {
+			if err == nil {
+				t.Errorf("ParseSeverity(%q): expected an error, got %v", test.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSeverity(%q): unexpected error: %v", test.name, err)
+		} else if got != test.expect {
+			t.Errorf("ParseSeverity(%q): got %v, want %v", test.name, got, test.expect)
+		}
+	}
+}
+
+func TestNumNotes(t *testing.T) {
+	msg := &rpcpb.ShipshapeResponse{
+		AnalyzeResponse: []*rpcpb.AnalyzeResponse{
+			{
+				Note: []*notepb.Note{
+					{Category: proto.String("go vet"), Severity: notepb.Note_BUILD_ERROR.Enum()},
+					// Notes without a severity are warnings.
+					{Category: proto.String("PyLint")},
+				},
+			},
+			{
+				Note: []*notepb.Note{
+					{Category: proto.String("WordCount"), Severity: notepb.Note_OTHER.Enum()},
+					{Category: proto.String("JSHint"), Severity: notepb.Note_WARNING.Enum()},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		failOn notepb.Note_Severity
+		expect int
+	}{
+		{0, 4},
+		{notepb.Note_OTHER, 4},
+		{notepb.Note_WARNING, 3},
+		{notepb.Note_BUILD_ERROR, 1},
+	}
+
+	for _, test := range tests {
+		if got := numNotes(msg, test.failOn); got != test.expect {
+			t.Errorf("numNotes with fail_on %v: got %d, want %d", test.failOn, got, test.expect)
+		}
+	}
+}
@@ -26,13 +26,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/google/shipshape/shipshape/cli"
 	"github.com/google/shipshape/shipshape/util/defaults"
 
-	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
 	rpcpb "github.com/google/shipshape/shipshape/proto/shipshape_rpc_proto"
 )
 
@@ -49,8 +47,18 @@ var (
 	useLocalKythe  = flag.Bool("local_kythe", false, "True if we should not pull down the kythe image. This is used for testing a new kythe image.")
 	showCategories = flag.Bool("show_categories", false, "Show what categories are available instead of running analyses.")
 	hotStart       = flag.Bool("hot_start", false, "Just start the service, but do nothing else.")
+	diffBase       = flag.String("diff_base", "", "Only analyze files that differ from this git ref (for example, origin/master).")
+	staged         = flag.Bool("staged", false, "Only analyze files that are staged for commit in git.")
+	modified       = flag.Bool("modified", false, "Only analyze files that are untracked or modified in git.")
+	format         = flag.String("format", "text", "The format to print the results in: text, sarif (SARIF 2.1.0), junit (JUnit XML) or checkstyle (Checkstyle XML). Ignored if --json_output is given.")
+	color          = flag.Bool("color", false, "Color the text output by severity.")
+	oneLine        = flag.Bool("one_line", false, "Print each note on a single line, as path:line:col: [Category] message, instead of grouping the notes by file. The notes are printed at the end, all sorted by file and line, rather than as each analyzer finishes.")
+	applyFixes     = flag.Bool("apply_fixes", false, "Apply the fixes suggested by the notes to the analyzed files.")
+	printDiff      = flag.Bool("print_diff", false, "Print the fixes suggested by the notes as a unified diff instead of the results. The files are not changed unless --apply_fixes is also given.")
+	failOn         = flag.String("fail_on", "OTHER", "The least severe kind of note that makes shipshape exit with an error: BUILD_ERROR, WARNING or OTHER. Less severe notes are still printed.")
 	keyFlags       = []string{"analyzer_images", "build", "categories", "inside_docker", "event", "json_output",
-		"repo", "stay_up", "tag", "local_kythe", "show_categories"}
+		"repo", "stay_up", "tag", "local_kythe", "show_categories", "diff_base", "staged", "modified", "fail_on",
+		"format", "color", "one_line", "apply_fixes", "print_diff"}
 )
 
 const (
@@ -65,6 +73,8 @@ func shipshapeUsage() {
 		shipshapeArgs[flag] = true
 	}
 	fmt.Println("USAGE: shipshape [flags] <directory>")
+	fmt.Println("       shipshape config validate [<directory>]")
+	fmt.Println("       shipshape [--event=<event>] [--categories=<categories>] config explain [<directory>] <file>")
 	fmt.Println("Shipshape flags: (for all flags, run shipshape -help)")
 	flag.VisitAll(func(f *flag.Flag) {
 		_, isShipshapeArg := shipshapeArgs[f.Name]
@@ -79,53 +89,60 @@ func shipshapeUsage() {
 	})
 }
 
-func outputAsText(msg *rpcpb.ShipshapeResponse, directory string) error {
+// outputAsJSON writes all the results received so far to the given file.
+func outputAsJSON(msg *rpcpb.ShipshapeResponse, path string) error {
 	// TODO(ciera): these results aren't sorted. They should be sorted by path and start line
-	fileNotes := make(map[string][]*notepb.Note)
-	for _, analysis := range msg.AnalyzeResponse {
-		for _, failure := range analysis.Failure {
-			fmt.Printf("WARNING: Analyzer %s failed to run: %s\n", *failure.Category, *failure.FailureMessage)
-		}
-		for _, note := range analysis.Note {
-			path := ""
-			if note.Location != nil {
-				path = filepath.Join(directory, note.Location.GetPath())
-			}
-			fileNotes[path] = append(fileNotes[path], note)
-		}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
 	}
+	return ioutil.WriteFile(path, b, 0644)
+}
 
-	for path, notes := range fileNotes {
-		if path != "" {
-			fmt.Println(path)
-		} else {
-			fmt.Println("Global")
+// configCommand runs a config subcommand, which works on the .shipshape files without
+// starting any containers, and returns the exit code.
+func configCommand(args []string, cats []string) int {
+	var err error
+	numProblems := 0
+	switch {
+	case len(args) >= 1 && len(args) <= 2 && args[0] == "validate":
+		dir := "."
+		if len(args) == 2 {
+			dir = args[1]
 		}
-		for _, note := range notes {
-			loc := ""
-			subCat := ""
-			if note.Subcategory != nil {
-				subCat = ":" + *note.Subcategory
-			}
-			if note.GetLocation().Range != nil && note.GetLocation().GetRange().StartLine != nil {
-				if note.GetLocation().GetRange().StartColumn != nil {
-					loc = fmt.Sprintf("Line %d, Col %d ", *note.Location.Range.StartLine, *note.Location.Range.StartColumn)
-				} else {
-					loc = fmt.Sprintf("Line %d ", *note.Location.Range.StartLine)
-				}
-			}
-
-			fmt.Printf("%s[%s%s]\n", loc, *note.Category, subCat)
-			fmt.Printf("\t%s\n", *note.Description)
+		numProblems, err = cli.ValidateConfig(dir, os.Stdout)
+	case len(args) >= 2 && len(args) <= 3 && args[0] == "explain":
+		dir, file := ".", args[1]
+		if len(args) == 3 {
+			dir, file = args[1], args[2]
 		}
-		fmt.Println()
+		err = cli.ExplainConfig(dir, file, *event, cats, os.Stdout)
+	default:
+		shipshapeUsage()
+		return returnError
+	}
+
+	if err != nil {
+		fmt.Printf("Error: %v\n", err.Error())
+		return returnError
 	}
-	return nil
+	if numProblems != 0 {
+		return returnFindings
+	}
+	return returnNoFindings
 }
 
 func main() {
 	flag.Parse()
 
+	cats := []string{}
+	if *categories != "" {
+		cats = strings.Split(*categories, ",")
+	}
+	if flag.Arg(0) == "config" {
+		os.Exit(configCommand(flag.Args()[1:], cats))
+	}
+
 	// Get the file/directory to analyze.
 	// If we are just showing category list, default to the current directory
 	file := "."
@@ -136,14 +153,16 @@ func main() {
 		os.Exit(returnError)
 	}
 
+	failOnSeverity, err := cli.ParseSeverity(*failOn)
+	if err != nil {
+		fmt.Printf("Error: invalid --fail_on: %v\n", err)
+		os.Exit(returnError)
+	}
+
 	thirdPartyAnalyzers := []string{}
 	if *analyzerImages != "" {
 		thirdPartyAnalyzers = strings.Split(*analyzerImages, ",")
 	}
-	cats := []string{}
-	if *categories != "" {
-		cats = strings.Split(*categories, ",")
-	}
 
 	options := cli.Options{
 		File:                file,
@@ -156,28 +175,59 @@ func main() {
 		StayUp:              *stayUp,
 		Tag:                 *tag,
 		LocalKythe:          *useLocalKythe,
+		DiffBase:            *diffBase,
+		Staged:              *staged,
+		Modified:            *modified,
+		FailOn:              failOnSeverity,
 	}
-	if *jsonOutput == "" {
-		options.HandleResponse = outputAsText
-	} else {
+	switch {
+	case *printDiff:
+		// Only print the diff, so that it can be piped to patch.
+		fixes := &cli.FixOutput{Out: os.Stderr, Diff: os.Stdout, Write: *applyFixes}
+		options.HandleResponse = fixes.HandleResponse
+		options.ResponsesDone = fixes.Done
+	case *jsonOutput == "" && *format == "text":
+		text := &cli.TextOutput{Out: os.Stdout, Color: *color, OneLine: *oneLine}
+		options.HandleResponse = text.HandleResponse
+		options.ResponsesDone = text.Done
+	case *jsonOutput == "" && *format == "sarif":
+		sarif := &cli.SARIFOutput{Out: os.Stdout}
+		options.HandleResponse = sarif.HandleResponse
+		options.ResponsesDone = sarif.Done
+	case *jsonOutput == "" && *format == "junit":
+		junit := &cli.JUnitOutput{Out: os.Stdout}
+		options.HandleResponse = junit.HandleResponse
+		options.ResponsesDone = junit.Done
+	case *jsonOutput == "" && *format == "checkstyle":
+		checkstyle := &cli.CheckstyleOutput{Out: os.Stdout}
+		options.HandleResponse = checkstyle.HandleResponse
+		options.ResponsesDone = checkstyle.Done
+	case *jsonOutput == "":
+		fmt.Printf("Error: unknown --format %q, must be text, sarif, junit or checkstyle\n", *format)
+		os.Exit(returnError)
+	default:
 		// TODO(supertri): Does not work for showCategories
 		var allResponses rpcpb.ShipshapeResponse
+		// Rewrite the file as each response streams in, so that it always holds
+		// the results received so far.
 		options.HandleResponse = func(msg *rpcpb.ShipshapeResponse, _ string) error {
 			allResponses.AnalyzeResponse = append(allResponses.AnalyzeResponse, msg.AnalyzeResponse...)
-			return nil
+			return outputAsJSON(&allResponses, *jsonOutput)
 		}
 		options.ResponsesDone = func() error {
-			// TODO(ciera): these results aren't sorted. They should be sorted by path and start line
-			b, err := json.Marshal(allResponses)
-			if err != nil {
-				return err
-			}
-			return ioutil.WriteFile(*jsonOutput, b, 0644)
+			return outputAsJSON(&allResponses, *jsonOutput)
+		}
+	}
+	if *applyFixes && !*printDiff {
+		// Keep the fix report out of a SARIF or XML document on stdout.
+		report := os.Stdout
+		if *jsonOutput == "" && *format != "text" {
+			report = os.Stderr
 		}
+		options.ApplyFixes(report)
 	}
 	invocation := cli.New(options)
 	numResults := 0
-	var err error = nil
 
 	if *showCategories {
 		err = invocation.ShowCategories()
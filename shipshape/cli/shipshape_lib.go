@@ -35,6 +35,7 @@ import (
 	"github.com/google/shipshape/shipshape/util/rpc/client"
 	glog "github.com/google/shipshape/third_party/go-glog"
 
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
 	ctxpb "github.com/google/shipshape/shipshape/proto/shipshape_context_proto"
 	rpcpb "github.com/google/shipshape/shipshape/proto/shipshape_rpc_proto"
 )
@@ -59,6 +60,17 @@ type Options struct {
 	StayUp      bool
 	Tag         string
 	LocalKythe  bool
+	// DiffBase, Staged and Modified restrict the analysis of a directory to
+	// the files git reports as changed. At most one of them may be set.
+	// DiffBase selects files that differ from the given git ref, Staged
+	// selects files staged for commit, and Modified selects untracked and
+	// modified files.
+	DiffBase string
+	Staged   bool
+	Modified bool
+	// FailOn is the least severe kind of note that Run counts as a finding. The other
+	// notes are still passed to HandleResponse. If unset, every note is counted.
+	FailOn notepb.Note_Severity
 	// Directory has the path the analyzed file is in (msg.AnalyzeResponse.Note.Location.GetPath()
 	// contains only the basename). HandleResponse can be called multiple times although the calls
 	// are not concurrent.
@@ -181,10 +193,41 @@ func (i *Invocation) startServices() (*client.Client, Paths, func(), error) {
 	return c, paths, cleanup, nil
 }
 
+// Run analyzes the files and returns the number of notes that are at least as severe
+// as the FailOn option.
 func (i *Invocation) Run() (int, error) {
-	var c *client.Client
-	var req *rpcpb.ShipshapeRequest
-	var numNotes int
+	// Select the changed files before starting any containers, so that
+	// there is nothing to start up when nothing changed.
+	sel := gitSelection{
+		diffBase: i.options.DiffBase,
+		staged:   i.options.Staged,
+		modified: i.options.Modified,
+	}
+	var files []string
+	if sel.enabled() {
+		fs, err := os.Stat(i.options.File)
+		if err != nil {
+			return 0, fmt.Errorf("%s is not a valid file or directory\n", i.options.File)
+		}
+		if !fs.IsDir() {
+			return 0, fmt.Errorf("git file selection requires a directory, but %s is a file", i.options.File)
+		}
+		files, err = gitFiles(i.options.File, sel)
+		if err != nil {
+			return 0, fmt.Errorf("could not get changed files from git: %v", err)
+		}
+		if len(files) == 0 {
+			// The service would treat an empty file list as the whole directory.
+			glog.Infof("No changed files in %s; nothing to analyze", i.options.File)
+			if i.options.ResponsesDone != nil {
+				if err := i.options.ResponsesDone(); err != nil {
+					return 0, err
+				}
+			}
+			return 0, nil
+		}
+		glog.Infof("Analyzing %d changed files", len(files))
+	}
 
 	// Run it on files
 	c, paths, cleanup, err := i.startServices()
@@ -192,16 +235,35 @@ func (i *Invocation) Run() (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	var files []string
+	numNotes, err := i.analyzeAll(c, paths, files)
+	// Write out what came in even if the analysis failed part way, so that the
+	// notes that were received are not lost.
+	if i.options.ResponsesDone != nil {
+		if doneErr := i.options.ResponsesDone(); doneErr != nil && err == nil {
+			err = doneErr
+		}
+	}
+	if err != nil {
+		return numNotes, err
+	}
+
+	glog.Infoln("End of Results.")
+	return numNotes, nil
+}
+
+// analyzeAll runs the analysis of the files with the service at c, and then, if the Build
+// option is set, the analysis of the compilation units that kythe produces for them. It
+// returns the number of notes that are at least as severe as the FailOn option.
+func (i *Invocation) analyzeAll(c *client.Client, paths Paths, files []string) (int, error) {
 	if !paths.fs.IsDir() {
 		files = []string{filepath.Base(i.options.File)}
 	}
 	if len(i.options.TriggerCats) == 0 {
 		glog.Infof("No categories provided. Will be using categories specified by the config file for the event %s", i.options.Event)
 	}
-	req = createRequest(i.options.TriggerCats, files, i.options.Event, filepath.Join(workspace, paths.relativeRoot), ctxpb.Stage_PRE_BUILD.Enum())
+	req := createRequest(i.options.TriggerCats, files, i.options.Event, filepath.Join(workspace, paths.relativeRoot), ctxpb.Stage_PRE_BUILD.Enum())
 	glog.Infof("Calling with request %v", req)
-	numNotes, err = analyze(c, req, paths.origDir, i.options.HandleResponse)
+	numNotes, err := analyze(c, req, paths.origDir, i.options.FailOn, i.options.HandleResponse)
 	if err != nil {
 		return numNotes, fmt.Errorf("error making service call: %v", err)
 	}
@@ -236,30 +298,15 @@ func (i *Invocation) Run() (int, error) {
 
 		req.Stage = ctxpb.Stage_POST_BUILD.Enum()
 		glog.Infof("Calling with request %v", req)
-		numBuildNotes, err := analyze(c, req, paths.origDir, i.options.HandleResponse)
+		numBuildNotes, err := analyze(c, req, paths.origDir, i.options.FailOn, i.options.HandleResponse)
 		numNotes += numBuildNotes
 		if err != nil {
 			return numNotes, fmt.Errorf("error making service call: %v", err)
 		}
 	}
-	if i.options.ResponsesDone != nil {
-		if err := i.options.ResponsesDone(); err != nil {
-			return numNotes, err
-		}
-	}
-
-	glog.Infoln("End of Results.")
 	return numNotes, nil
 }
 
-func numNotes(msg *rpcpb.ShipshapeResponse) int {
-	numNotes := 0
-	for _, analysis := range msg.AnalyzeResponse {
-		numNotes += len(analysis.Note)
-	}
-	return numNotes
-}
-
 // startShipshapeService ensures that there is a service started with the given image and
 // attached analyzers that can analyze the directory at absRoot (an absolute path). If a
 // service is not started up that can do this, it will shut down the existing one and start
@@ -308,7 +355,9 @@ func startShipshapeService(image, absRoot string, analyzers []string, dind bool)
 	return c, subPath, c.WaitUntilReady(10 * time.Second)
 }
 
-func analyze(c *client.Client, req *rpcpb.ShipshapeRequest, originalDir string, handleResponse func(msg *rpcpb.ShipshapeResponse, directory string) error) (int, error) {
+// analyze streams the results of req to handleResponse. It returns the number of notes
+// received that are at least as severe as failOn, including when the stream fails part way.
+func analyze(c *client.Client, req *rpcpb.ShipshapeRequest, originalDir string, failOn notepb.Note_Severity, handleResponse func(msg *rpcpb.ShipshapeResponse, directory string) error) (int, error) {
 	var totalNotes = 0
 	glog.Infof("Calling to the shipshape service with %v", req)
 	rd := c.Stream("/ShipshapeService/Run", req)
@@ -318,14 +367,14 @@ func analyze(c *client.Client, req *rpcpb.ShipshapeRequest, originalDir string,
 		if err := rd.NextResult(&msg); err == io.EOF {
 			break
 		} else if err != nil {
-			return 0, fmt.Errorf("received an error from calling run: %v", err.Error())
+			return totalNotes, fmt.Errorf("received an error from calling run: %v", err.Error())
 		}
 
 		err := handleResponse(&msg, originalDir)
 		if err != nil {
-			return 0, fmt.Errorf("could not parse results: %v", err.Error())
+			return totalNotes, fmt.Errorf("could not parse results: %v", err.Error())
 		}
-		totalNotes += numNotes(&msg)
+		totalNotes += numNotes(&msg, failOn)
 	}
 	return totalNotes, nil
 }
@@ -0,0 +1,209 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+	rpcpb "github.com/google/shipshape/shipshape/proto/shipshape_rpc_proto"
+)
+
+// ANSI escape codes for coloring the text output.
+const (
+	colorReset = "\x1b[0m"
+	colorBold  = "\x1b[1m"
+)
+
+// severityColors are the ANSI colors for the notes of each severity.
+var severityColors = map[notepb.Note_Severity]string{
+	notepb.Note_BUILD_ERROR: "\x1b[31m", // red
+	notepb.Note_WARNING:     "\x1b[33m", // yellow
+	notepb.Note_OTHER:       "\x1b[36m", // cyan
+}
+
+// TextOutput writes the results of an analysis as text. Its HandleResponse and Done
+// methods can be used as the HandleResponse and ResponsesDone options. Failures are
+// written as they come in. The notes are sorted by path, then line and column, and Done
+// writes a summary of them.
+//
+// The notes grouped under their file are written as each response comes in, so they are
+// only sorted within a response: a file can come up again in a later response, and the
+// order of the responses depends on which analyzer finishes first. With OneLine, the notes
+// are collected and written in Done instead, all sorted together, so that the output is
+// the same from run to run.
+type TextOutput struct {
+	Out io.Writer
+	// Color colors the notes by their severity with ANSI escape codes.
+	Color bool
+	// OneLine writes each note on a single line, in the compiler-style format
+	// "path:line:col: [Category:Subcategory] description" that editors can jump to.
+	// Otherwise, the notes are grouped under their file.
+	OneLine bool
+
+	// notes are the notes collected for OneLine.
+	notes []outputNote
+	// counts has the number of notes so far per category and severity.
+	counts map[string]severityCounts
+}
+
+// HandleResponse writes out the failures in msg, and either writes out its notes or, with
+// OneLine, collects them. The paths of the notes are relative to directory.
+func (t *TextOutput) HandleResponse(msg *rpcpb.ShipshapeResponse, directory string) error {
+	for _, analysis := range msg.AnalyzeResponse {
+		for _, failure := range analysis.Failure {
+			fmt.Fprintf(t.Out, "WARNING: Analyzer %s failed to run: %s\n", failure.GetCategory(), failure.GetFailureMessage())
+		}
+	}
+	notes := outputNotes(msg, directory)
+	if t.OneLine {
+		t.notes = append(t.notes, notes...)
+	} else {
+		sort.Stable(byPosition(notes))
+		t.writeGrouped(notes)
+	}
+	if t.counts == nil {
+		t.counts = make(map[string]severityCounts)
+	}
+	for _, n := range notes {
+		cat := n.note.GetCategory()
+		if t.counts[cat] == nil {
+			t.counts[cat] = make(severityCounts)
+		}
+		t.counts[cat][n.note.GetSeverity()]++
+	}
+	return nil
+}
+
+// Done writes out the notes collected for OneLine, sorted, and the summary of all the notes
+// so far.
+func (t *TextOutput) Done() error {
+	if t.OneLine {
+		sort.Stable(byPosition(t.notes))
+		t.writeLines(t.notes)
+		t.notes = nil
+	}
+	t.writeSummary()
+	return nil
+}
+
+func (t *TextOutput) writeLines(notes []outputNote) {
+	for _, n := range notes {
+		fmt.Fprintf(t.Out, "%s: %s %s\n", notePosition(n), t.tag(n.note), n.note.GetDescription())
+	}
+}
+
+func (t *TextOutput) writeGrouped(notes []outputNote) {
+	for i, n := range notes {
+		if i == 0 || n.path != notes[i-1].path {
+			if i > 0 {
+				fmt.Fprintln(t.Out)
+			}
+			if n.path != "" {
+				fmt.Fprintln(t.Out, t.bold(n.path))
+			} else {
+				fmt.Fprintln(t.Out, t.bold("Global"))
+			}
+		}
+		loc := ""
+		if r := lineRange(n.note); r != nil {
+			if r.GetStartColumn() > 0 {
+				loc = fmt.Sprintf("Line %d, Col %d ", r.GetStartLine(), r.GetStartColumn())
+			} else {
+				loc = fmt.Sprintf("Line %d ", r.GetStartLine())
+			}
+		}
+		fmt.Fprintf(t.Out, "%s%s\n", loc, t.tag(n.note))
+		fmt.Fprintf(t.Out, "\t%s\n", n.note.GetDescription())
+	}
+	if len(notes) > 0 {
+		fmt.Fprintln(t.Out)
+	}
+}
+
+// writeSummary writes the number of notes per category and severity.
+func (t *TextOutput) writeSummary() {
+	if len(t.counts) == 0 {
+		fmt.Fprintln(t.Out, "No notes found.")
+		return
+	}
+	var cats []string
+	total := make(severityCounts)
+	for cat, counts := range t.counts {
+		cats = append(cats, cat)
+		for severity, n := range counts {
+			total[severity] += n
+		}
+	}
+	sort.Strings(cats)
+
+	fmt.Fprintln(t.Out, t.bold("Summary:"))
+	for _, cat := range cats {
+		fmt.Fprintf(t.Out, "  %s: %s\n", cat, t.describe(t.counts[cat]))
+	}
+	fmt.Fprintf(t.Out, "Total: %s\n", t.describe(total))
+}
+
+// severityCounts counts notes by their severity.
+type severityCounts map[notepb.Note_Severity]int
+
+// describe describes the counts, such as "3 notes (1 BUILD_ERROR, 2 WARNING)", from the
+// most to the least severe.
+func (t *TextOutput) describe(c severityCounts) string {
+	n := 0
+	details := ""
+	for _, severity := range []notepb.Note_Severity{notepb.Note_BUILD_ERROR, notepb.Note_WARNING, notepb.Note_OTHER} {
+		if c[severity] == 0 {
+			continue
+		}
+		n += c[severity]
+		if details != "" {
+			details += ", "
+		}
+		details += t.colored(severity, fmt.Sprintf("%d %s", c[severity], severity))
+	}
+	noun := "notes"
+	if n == 1 {
+		noun = "note"
+	}
+	return fmt.Sprintf("%d %s (%s)", n, noun, details)
+}
+
+// tag returns the "[Category:Subcategory]" tag for the note.
+func (t *TextOutput) tag(note *notepb.Note) string {
+	subCat := ""
+	if note.Subcategory != nil {
+		subCat = ":" + note.GetSubcategory()
+	}
+	return t.colored(note.GetSeverity(), fmt.Sprintf("[%s%s]", note.GetCategory(), subCat))
+}
+
+func (t *TextOutput) colored(severity notepb.Note_Severity, s string) string {
+	if !t.Color {
+		return s
+	}
+	return severityColors[severity] + s + colorReset
+}
+
+func (t *TextOutput) bold(s string) string {
+	if !t.Color {
+		return s
+	}
+	return colorBold + s + colorReset
+}
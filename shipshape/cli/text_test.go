@@ -0,0 +1,191 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+	rpcpb "github.com/google/shipshape/shipshape/proto/shipshape_rpc_proto"
+	rangepb "github.com/google/shipshape/shipshape/proto/textrange_proto"
+)
+
+func textNoteAt(cat, path string, line, col int32, severity notepb.Note_Severity, desc string) *notepb.Note {
+	note := &notepb.Note{
+		Category:    proto.String(cat),
+		Description: proto.String(desc),
+		Severity:    severity.Enum(),
+		Location:    &notepb.Location{},
+	}
+	if path != "" {
+		note.Location.Path = proto.String(path)
+	}
+	if line > 0 {
+		note.Location.Range = &rangepb.TextRange{StartLine: proto.Int32(line)}
+		if col > 0 {
+			note.Location.Range.StartColumn = proto.Int32(col)
+		}
+	}
+	return note
+}
+
+// textResponses are two streamed responses whose notes are out of order within each response.
+var textResponses = []*rpcpb.ShipshapeResponse{
+	{
+		AnalyzeResponse: []*rpcpb.AnalyzeResponse{{
+			Note: []*notepb.Note{
+				textNoteAt("PyLint", "b.py", 10, 0, notepb.Note_WARNING, "Unused import"),
+				textNoteAt("PyLint", "a.py", 3, 0, notepb.Note_WARNING, "Bad indent"),
+			},
+			Failure: []*rpcpb.AnalysisFailure{
+				{Category: proto.String("JSHint"), FailureMessage: proto.String("jshint not found")},
+			},
+		}},
+	},
+	{
+		AnalyzeResponse: []*rpcpb.AnalyzeResponse{{
+			Note: []*notepb.Note{
+				textNoteAt("go vet", "a.py", 1, 5, notepb.Note_BUILD_ERROR, "Odd"),
+				textNoteAt("WordCount", "", 0, 0, notepb.Note_OTHER, "42 words"),
+				textNoteAt("PyLint", "b.py", 2, 7, notepb.Note_WARNING, "Too long"),
+				textNoteAt("PyLint", "b.py", 0, 0, notepb.Note_WARNING, "Missing docstring"),
+			},
+		}},
+	},
+}
+
+func TestTextOutput(t *testing.T) {
+	tests := []struct {
+		label  string
+		output TextOutput
+		// streamed is whether the notes are written before Done.
+		streamed bool
+		expect   string
+	}{
+		{
+			"Grouped",
+			TextOutput{},
+			true,
+			`WARNING: Analyzer JSHint failed to run: jshint not found
+dir/a.py
+Line 3 [PyLint]
+	Bad indent
+
+dir/b.py
+Line 10 [PyLint]
+	Unused import
+
+Global
+[WordCount]
+	42 words
+
+dir/a.py
+Line 1, Col 5 [go vet]
+	Odd
+
+dir/b.py
+[PyLint]
+	Missing docstring
+Line 2, Col 7 [PyLint]
+	Too long
+
+Summary:
+  PyLint: 4 notes (4 WARNING)
+  WordCount: 1 note (1 OTHER)
+  go vet: 1 note (1 BUILD_ERROR)
+Total: 6 notes (1 BUILD_ERROR, 4 WARNING, 1 OTHER)
+`,
+		},
+		{
+			"One line",
+			TextOutput{OneLine: true},
+			false,
+			`WARNING: Analyzer JSHint failed to run: jshint not found
+Global: [WordCount] 42 words
+dir/a.py:1:5: [go vet] Odd
+dir/a.py:3: [PyLint] Bad indent
+dir/b.py: [PyLint] Missing docstring
+dir/b.py:2:7: [PyLint] Too long
+dir/b.py:10: [PyLint] Unused import
+Summary:
+  PyLint: 4 notes (4 WARNING)
+  WordCount: 1 note (1 OTHER)
+  go vet: 1 note (1 BUILD_ERROR)
+Total: 6 notes (1 BUILD_ERROR, 4 WARNING, 1 OTHER)
+`,
+		},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		out := test.output
+		out.Out = &buf
+		for _, msg := range textResponses {
+			if err := out.HandleResponse(msg, "dir"); err != nil {
+				t.Fatalf("%s: HandleResponse failed: %v", test.label, err)
+			}
+		}
+		// Failures are always written as the responses come in, but only streamed notes are.
+		expectWritten := "WARNING: Analyzer JSHint failed to run: jshint not found\n"
+		if test.streamed {
+			expectWritten = test.expect[:strings.Index(test.expect, "Summary:")]
+		}
+		if written := buf.String(); written != expectWritten {
+			t.Errorf("%s: incorrect output before Done:\n got %q\nwant %q", test.label, written, expectWritten)
+		}
+		if err := out.Done(); err != nil {
+			t.Fatalf("%s: Done failed: %v", test.label, err)
+		}
+		if got := buf.String(); got != test.expect {
+			t.Errorf("%s: incorrect output:\n got %q\nwant %q", test.label, got, test.expect)
+		}
+	}
+}
+
+func TestTextOutputColor(t *testing.T) {
+	var buf bytes.Buffer
+	out := TextOutput{Out: &buf, Color: true, OneLine: true}
+	msg := &rpcpb.ShipshapeResponse{
+		AnalyzeResponse: []*rpcpb.AnalyzeResponse{{
+			Note: []*notepb.Note{textNoteAt("go vet", "a.go", 1, 0, notepb.Note_BUILD_ERROR, "Odd")},
+		}},
+	}
+	out.HandleResponse(msg, "")
+	out.Done()
+
+	expect := "a.go:1: \x1b[31m[go vet]\x1b[0m Odd\n" +
+		"\x1b[1mSummary:\x1b[0m\n" +
+		"  go vet: 1 note (\x1b[31m1 BUILD_ERROR\x1b[0m)\n" +
+		"Total: 1 note (\x1b[31m1 BUILD_ERROR\x1b[0m)\n"
+	if got := buf.String(); got != expect {
+		t.Errorf("Incorrect output:\n got %q\nwant %q", got, expect)
+	}
+}
+
+func TestTextOutputNoNotes(t *testing.T) {
+	var buf bytes.Buffer
+	out := TextOutput{Out: &buf}
+	out.HandleResponse(&rpcpb.ShipshapeResponse{}, "")
+	out.Done()
+	if got, expect := buf.String(), "No notes found.\n"; got != expect {
+		t.Errorf("Incorrect output: got %q, want %q", got, expect)
+	}
+}
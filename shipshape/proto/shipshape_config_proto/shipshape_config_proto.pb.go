@@ -10,7 +10,11 @@ It is generated from these files:
 
 It has these top-level messages:
 	GlobalConfig
+	TimeoutConfig
+	CategoryOptions
+	SeverityConfig
 	EventConfig
+	PathConfig
 	ShipshapeConfig
 */
 package shipshape_config_proto_go_src
@@ -30,12 +34,24 @@ type GlobalConfig struct {
 	// For example,
 	// gcr.io/shipshape_releases/android_lint:prod
 	Images []string `protobuf:"bytes,1,rep,name=images" json:"images,omitempty"`
-	// A list of subtrees to ignore when running analysis. Each entry in the list
-	// is a directory, relative to the repository root.
-	// TODO(collinwinter): add support for file=.gitignore syntax to avoid
-	// duplication between multiple systems.
-	Ignore           []string `protobuf:"bytes,2,rep,name=ignore" json:"ignore,omitempty"`
-	XXX_unrecognized []byte   `json:"-"`
+	// A list of files to ignore when running analysis. Each entry is a
+	// gitignore-style pattern, relative to the repository root: "third_party/"
+	// ignores a top-level directory, "**/*.pb.go" ignores generated files
+	// anywhere, and "!keep.go" re-includes a file ignored by an earlier entry.
+	// Unlike in a .gitignore file, patterns are always anchored at the root.
+	// An entry of the form "file=.gitignore" imports the patterns from that
+	// gitignore file, with their usual gitignore meaning.
+	Ignore []string `protobuf:"bytes,2,rep,name=ignore" json:"ignore,omitempty"`
+	// How long to wait for analyzers before giving up on them. An entry without
+	// a category sets the timeout for every category that does not have its own.
+	Timeouts []*TimeoutConfig `protobuf:"bytes,3,rep,name=timeouts" json:"timeouts,omitempty"`
+	// Settings for the analyzers, by category. The settings for a category are
+	// sent along with every request to the analyzer that provides it.
+	Options []*CategoryOptions `protobuf:"bytes,4,rep,name=options" json:"options,omitempty"`
+	// Severities for the notes in some categories, replacing the ones that the
+	// analyzers give them.
+	Severities       []*SeverityConfig `protobuf:"bytes,5,rep,name=severities" json:"severities,omitempty"`
+	XXX_unrecognized []byte            `json:"-"`
 }
 
 func (m *GlobalConfig) Reset()         { *m = GlobalConfig{} }
@@ -56,6 +72,114 @@ func (m *GlobalConfig) GetIgnore() []string {
 	return nil
 }
 
+func (m *GlobalConfig) GetTimeouts() []*TimeoutConfig {
+	if m != nil {
+		return m.Timeouts
+	}
+	return nil
+}
+
+func (m *GlobalConfig) GetOptions() []*CategoryOptions {
+	if m != nil {
+		return m.Options
+	}
+	return nil
+}
+
+func (m *GlobalConfig) GetSeverities() []*SeverityConfig {
+	if m != nil {
+		return m.Severities
+	}
+	return nil
+}
+
+// Configures how long to wait for the analyzer providing a category.
+type TimeoutConfig struct {
+	// The category this timeout applies to. If unset, the timeout applies to all
+	// categories that are not otherwise configured.
+	Category *string `protobuf:"bytes,1,opt,name=category" json:"category,omitempty"`
+	// The number of seconds to wait for results before the analysis is
+	// abandoned and reported as a failure. Must be positive.
+	Seconds          *int32 `protobuf:"varint,2,opt,name=seconds" json:"seconds,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *TimeoutConfig) Reset()         { *m = TimeoutConfig{} }
+func (m *TimeoutConfig) String() string { return proto.CompactTextString(m) }
+func (*TimeoutConfig) ProtoMessage()    {}
+
+func (m *TimeoutConfig) GetCategory() string {
+	if m != nil && m.Category != nil {
+		return *m.Category
+	}
+	return ""
+}
+
+func (m *TimeoutConfig) GetSeconds() int32 {
+	if m != nil && m.Seconds != nil {
+		return *m.Seconds
+	}
+	return 0
+}
+
+// Configures the analyzer providing a category.
+type CategoryOptions struct {
+	// The category these settings are for.
+	Category *string `protobuf:"bytes,1,opt,name=category" json:"category,omitempty"`
+	// Settings of the form "name=value", such as "rcfile=tools/pylintrc" for
+	// PyLint. Each analyzer documents the settings it understands. Paths are
+	// relative to the repository root.
+	Settings         []string `protobuf:"bytes,2,rep,name=settings" json:"settings,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *CategoryOptions) Reset()         { *m = CategoryOptions{} }
+func (m *CategoryOptions) String() string { return proto.CompactTextString(m) }
+func (*CategoryOptions) ProtoMessage()    {}
+
+func (m *CategoryOptions) GetCategory() string {
+	if m != nil && m.Category != nil {
+		return *m.Category
+	}
+	return ""
+}
+
+func (m *CategoryOptions) GetSettings() []string {
+	if m != nil {
+		return m.Settings
+	}
+	return nil
+}
+
+// Overrides the severity of the notes in a category.
+type SeverityConfig struct {
+	// The category whose notes get the severity.
+	Category *string `protobuf:"bytes,1,opt,name=category" json:"category,omitempty"`
+	// The severity for the notes: one of BUILD_ERROR, WARNING or OTHER. For
+	// example, use OTHER for informational categories, so that they do not fail
+	// a run of the command line tool with --fail_on=WARNING.
+	Severity         *string `protobuf:"bytes,2,opt,name=severity" json:"severity,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *SeverityConfig) Reset()         { *m = SeverityConfig{} }
+func (m *SeverityConfig) String() string { return proto.CompactTextString(m) }
+func (*SeverityConfig) ProtoMessage()    {}
+
+func (m *SeverityConfig) GetCategory() string {
+	if m != nil && m.Category != nil {
+		return *m.Category
+	}
+	return ""
+}
+
+func (m *SeverityConfig) GetSeverity() string {
+	if m != nil && m.Severity != nil {
+		return *m.Severity
+	}
+	return ""
+}
+
 type EventConfig struct {
 	// Defines points in a development workflow when one may want to run analyses
 	// Pre-defined values used by Leeroy might include "Commit", "Review", and "Deploy".
@@ -90,11 +214,56 @@ func (m *EventConfig) GetCategories() []string {
 	return nil
 }
 
+// Changes which categories run on part of the repository.
+type PathConfig struct {
+	// The files this rule applies to, as a pattern in the syntax of the ignore
+	// list, relative to the directory of the .shipshape file. For example,
+	// "tools/" or "**/*_test.py".
+	Path *string `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	// Categories to run on the matching files in addition to the ones configured
+	// for the event. Ignored when the categories to run are given explicitly.
+	Enable []string `protobuf:"bytes,2,rep,name=enable" json:"enable,omitempty"`
+	// Categories not to run on the matching files.
+	Disable          []string `protobuf:"bytes,3,rep,name=disable" json:"disable,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *PathConfig) Reset()         { *m = PathConfig{} }
+func (m *PathConfig) String() string { return proto.CompactTextString(m) }
+func (*PathConfig) ProtoMessage()    {}
+
+func (m *PathConfig) GetPath() string {
+	if m != nil && m.Path != nil {
+		return *m.Path
+	}
+	return ""
+}
+
+func (m *PathConfig) GetEnable() []string {
+	if m != nil {
+		return m.Enable
+	}
+	return nil
+}
+
+func (m *PathConfig) GetDisable() []string {
+	if m != nil {
+		return m.Disable
+	}
+	return nil
+}
+
 // Represents the Shipshape configuration.
+// A .shipshape file in a subdirectory of the repository configures the files
+// below it. Its events replace the categories configured by the .shipshape
+// files above it, and its path rules apply after theirs. Only the .shipshape
+// file at the repository root may have a global section.
 type ShipshapeConfig struct {
-	Global           *GlobalConfig  `protobuf:"bytes,1,opt,name=global" json:"global,omitempty"`
-	Events           []*EventConfig `protobuf:"bytes,2,rep,name=events" json:"events,omitempty"`
-	XXX_unrecognized []byte         `json:"-"`
+	Global *GlobalConfig  `protobuf:"bytes,1,opt,name=global" json:"global,omitempty"`
+	Events []*EventConfig `protobuf:"bytes,2,rep,name=events" json:"events,omitempty"`
+	// Rules that apply in order, so later rules override earlier ones.
+	Paths            []*PathConfig `protobuf:"bytes,3,rep,name=paths" json:"paths,omitempty"`
+	XXX_unrecognized []byte        `json:"-"`
 }
 
 func (m *ShipshapeConfig) Reset()         { *m = ShipshapeConfig{} }
@@ -115,5 +284,12 @@ func (m *ShipshapeConfig) GetEvents() []*EventConfig {
 	return nil
 }
 
+func (m *ShipshapeConfig) GetPaths() []*PathConfig {
+	if m != nil {
+		return m.Paths
+	}
+	return nil
+}
+
 func init() {
 }
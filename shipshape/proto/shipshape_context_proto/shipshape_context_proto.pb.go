@@ -18,6 +18,7 @@ package shipshape_context_proto_go_src
 import proto "github.com/golang/protobuf/proto"
 import math "math"
 import source_v1 "github.com/google/shipshape/shipshape/proto/source_context_proto"
+import kythe_proto "github.com/google/shipshape/third_party/kythe/proto/analysis_proto"
 
 // Reference imports to suppress errors if they are not otherwise used.
 var _ = proto.Marshal
@@ -180,9 +181,16 @@ type ChangelistDetails struct {
 	ChangelistCc          []string `protobuf:"bytes,4,rep,name=changelist_cc" json:"changelist_cc,omitempty"`
 	ChangelistDescription *string  `protobuf:"bytes,5,opt,name=changelist_description" json:"changelist_description,omitempty"`
 	// List of files that are deleted in the changelist.
-	DeletedFilePath  []string `protobuf:"bytes,6,rep,name=deleted_file_path" json:"deleted_file_path,omitempty"`
-	ClientName       *string  `protobuf:"bytes,7,opt,name=client_name" json:"client_name,omitempty"`
-	XXX_unrecognized []byte   `json:"-"`
+	DeletedFilePath []string `protobuf:"bytes,6,rep,name=deleted_file_path" json:"deleted_file_path,omitempty"`
+	ClientName      *string  `protobuf:"bytes,7,opt,name=client_name" json:"client_name,omitempty"`
+	// The change as a unified diff against the base of the changelist, with
+	// paths relative to the repo root. Used to find the lines that the
+	// changelist touched.
+	Diff *string `protobuf:"bytes,8,opt,name=diff" json:"diff,omitempty"`
+	// The revision that the changelist is based on. If no diff is given, the
+	// changed lines are found by diffing the repo root against this revision.
+	BaseRevision     *string `protobuf:"bytes,9,opt,name=base_revision" json:"base_revision,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
 }
 
 func (m *ChangelistDetails) Reset()         { *m = ChangelistDetails{} }
@@ -238,11 +246,25 @@ func (m *ChangelistDetails) GetClientName() string {
 	return ""
 }
 
+func (m *ChangelistDetails) GetDiff() string {
+	if m != nil && m.Diff != nil {
+		return *m.Diff
+	}
+	return ""
+}
+
+func (m *ChangelistDetails) GetBaseRevision() string {
+	if m != nil && m.BaseRevision != nil {
+		return *m.BaseRevision
+	}
+	return ""
+}
+
 // Provides information about a specific compilation
 type CompilationDetails struct {
 	// Set when running compiler based analysis; compilation_details describes
 	// a single invocation of a compiler.
-	// optional kythe.proto.CompilationUnit compilation_unit = 1;
+	CompilationUnit *kythe_proto.CompilationUnit `protobuf:"bytes,1,opt,name=compilation_unit" json:"compilation_unit,omitempty"`
 	// The local path to a compilation description file (.kindex)
 	// that this compilation unit came from.
 	CompilationDescriptionPath *string `protobuf:"bytes,2,opt,name=compilation_description_path" json:"compilation_description_path,omitempty"`
@@ -253,6 +275,13 @@ func (m *CompilationDetails) Reset()         { *m = CompilationDetails{} }
 func (m *CompilationDetails) String() string { return proto.CompactTextString(m) }
 func (*CompilationDetails) ProtoMessage()    {}
 
+func (m *CompilationDetails) GetCompilationUnit() *kythe_proto.CompilationUnit {
+	if m != nil {
+		return m.CompilationUnit
+	}
+	return nil
+}
+
 func (m *CompilationDetails) GetCompilationDescriptionPath() string {
 	if m != nil && m.CompilationDescriptionPath != nil {
 		return *m.CompilationDescriptionPath
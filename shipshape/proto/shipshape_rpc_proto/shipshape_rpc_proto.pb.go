@@ -24,12 +24,55 @@ package shipshape_rpc_proto_go_src
 import proto "github.com/golang/protobuf/proto"
 import math "math"
 import shipshape_proto1 "github.com/google/shipshape/shipshape/proto/note_proto"
-import shipshape_proto2 "github.com/google/shipshape/shipshape/proto/shipshape_context_proto"
+import shipshape_proto2 "github.com/google/shipshape/shipshape/proto/shipshape_config_proto"
+import shipshape_proto3 "github.com/google/shipshape/shipshape/proto/shipshape_context_proto"
 
 // Reference imports to suppress errors if they are not otherwise used.
 var _ = proto.Marshal
 var _ = math.Inf
 
+// What to do with notes on lines that the changelist in the context did not
+// touch.
+type ShipshapeRequest_ChangedLinesMode int32
+
+const (
+	// Keep all notes.
+	ShipshapeRequest_ALL_LINES ShipshapeRequest_ChangedLinesMode = 1
+	// Drop notes outside of the changed lines.
+	ShipshapeRequest_DROP_UNCHANGED ShipshapeRequest_ChangedLinesMode = 2
+	// Keep notes outside of the changed lines, but lower their severity to
+	// OTHER.
+	ShipshapeRequest_DEMOTE_UNCHANGED ShipshapeRequest_ChangedLinesMode = 3
+)
+
+var ShipshapeRequest_ChangedLinesMode_name = map[int32]string{
+	1: "ALL_LINES",
+	2: "DROP_UNCHANGED",
+	3: "DEMOTE_UNCHANGED",
+}
+var ShipshapeRequest_ChangedLinesMode_value = map[string]int32{
+	"ALL_LINES":        1,
+	"DROP_UNCHANGED":   2,
+	"DEMOTE_UNCHANGED": 3,
+}
+
+func (x ShipshapeRequest_ChangedLinesMode) Enum() *ShipshapeRequest_ChangedLinesMode {
+	p := new(ShipshapeRequest_ChangedLinesMode)
+	*p = x
+	return p
+}
+func (x ShipshapeRequest_ChangedLinesMode) String() string {
+	return proto.EnumName(ShipshapeRequest_ChangedLinesMode_name, int32(x))
+}
+func (x *ShipshapeRequest_ChangedLinesMode) UnmarshalJSON(data []byte) error {
+	value, err := proto.UnmarshalJSONEnum(ShipshapeRequest_ChangedLinesMode_value, data, "ShipshapeRequest_ChangedLinesMode")
+	if err != nil {
+		return err
+	}
+	*x = ShipshapeRequest_ChangedLinesMode(value)
+	return nil
+}
+
 type GetCategoryRequest struct {
 	XXX_unrecognized []byte `json:"-"`
 }
@@ -71,7 +114,7 @@ func (*GetStageRequest) ProtoMessage()    {}
 
 // Tells the environment what stage the analyzer can run in.
 type GetStageResponse struct {
-	Stage            *shipshape_proto2.Stage `protobuf:"varint,1,opt,name=stage,enum=shipshape_proto.Stage" json:"stage,omitempty"`
+	Stage            *shipshape_proto3.Stage `protobuf:"varint,1,opt,name=stage,enum=shipshape_proto.Stage" json:"stage,omitempty"`
 	XXX_unrecognized []byte                  `json:"-"`
 }
 
@@ -79,25 +122,32 @@ func (m *GetStageResponse) Reset()         { *m = GetStageResponse{} }
 func (m *GetStageResponse) String() string { return proto.CompactTextString(m) }
 func (*GetStageResponse) ProtoMessage()    {}
 
-func (m *GetStageResponse) GetStage() shipshape_proto2.Stage {
+func (m *GetStageResponse) GetStage() shipshape_proto3.Stage {
 	if m != nil && m.Stage != nil {
 		return *m.Stage
 	}
-	return shipshape_proto2.Stage_PRE_BUILD
+	return shipshape_proto3.Stage_PRE_BUILD
 }
 
 // Provides information to an analyzer to perform its analysis.
 type AnalyzeRequest struct {
-	ShipshapeContext *shipshape_proto2.ShipshapeContext `protobuf:"bytes,1,opt,name=shipshape_context" json:"shipshape_context,omitempty"`
+	ShipshapeContext *shipshape_proto3.ShipshapeContext `protobuf:"bytes,1,opt,name=shipshape_context" json:"shipshape_context,omitempty"`
 	Category         []string                           `protobuf:"bytes,2,rep,name=category" json:"category,omitempty"`
-	XXX_unrecognized []byte                             `json:"-"`
+	// The settings from the Shipshape config for the requested categories. A
+	// category without settings is left out.
+	Options []*shipshape_proto2.CategoryOptions `protobuf:"bytes,3,rep,name=options" json:"options,omitempty"`
+	// How long each requested category may take. The analyzer service stops
+	// waiting for a category once its timeout passes, and reports it as a
+	// failure. A category without a timeout is not limited by the service.
+	Timeout          []*shipshape_proto2.TimeoutConfig `protobuf:"bytes,4,rep,name=timeout" json:"timeout,omitempty"`
+	XXX_unrecognized []byte                            `json:"-"`
 }
 
 func (m *AnalyzeRequest) Reset()         { *m = AnalyzeRequest{} }
 func (m *AnalyzeRequest) String() string { return proto.CompactTextString(m) }
 func (*AnalyzeRequest) ProtoMessage()    {}
 
-func (m *AnalyzeRequest) GetShipshapeContext() *shipshape_proto2.ShipshapeContext {
+func (m *AnalyzeRequest) GetShipshapeContext() *shipshape_proto3.ShipshapeContext {
 	if m != nil {
 		return m.ShipshapeContext
 	}
@@ -111,9 +161,26 @@ func (m *AnalyzeRequest) GetCategory() []string {
 	return nil
 }
 
+func (m *AnalyzeRequest) GetOptions() []*shipshape_proto2.CategoryOptions {
+	if m != nil {
+		return m.Options
+	}
+	return nil
+}
+
+func (m *AnalyzeRequest) GetTimeout() []*shipshape_proto2.TimeoutConfig {
+	if m != nil {
+		return m.Timeout
+	}
+	return nil
+}
+
 type AnalysisFailure struct {
-	Category         *string `protobuf:"bytes,1,opt,name=category" json:"category,omitempty"`
-	FailureMessage   *string `protobuf:"bytes,2,opt,name=failure_message" json:"failure_message,omitempty"`
+	Category       *string `protobuf:"bytes,1,opt,name=category" json:"category,omitempty"`
+	FailureMessage *string `protobuf:"bytes,2,opt,name=failure_message" json:"failure_message,omitempty"`
+	// The path of the file that could not be analyzed, relative to the
+	// repo root. Only set if the failure is specific to a single file.
+	FilePath         *string `protobuf:"bytes,3,opt,name=file_path" json:"file_path,omitempty"`
 	XXX_unrecognized []byte  `json:"-"`
 }
 
@@ -135,6 +202,13 @@ func (m *AnalysisFailure) GetFailureMessage() string {
 	return ""
 }
 
+func (m *AnalysisFailure) GetFilePath() string {
+	if m != nil && m.FilePath != nil {
+		return *m.FilePath
+	}
+	return ""
+}
+
 // Describes the results of an analysis, whether complete or failed.
 // If an analysis run completes successfully but produces no notes,
 // just return an empty list.
@@ -166,22 +240,28 @@ func (m *AnalyzeResponse) GetFailure() []*AnalysisFailure {
 
 type ShipshapeRequest struct {
 	// The ShipshapeContext to use for this run
-	ShipshapeContext *shipshape_proto2.ShipshapeContext `protobuf:"bytes,1,opt,name=shipshape_context" json:"shipshape_context,omitempty"`
+	ShipshapeContext *shipshape_proto3.ShipshapeContext `protobuf:"bytes,1,opt,name=shipshape_context" json:"shipshape_context,omitempty"`
 	// Explicitly triggered categories. If empty will run what is in config files.
 	// Will only run the triggered categories.
 	TriggeredCategory []string `protobuf:"bytes,2,rep,name=triggered_category" json:"triggered_category,omitempty"`
 	// The event we are running for
 	Event *string `protobuf:"bytes,3,opt,name=event" json:"event,omitempty"`
 	// Which stage to run
-	Stage            *shipshape_proto2.Stage `protobuf:"varint,4,opt,name=stage,enum=shipshape_proto.Stage" json:"stage,omitempty"`
-	XXX_unrecognized []byte                  `json:"-"`
+	Stage *shipshape_proto3.Stage `protobuf:"varint,4,opt,name=stage,enum=shipshape_proto.Stage" json:"stage,omitempty"`
+	// How long to wait for the analyzers of specific categories. These take
+	// precedence over the timeouts in the config files.
+	AnalyzerTimeout  []*shipshape_proto2.TimeoutConfig  `protobuf:"bytes,5,rep,name=analyzer_timeout" json:"analyzer_timeout,omitempty"`
+	ChangedLinesMode *ShipshapeRequest_ChangedLinesMode `protobuf:"varint,6,opt,name=changed_lines_mode,enum=shipshape_proto.ShipshapeRequest_ChangedLinesMode,def=1" json:"changed_lines_mode,omitempty"`
+	XXX_unrecognized []byte                             `json:"-"`
 }
 
 func (m *ShipshapeRequest) Reset()         { *m = ShipshapeRequest{} }
 func (m *ShipshapeRequest) String() string { return proto.CompactTextString(m) }
 func (*ShipshapeRequest) ProtoMessage()    {}
 
-func (m *ShipshapeRequest) GetShipshapeContext() *shipshape_proto2.ShipshapeContext {
+const Default_ShipshapeRequest_ChangedLinesMode ShipshapeRequest_ChangedLinesMode = ShipshapeRequest_ALL_LINES
+
+func (m *ShipshapeRequest) GetShipshapeContext() *shipshape_proto3.ShipshapeContext {
 	if m != nil {
 		return m.ShipshapeContext
 	}
@@ -202,11 +282,25 @@ func (m *ShipshapeRequest) GetEvent() string {
 	return ""
 }
 
-func (m *ShipshapeRequest) GetStage() shipshape_proto2.Stage {
+func (m *ShipshapeRequest) GetStage() shipshape_proto3.Stage {
 	if m != nil && m.Stage != nil {
 		return *m.Stage
 	}
-	return shipshape_proto2.Stage_PRE_BUILD
+	return shipshape_proto3.Stage_PRE_BUILD
+}
+
+func (m *ShipshapeRequest) GetAnalyzerTimeout() []*shipshape_proto2.TimeoutConfig {
+	if m != nil {
+		return m.AnalyzerTimeout
+	}
+	return nil
+}
+
+func (m *ShipshapeRequest) GetChangedLinesMode() ShipshapeRequest_ChangedLinesMode {
+	if m != nil && m.ChangedLinesMode != nil {
+		return *m.ChangedLinesMode
+	}
+	return Default_ShipshapeRequest_ChangedLinesMode
 }
 
 type ShipshapeResponse struct {
@@ -226,4 +320,5 @@ func (m *ShipshapeResponse) GetAnalyzeResponse() []*AnalyzeResponse {
 }
 
 func init() {
+	proto.RegisterEnum("shipshape_proto.ShipshapeRequest_ChangedLinesMode", ShipshapeRequest_ChangedLinesMode_name, ShipshapeRequest_ChangedLinesMode_value)
 }
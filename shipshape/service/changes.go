@@ -0,0 +1,282 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	strset "github.com/google/shipshape/shipshape/util/strings"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+	contextpb "github.com/google/shipshape/shipshape/proto/shipshape_context_proto"
+	rpcpb "github.com/google/shipshape/shipshape/proto/shipshape_rpc_proto"
+)
+
+// lineRange is an inclusive range of line numbers, starting from 1.
+type lineRange struct {
+	start, end int32
+}
+
+// changedLines records which lines of each file a changelist touched, and what to do with
+// notes outside of them.
+type changedLines struct {
+	mode rpcpb.ShipshapeRequest_ChangedLinesMode
+	// lines maps each changed file to the sorted ranges of lines that were added or modified.
+	lines map[string][]lineRange
+	// whole is the set of files that are new in their entirety.
+	whole strset.Set
+	// deleted is the set of files that the changelist deletes.
+	deleted strset.Set
+}
+
+// findChangedLines computes the lines touched by the changelist in details, using its diff if
+// there is one, and otherwise by diffing the repo at root against its base revision. It returns
+// nil if mode keeps all notes, in which case nothing needs to be computed.
+func findChangedLines(root string, details *contextpb.ChangelistDetails, mode rpcpb.ShipshapeRequest_ChangedLinesMode) (*changedLines, error) {
+	if mode == rpcpb.ShipshapeRequest_ALL_LINES {
+		return nil, nil
+	}
+	changes := &changedLines{mode: mode, whole: strset.New()}
+	var err error
+	switch {
+	case details.GetDiff() != "":
+		changes.lines, changes.deleted, err = parseDiff(details.GetDiff())
+		if err != nil {
+			return nil, err
+		}
+	case details.GetBaseRevision() != "":
+		// The revision comes from the request, and git would take one starting with "-",
+		// such as --output=<file>, as an option.
+		if strings.HasPrefix(details.GetBaseRevision(), "-") {
+			return nil, fmt.Errorf("invalid base revision %q", details.GetBaseRevision())
+		}
+		// root may be a subdirectory of the checkout. --relative makes the paths relative
+		// to it, like the note paths and the ls-files output below.
+		out, err := runGit(root, "diff", "--no-color", "--no-ext-diff", "--unified=0", "--relative", details.GetBaseRevision(), "--")
+		if err != nil {
+			return nil, err
+		}
+		changes.lines, changes.deleted, err = parseDiff(out)
+		if err != nil {
+			return nil, err
+		}
+		// Files that git does not know about yet are not in the diff, but are entirely new.
+		out, err = runGit(root, "ls-files", "--others", "--exclude-standard")
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range strings.Split(out, "\n") {
+			if path != "" {
+				changes.whole.Add(path)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("changed lines mode %v requires a diff or base revision in the changelist details", mode)
+	}
+	return changes, nil
+}
+
+// runGit runs git with the given arguments in dir and returns its output.
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("git %s failed: %v: %s", strings.Join(args, " "), err, exitErr.Stderr)
+		}
+		return "", fmt.Errorf("git %s failed: %v", strings.Join(args, " "), err)
+	}
+	return string(out), nil
+}
+
+// parseDiff reads a unified diff and returns the ranges of lines that were added or modified in
+// each file that still exists after the change, as numbered in the new version of the file,
+// along with the files that the diff deletes. The "a/" and "b/" prefixes that git adds to paths
+// are removed.
+func parseDiff(diff string) (map[string][]lineRange, strset.Set, error) {
+	changed := make(map[string][]int32)
+	deleted := strset.New()
+	var oldPath, path string
+	// The number of old and new lines left in the current hunk, and the next new line number.
+	var oldLeft, newLeft, line int32
+
+	scanner := bufio.NewScanner(strings.NewReader(diff))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if oldLeft > 0 || newLeft > 0 {
+			switch {
+			case strings.HasPrefix(text, "+"):
+				changed[path] = append(changed[path], line)
+				line++
+				newLeft--
+			case strings.HasPrefix(text, "-"):
+				oldLeft--
+			case strings.HasPrefix(text, " "), text == "":
+				line++
+				oldLeft--
+				newLeft--
+			case strings.HasPrefix(text, `\`):
+				// "\ No newline at end of file"
+			default:
+				return nil, nil, fmt.Errorf("malformed diff: unexpected line %q in hunk for %s", text, path)
+			}
+			continue
+		}
+		switch {
+		case strings.HasPrefix(text, "--- "):
+			oldPath = diffPath(strings.TrimPrefix(text, "--- "), "a/")
+		case strings.HasPrefix(text, "+++ "):
+			path = diffPath(strings.TrimPrefix(text, "+++ "), "b/")
+			if path == "" && oldPath != "" {
+				deleted.Add(oldPath)
+			}
+		case strings.HasPrefix(text, "@@ "):
+			var err error
+			oldLeft, newLeft, line, err = parseHunkHeader(text)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	ranges := make(map[string][]lineRange)
+	for path, lines := range changed {
+		if path == "" {
+			continue
+		}
+		ranges[path] = toRanges(lines)
+	}
+	return ranges, deleted, nil
+}
+
+// diffPath extracts the path from a diff file header, returning "" for /dev/null.
+func diffPath(header, prefix string) string {
+	// Some diff tools put a timestamp after the path, separated by a tab.
+	if i := strings.Index(header, "\t"); i >= 0 {
+		header = header[:i]
+	}
+	if header == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(header, prefix)
+}
+
+// parseHunkHeader parses a hunk header of the form "@@ -l,s +l,s @@", returning the number of
+// old and new lines in the hunk and the first new line number.
+func parseHunkHeader(header string) (oldCount, newCount, newStart int32, err error) {
+	fields := strings.Fields(header)
+	if len(fields) < 4 || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return 0, 0, 0, fmt.Errorf("malformed diff: bad hunk header %q", header)
+	}
+	if _, oldCount, err = parseHunkRange(fields[1][1:]); err != nil {
+		return 0, 0, 0, fmt.Errorf("malformed diff: bad hunk header %q: %v", header, err)
+	}
+	if newStart, newCount, err = parseHunkRange(fields[2][1:]); err != nil {
+		return 0, 0, 0, fmt.Errorf("malformed diff: bad hunk header %q: %v", header, err)
+	}
+	return oldCount, newCount, newStart, nil
+}
+
+// parseHunkRange parses "start,count" or "start", where the count defaults to 1.
+func parseHunkRange(r string) (start, count int32, err error) {
+	parts := strings.SplitN(r, ",", 2)
+	s, err := strconv.ParseInt(parts[0], 10, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	c := int64(1)
+	if len(parts) == 2 {
+		if c, err = strconv.ParseInt(parts[1], 10, 32); err != nil {
+			return 0, 0, err
+		}
+	}
+	return int32(s), int32(c), nil
+}
+
+// toRanges converts a list of line numbers into the smallest sorted list of ranges covering them.
+func toRanges(lines []int32) []lineRange {
+	sort.Slice(lines, func(i, j int) bool { return lines[i] < lines[j] })
+	var ranges []lineRange
+	for _, l := range lines {
+		if n := len(ranges); n > 0 && l <= ranges[n-1].end+1 {
+			if l > ranges[n-1].end {
+				ranges[n-1].end = l
+			}
+			continue
+		}
+		ranges = append(ranges, lineRange{l, l})
+	}
+	return ranges
+}
+
+// touches returns whether the location is within the changed lines. Locations without a path
+// are not specific to a file, and locations without a line refer to an entire file, so they
+// count as changed if their file was changed at all.
+func (c *changedLines) touches(loc *notepb.Location) bool {
+	if loc.Path == nil || c.whole.Contains(loc.GetPath()) {
+		return true
+	}
+	ranges, ok := c.lines[loc.GetPath()]
+	if !ok {
+		return false
+	}
+	start := loc.GetRange().GetStartLine()
+	if start == 0 {
+		return true
+	}
+	end := loc.GetRange().GetEndLine()
+	if end < start {
+		end = start
+	}
+	for _, r := range ranges {
+		if start <= r.end && end >= r.start {
+			return true
+		}
+	}
+	return false
+}
+
+// filter drops or demotes the notes that are outside of the changed lines, according to the
+// mode. A nil changedLines keeps all notes.
+func (c *changedLines) filter(notes []*notepb.Note) []*notepb.Note {
+	if c == nil || c.mode == rpcpb.ShipshapeRequest_ALL_LINES {
+		return notes
+	}
+	var keep []*notepb.Note
+	for _, note := range notes {
+		switch {
+		case note.Location == nil || c.touches(note.Location):
+			keep = append(keep, note)
+		case c.mode == rpcpb.ShipshapeRequest_DEMOTE_UNCHANGED:
+			demoted := proto.Clone(note).(*notepb.Note)
+			demoted.Severity = notepb.Note_OTHER.Enum()
+			keep = append(keep, demoted)
+		}
+	}
+	return keep
+}
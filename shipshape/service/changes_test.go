@@ -0,0 +1,260 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	strset "github.com/google/shipshape/shipshape/util/strings"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+	ctxpb "github.com/google/shipshape/shipshape/proto/shipshape_context_proto"
+	rpcpb "github.com/google/shipshape/shipshape/proto/shipshape_rpc_proto"
+	rangepb "github.com/google/shipshape/shipshape/proto/textrange_proto"
+)
+
+const testDiff = `diff --git a/dir/modified.go b/dir/modified.go
+index 1111111..2222222 100644
+--- a/dir/modified.go
++++ b/dir/modified.go
+@@ -3,4 +3,4 @@ func main() {
+ 	a := 1
+-	b := 2
++	b := 3
++	c := 4
+ 	d := 5
+--- e := 6
+@@ -20,2 +21,2 @@
+-x
++y
+ z
+diff --git a/new.txt b/new.txt
+new file mode 100644
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1,2 @@
++hello
++world
+\ No newline at end of file
+diff --git a/gone.txt b/gone.txt
+deleted file mode 100644
+--- a/gone.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+`
+
+func TestParseDiff(t *testing.T) {
+	lines, deleted, err := parseDiff(testDiff)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing diff: %v", err)
+	}
+	expectLines := map[string][]lineRange{
+		"dir/modified.go": {{4, 5}, {21, 21}},
+		"new.txt":         {{1, 2}},
+	}
+	if !reflect.DeepEqual(lines, expectLines) {
+		t.Errorf("Incorrect changed lines: got %v, want %v", lines, expectLines)
+	}
+	if expect := strset.New("gone.txt"); !reflect.DeepEqual(deleted, expect) {
+		t.Errorf("Incorrect deleted files: got %v, want %v", deleted, expect)
+	}
+}
+
+func TestParseDiffErrors(t *testing.T) {
+	tests := []struct {
+		label string
+		diff  string
+	}{
+		{"Bad hunk header", "--- a/a.go\n+++ b/a.go\n@@ -1 +x @@\n"},
+		{"Hunk too short", "--- a/a.go\n+++ b/a.go\n@@ -1,2 +1,2 @@\n a\nnot a diff line\n"},
+	}
+
+	for _, test := range tests {
+		if _, _, err := parseDiff(test.diff); err == nil {
+			t.Errorf("Expected an error for %q", test.label)
+		}
+	}
+}
+
+func noteAt(path string, start, end int32) *notepb.Note {
+	note := &notepb.Note{
+		Category: proto.String("Foo"),
+		Location: &notepb.Location{Path: proto.String(path)},
+	}
+	if start > 0 {
+		note.Location.Range = &rangepb.TextRange{StartLine: proto.Int32(start), EndLine: proto.Int32(end)}
+	}
+	return note
+}
+
+func TestChangedLinesFilter(t *testing.T) {
+	lines, deleted, err := parseDiff(testDiff)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing diff: %v", err)
+	}
+	notes := []*notepb.Note{
+		noteAt("dir/modified.go", 4, 0),                                           // changed line
+		noteAt("dir/modified.go", 1, 4),                                           // overlaps a changed line
+		noteAt("dir/modified.go", 6, 20),                                          // between changed lines
+		noteAt("dir/modified.go", 0, 0),                                           // whole changed file
+		noteAt("new.txt", 2, 2),                                                   // new file
+		noteAt("untracked.txt", 7, 7),                                             // entirely new file
+		noteAt("unchanged.go", 1, 1),                                              // file not in the change
+		&notepb.Note{Category: proto.String("Foo"), Location: &notepb.Location{}}, // no path
+	}
+	touched := []bool{true, true, false, true, true, true, false, true}
+
+	for _, mode := range []rpcpb.ShipshapeRequest_ChangedLinesMode{rpcpb.ShipshapeRequest_DROP_UNCHANGED, rpcpb.ShipshapeRequest_DEMOTE_UNCHANGED} {
+		changes := &changedLines{mode: mode, lines: lines, whole: strset.New("untracked.txt"), deleted: deleted}
+		got := changes.filter(notes)
+		var expect []*notepb.Note
+		for i, note := range notes {
+			switch {
+			case touched[i]:
+				expect = append(expect, note)
+			case mode == rpcpb.ShipshapeRequest_DEMOTE_UNCHANGED:
+				demoted := proto.Clone(note).(*notepb.Note)
+				demoted.Severity = notepb.Note_OTHER.Enum()
+				expect = append(expect, demoted)
+			}
+		}
+		if len(got) != len(expect) {
+			t.Errorf("Incorrect notes for mode %v: got %v, want %v", mode, got, expect)
+			continue
+		}
+		for i := range got {
+			if !proto.Equal(got[i], expect[i]) {
+				t.Errorf("Incorrect note %d for mode %v: got %v, want %v", i, mode, got[i], expect[i])
+			}
+		}
+	}
+	// The original notes must not be modified.
+	for _, note := range notes {
+		if note.Severity != nil {
+			t.Errorf("Note was modified while filtering: %v", note)
+		}
+	}
+
+	var none *changedLines
+	if got := none.filter(notes); !reflect.DeepEqual(got, notes) {
+		t.Errorf("Notes were filtered without any changed lines: got %v, want %v", got, notes)
+	}
+}
+
+func TestFindChangedLinesNoDiff(t *testing.T) {
+	changes, err := findChangedLines("", nil, rpcpb.ShipshapeRequest_ALL_LINES)
+	if changes != nil || err != nil {
+		t.Errorf("Expected no changed lines for ALL_LINES, got %v, %v", changes, err)
+	}
+	if _, err := findChangedLines("", &ctxpb.ChangelistDetails{}, rpcpb.ShipshapeRequest_DROP_UNCHANGED); err == nil {
+		t.Errorf("Expected an error when there is no diff or base revision")
+	}
+}
+
+func TestFindChangedLinesOptionRevision(t *testing.T) {
+	root, err := ioutil.TempDir("", "changes_test")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+	output := filepath.Join(root, "written")
+
+	for _, rev := range []string{"--output=" + output, "-p"} {
+		details := &ctxpb.ChangelistDetails{BaseRevision: proto.String(rev)}
+		if _, err := findChangedLines(root, details, rpcpb.ShipshapeRequest_DROP_UNCHANGED); err == nil {
+			t.Errorf("Expected an error for base revision %q", rev)
+		}
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("A base revision was passed to git as an option: %s exists", output)
+	}
+}
+
+func TestFindChangedLinesBaseRevision(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root, err := ioutil.TempDir("", "changes_test")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	git := func(args ...string) {
+		args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+		if _, err := runGit(root, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(path, content string) {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Could not write %s: %v", path, err)
+		}
+	}
+	git("init", "-q")
+	write("a.txt", "one\ntwo\nthree\n")
+	write("b.txt", "gone\n")
+	write("sub/d.txt", "four\nfive\n")
+	git("add", "a.txt", "b.txt", "sub/d.txt")
+	git("commit", "-q", "-m", "base")
+	write("a.txt", "one\n2\nthree\n")
+	write("c.txt", "new\n")
+	write("sub/d.txt", "four\n5\n")
+	write("sub/e.txt", "new\n")
+	git("rm", "-q", "b.txt")
+
+	changes, err := findChangedLines(root, &ctxpb.ChangelistDetails{BaseRevision: proto.String("HEAD")}, rpcpb.ShipshapeRequest_DROP_UNCHANGED)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expect := map[string][]lineRange{"a.txt": {{2, 2}}, "sub/d.txt": {{2, 2}}}; !reflect.DeepEqual(changes.lines, expect) {
+		t.Errorf("Incorrect changed lines: got %v, want %v", changes.lines, expect)
+	}
+	if expect := strset.New("c.txt", "sub/e.txt"); !reflect.DeepEqual(changes.whole, expect) {
+		t.Errorf("Incorrect new files: got %v, want %v", changes.whole, expect)
+	}
+	if expect := strset.New("b.txt"); !reflect.DeepEqual(changes.deleted, expect) {
+		t.Errorf("Incorrect deleted files: got %v, want %v", changes.deleted, expect)
+	}
+
+	// When the analyzed root is a subdirectory of the checkout, the paths are relative
+	// to it and the changes outside of it are left out.
+	changes, err = findChangedLines(filepath.Join(root, "sub"), &ctxpb.ChangelistDetails{BaseRevision: proto.String("HEAD")}, rpcpb.ShipshapeRequest_DROP_UNCHANGED)
+	if err != nil {
+		t.Fatalf("Unexpected error for a subdirectory: %v", err)
+	}
+	if expect := map[string][]lineRange{"d.txt": {{2, 2}}}; !reflect.DeepEqual(changes.lines, expect) {
+		t.Errorf("Incorrect changed lines in a subdirectory: got %v, want %v", changes.lines, expect)
+	}
+	if expect := strset.New("e.txt"); !reflect.DeepEqual(changes.whole, expect) {
+		t.Errorf("Incorrect new files in a subdirectory: got %v, want %v", changes.whole, expect)
+	}
+	if len(changes.deleted) != 0 {
+		t.Errorf("Incorrect deleted files in a subdirectory: got %v, want none", changes.deleted)
+	}
+}
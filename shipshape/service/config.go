@@ -19,18 +19,53 @@ package service
 import (
 	"fmt"
 	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	strset "github.com/google/shipshape/shipshape/util/strings"
 	yaml "gopkg.in/yaml.v2"
 
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
 	configpb "github.com/google/shipshape/shipshape/proto/shipshape_config_proto"
 )
 
 const (
 	defaultName = "default"
+	// allName is the event that applies to every run of Shipshape. It must be the only
+	// event in its config.
+	allName = "All"
+)
+
+var (
+	// BuiltinCategories are the categories of the analyzers that come with the
+	// Shipshape service.
+	BuiltinCategories = []string{
+		"CheckstyleGoogle",
+		"CodeAlert",
+		"ErrorProne",
+		"JSHint",
+		"PostMessage",
+		"PyLint",
+		"WordCount",
+		"go vet",
+	}
+
+	// DefaultCategories are the categories to run when neither the request nor the
+	// config file chooses any.
+	DefaultCategories = []string{
+		"CheckstyleGoogle",
+		"ErrorProne",
+		"CodeAlert",
+		"JSHint",
+		"PyLint",
+		"go vet",
+	}
 )
 
 // config is a struct for handling configuration for analyses. Given a Shipshape Context, it will access
@@ -40,27 +75,40 @@ type config struct {
 	images     []string
 	ignore     []string
 	categories []string
+	// timeouts maps categories to how long to wait for their analyzers.
+	// The empty category holds the timeout for all other categories.
+	timeouts map[string]time.Duration
+	// paths holds the rules for running categories on parts of the repository.
+	paths []*configpb.PathConfig
+	// options maps categories to the settings for their analyzers.
+	options map[string][]string
+	// severities maps categories to the severity that their notes get.
+	severities map[string]notepb.Note_Severity
+	// raw is the configuration this was built from, file the path of its config file
+	// relative to the repository root, and positions the locations of its fields, for
+	// reporting problems with it.
+	raw       *configpb.ShipshapeConfig
+	file      string
+	positions yamlPositions
 }
 
-// unmarshalConfigBytes parses a YAML payload into a Shipshape config. It normalizes
-// all string fields to lowercase. Failure to parse the YAML input will result in an error
-// and a nil config.
+// unmarshalConfigBytes parses a YAML payload into a Shipshape config. Failure to parse
+// the YAML input will result in an error and a nil config. Event and category names are
+// kept as written; they are matched case-insensitively when the config is used.
 func unmarshalConfigBytes(configData []byte) (*configpb.ShipshapeConfig, error) {
 	var config configpb.ShipshapeConfig
 	if err := yaml.Unmarshal(configData, &config); err != nil {
 		return nil, err
 	}
 
-	// TODO: normalize all events, categories, and excludes.
-
 	return &config, nil
 }
 
-// eventWithName returns the event config stanza corresponding to the given name.
-// If no matching event is found, return nil.
+// eventWithName returns the event config stanza corresponding to the given name,
+// ignoring case. If no matching event is found, return nil.
 func eventWithName(rawConfig *configpb.ShipshapeConfig, eventName string) *configpb.EventConfig {
 	for _, ec := range rawConfig.Events {
-		if ec.GetEvent() == eventName {
+		if strings.EqualFold(ec.GetEvent(), eventName) {
 			return ec
 		}
 	}
@@ -71,6 +119,8 @@ func eventWithName(rawConfig *configpb.ShipshapeConfig, eventName string) *confi
 // categories, images, and ignore lines that apply to the given event.
 func buildConfig(rawConfig *configpb.ShipshapeConfig, eventName string) *config {
 	c := new(config)
+	c.raw = rawConfig
+	c.paths = rawConfig.Paths
 
 	eventConfig := eventWithName(rawConfig, eventName)
 	defaultConfig := eventWithName(rawConfig, defaultName)
@@ -79,60 +129,438 @@ func buildConfig(rawConfig *configpb.ShipshapeConfig, eventName string) *config
 	} else if defaultConfig != nil {
 		c.categories = append(c.categories, defaultConfig.Categories...)
 	}
+	if allConfig := eventWithName(rawConfig, allName); allConfig != nil {
+		seen := strset.New()
+		for _, cat := range c.categories {
+			seen.Add(strings.ToLower(cat))
+		}
+		for _, cat := range allConfig.Categories {
+			if !seen.Contains(strings.ToLower(cat)) {
+				seen.Add(strings.ToLower(cat))
+				c.categories = append(c.categories, cat)
+			}
+		}
+	}
 	if g := rawConfig.Global; g != nil {
 		c.images = append(c.images, g.Images...)
 		c.ignore = append(c.ignore, g.Ignore...)
+		for _, tc := range g.Timeouts {
+			if c.timeouts == nil {
+				c.timeouts = make(map[string]time.Duration)
+			}
+			c.timeouts[tc.GetCategory()] = time.Duration(tc.GetSeconds()) * time.Second
+		}
+		for _, co := range g.Options {
+			if c.options == nil {
+				c.options = make(map[string][]string)
+			}
+			c.options[co.GetCategory()] = append(c.options[co.GetCategory()], co.Settings...)
+		}
+		for _, sc := range g.Severities {
+			if severity, ok := parseSeverity(sc.GetSeverity()); ok {
+				if c.severities == nil {
+					c.severities = make(map[string]notepb.Note_Severity)
+				}
+				c.severities[sc.GetCategory()] = severity
+			}
+		}
 	}
 	return c
 }
 
-// validateConfig looks for errors in the given configuration proto.
-// TODO(collinwinter): return all the errors, not just the first one.
+// validateConfig looks for errors in the given configuration proto. It returns a
+// configErrors with every problem it finds.
 func validateConfig(rawConfig *configpb.ShipshapeConfig) error {
+	var errs configErrors
+	var names []string
 	eventNames := make(map[string][]string)
 	for i, ec := range rawConfig.Events {
+		field := fmt.Sprintf("events[%d]", i)
 		if ec.Event == nil {
-			return fmt.Errorf("Event at index %v is missing an event name", i)
+			errs.add(field, "Event at index %v is missing an event name", i)
+			continue
 		}
 		if len(ec.Categories) == 0 {
-			return fmt.Errorf("Event %q must specify at least one category", *ec.Event)
+			errs.add(field, "Event %q must specify at least one category", *ec.Event)
+		}
+		// Event names are matched ignoring case, so they must be unique ignoring case.
+		name := strings.ToLower(ec.GetEvent())
+		if _, ok := eventNames[name]; !ok {
+			names = append(names, ec.GetEvent())
 		}
-		eventNames[ec.GetEvent()] = append(eventNames[ec.GetEvent()], strconv.Itoa(i))
+		eventNames[name] = append(eventNames[name], strconv.Itoa(i))
 	}
-	for name, indexes := range eventNames {
-		if len(indexes) > 1 {
-			return fmt.Errorf("Multiple events with name %q (indexes %v)", name, strings.Join(indexes, ", "))
+	for _, name := range names {
+		if indexes := eventNames[strings.ToLower(name)]; len(indexes) > 1 {
+			field := fmt.Sprintf("events[%s].event", indexes[1])
+			errs.add(field, "Multiple events with name %q (indexes %v)", name, strings.Join(indexes, ", "))
 		}
 	}
-	return nil
+	if indexes := eventNames[strings.ToLower(allName)]; len(indexes) > 0 && len(eventNames) > 1 {
+		field := fmt.Sprintf("events[%s].event", indexes[0])
+		errs.add(field, "Event %q applies to every run, so it must be the only event", allName)
+	}
+	for i, entry := range rawConfig.GetGlobal().GetIgnore() {
+		if err := validateIgnoreEntry(entry); err != nil {
+			errs.add(fmt.Sprintf("global.ignore[%d]", i), "Ignore entry at index %v is invalid: %v", i, err)
+		}
+	}
+	for i, tc := range rawConfig.GetGlobal().GetTimeouts() {
+		if tc.GetSeconds() <= 0 {
+			errs.add(fmt.Sprintf("global.timeouts[%d]", i), "Timeout at index %v must be a positive number of seconds", i)
+		}
+	}
+	optionCats := make(map[string]int)
+	for i, co := range rawConfig.GetGlobal().GetOptions() {
+		field := fmt.Sprintf("global.options[%d]", i)
+		if co.Category == nil {
+			errs.add(field, "Options at index %v are missing a category", i)
+			continue
+		}
+		if j, ok := optionCats[strings.ToLower(co.GetCategory())]; ok {
+			errs.add(field+".category", "Multiple options for category %q (indexes %v, %v)", co.GetCategory(), j, i)
+		} else {
+			optionCats[strings.ToLower(co.GetCategory())] = i
+		}
+		for j, setting := range co.Settings {
+			if name := strings.SplitN(setting, "=", 2)[0]; strings.TrimSpace(name) == "" {
+				errs.add(fmt.Sprintf("%s.settings[%d]", field, j), "Setting %q must be of the form name=value", setting)
+			}
+		}
+	}
+	for i, sc := range rawConfig.GetGlobal().GetSeverities() {
+		field := fmt.Sprintf("global.severities[%d]", i)
+		if sc.Category == nil {
+			errs.add(field, "Severity at index %v is missing a category", i)
+		}
+		if _, ok := parseSeverity(sc.GetSeverity()); !ok {
+			errs.add(field+".severity", "Severity %q must be one of BUILD_ERROR, WARNING or OTHER", sc.GetSeverity())
+		}
+	}
+	for i, pc := range rawConfig.Paths {
+		field := fmt.Sprintf("paths[%d]", i)
+		if p, err := validPattern(pc.GetPath()); err != nil {
+			errs.add(field+".path", "Path rule at index %v is invalid: %v", i, err)
+		} else if p.negate {
+			errs.add(field+".path", "Path rule at index %v cannot use a negated pattern", i)
+		}
+		if len(pc.Enable) == 0 && len(pc.Disable) == 0 {
+			errs.add(field, "Path rule at index %v must enable or disable at least one category", i)
+		}
+	}
+	return errs.errorOrNil()
+}
+
+// parseSeverity returns the note severity with the given name, ignoring case.
+func parseSeverity(name string) (notepb.Note_Severity, bool) {
+	value, ok := notepb.Note_Severity_value[strings.ToUpper(name)]
+	return notepb.Note_Severity(value), ok
+}
+
+// checkKeys looks for keys in the YAML value that do not name a field of the
+// corresponding config type. The value is as unmarshalled by the YAML parser into an
+// interface{}, and field is its path in the document.
+func checkKeys(value interface{}, t reflect.Type, field string) configErrors {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var errs configErrors
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := value.(map[interface{}]interface{})
+		if !ok {
+			return nil
+		}
+		// The YAML parser matches keys to the lowercased field names.
+		fields := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			if f := t.Field(i); !strings.HasPrefix(f.Name, "XXX_") {
+				fields[strings.ToLower(f.Name)] = f.Type
+			}
+		}
+		var keys []string
+		for k := range m {
+			keys = append(keys, fmt.Sprint(k))
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child := key
+			if field != "" {
+				child = field + "." + key
+			}
+			ft, ok := fields[key]
+			if !ok {
+				errs.add(child, "Unknown key %q", key)
+				continue
+			}
+			errs = append(errs, checkKeys(m[key], ft, child)...)
+		}
+	case reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, item := range items {
+			errs = append(errs, checkKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", field, i))...)
+		}
+	}
+	return errs
+}
+
+// unknownCategories returns an error for each category used in the config that is
+// not in known, ignoring case. The error suggests the closest known category, if any.
+func unknownCategories(rawConfig *configpb.ShipshapeConfig, known strset.Set) configErrors {
+	var errs configErrors
+	names := newCategoryNames(known)
+	check := func(field string, cat string) {
+		if !names.contains(cat) {
+			errs.add(field, "Unknown category %q%s", cat, names.didYouMean(cat))
+		}
+	}
+	for i, ec := range rawConfig.Events {
+		for j, cat := range ec.Categories {
+			check(fmt.Sprintf("events[%d].categories[%d]", i, j), cat)
+		}
+	}
+	for i, pc := range rawConfig.Paths {
+		for j, cat := range pc.Enable {
+			check(fmt.Sprintf("paths[%d].enable[%d]", i, j), cat)
+		}
+		for j, cat := range pc.Disable {
+			check(fmt.Sprintf("paths[%d].disable[%d]", i, j), cat)
+		}
+	}
+	for i, tc := range rawConfig.GetGlobal().GetTimeouts() {
+		if tc.Category != nil {
+			check(fmt.Sprintf("global.timeouts[%d].category", i), tc.GetCategory())
+		}
+	}
+	for i, co := range rawConfig.GetGlobal().GetOptions() {
+		if co.Category != nil {
+			check(fmt.Sprintf("global.options[%d].category", i), co.GetCategory())
+		}
+	}
+	for i, sc := range rawConfig.GetGlobal().GetSeverities() {
+		if sc.Category != nil {
+			check(fmt.Sprintf("global.severities[%d].category", i), sc.GetCategory())
+		}
+	}
+	return errs
 }
 
 // GlobalConfig retrieves the global configuration settings for the specified
 // configuration file. Right now, this is just the list of third-party analyzer
 // images to run.
 func GlobalConfig(path string) ([]string, error) {
-	cfg, err := loadConfig(filepath.Join(path, configFilename), "")
+	cfg, err := loadConfig(path, "")
 	if err != nil || cfg == nil {
 		return nil, err
 	}
 	return cfg.images, nil
 }
 
-// loadConfig looks at given path for a Shipshape config file, loading the configuration
-// for the given event, if found.
-func loadConfig(configPath string, eventName string) (*config, error) {
-	content, err := ioutil.ReadFile(configPath)
+// ValidateConfig checks the Shipshape config files in the repository at root, including
+// the ones in subdirectories, and returns a note located on the config file for each
+// problem. Categories that are not in known are reported as problems too, but if the
+// config at the root lists analyzer images, which can provide other categories, their
+// notes have the OTHER severity rather than WARNING. Config files in the paths ignored by
+// the config at the root are left out. It only returns an error if the files cannot be
+// read.
+func ValidateConfig(root string, known []string) ([]*notepb.Note, error) {
+	var ignore []string
+	hasImages := false
+	if rawConfig, _, _ := readConfig(root, configFilename); rawConfig != nil {
+		ignore = rawConfig.GetGlobal().GetIgnore()
+		hasImages = len(rawConfig.GetGlobal().GetImages()) > 0
+	}
+	rules, err := configIgnoreRules(root, ignore)
+	if err != nil {
+		return nil, err
+	}
+	files, err := findConfigFiles(root, rules)
+	if err != nil {
+		return nil, err
+	}
+	knownCats := strset.New(known...)
+	var notes []*notepb.Note
+	for _, file := range files {
+		var errs configErrors
+		rawConfig, positions, err := readConfig(root, file)
+		if cerrs, ok := err.(configErrors); ok {
+			errs = append(errs, cerrs...)
+		} else if err != nil {
+			return nil, err
+		}
+		if rawConfig != nil {
+			if file != configFilename && rawConfig.Global != nil {
+				errs = append(errs, nestedGlobalError(file, positions))
+			}
+			unknown := unknownCategories(rawConfig, knownCats).locate(file, positions)
+			for i := range unknown {
+				unknown[i].minor = hasImages
+			}
+			errs = append(errs, unknown...)
+		}
+		errs.sortByPosition()
+		notes = append(notes, errs.notes()...)
+	}
+	return notes, nil
+}
+
+// loadConfig looks in the root directory of a repository for a Shipshape config file,
+// loading the configuration for the given event, if found.
+func loadConfig(root string, eventName string) (*config, error) {
+	rawConfig, positions, err := readConfig(root, configFilename)
+	if err != nil || rawConfig == nil {
+		return nil, err
+	}
+	cfg := buildConfig(rawConfig, eventName)
+	cfg.file, cfg.positions = configFilename, positions
+	return cfg, nil
+}
+
+// readConfig reads and validates the Shipshape config file at the path file, relative to
+// root. It returns nil if there is no such file. Problems with the contents of the file are
+// returned as configErrors located in the file, along with the config if it could be parsed.
+func readConfig(root string, file string) (*configpb.ShipshapeConfig, yamlPositions, error) {
+	content, err := ioutil.ReadFile(filepath.Join(root, file))
 	if os.IsNotExist(err) {
-		return nil, nil
+		return nil, nil, nil
 	} else if err != nil {
+		return nil, nil, err
+	}
+	file = filepath.ToSlash(file)
+	rawConfig, err := unmarshalConfigBytes(content)
+	if err != nil {
+		return nil, nil, yamlErrors(err).locate(file, nil)
+	}
+	positions := indexYAML(string(content))
+	var generic interface{}
+	if err := yaml.Unmarshal(content, &generic); err != nil {
+		return nil, nil, yamlErrors(err).locate(file, nil)
+	}
+	errs := checkKeys(generic, reflect.TypeOf(rawConfig), "")
+	if err := validateConfig(rawConfig); err != nil {
+		errs = append(errs, err.(configErrors)...)
+	}
+	return rawConfig, positions, errs.locate(file, positions).errorOrNil()
+}
+
+// findConfigFiles returns the paths of the Shipshape config files in the repository at
+// root, relative to root. Directories starting with "." are skipped, as when collecting
+// files, and so are the directories and config files that ignore leaves out of the
+// analysis. Directories that cannot be read are logged and skipped. Parent directories
+// come before their subdirectories.
+func findConfigFiles(root string, ignore ignoreRules) ([]string, error) {
+	var files []string
+	walkpath := func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			log.Printf("Skipping %s while looking for config files: %v", path, err)
+			if f != nil && f.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !f.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if path != root && (strings.HasPrefix(f.Name(), ".") || ignore.ignoredDir(rel)) {
+			return filepath.SkipDir
+		}
+		file := filepath.Join(rel, configFilename)
+		if path != root && ignore.ignored(filepath.ToSlash(file)) {
+			log.Printf("Skipping ignored config file %s", file)
+			return nil
+		}
+		if _, err := os.Stat(filepath.Join(root, file)); err == nil {
+			files = append(files, file)
+		}
+		return nil
+	}
+	if err := filepath.Walk(root, walkpath); err != nil {
 		return nil, err
 	}
-	cfg, err := unmarshalConfigBytes(content)
+	return files, nil
+}
+
+// configIgnoreRules compiles the ignore list of the config at the repository root, for
+// leaving the config files in ignored directories out.
+func configIgnoreRules(root string, ignore []string) (ignoreRules, error) {
+	entries, err := expandIgnoreEntries(root, ignore)
+	if err != nil {
+		return nil, err
+	}
+	return compileIgnoreRules(entries), nil
+}
+
+// nestedGlobalError reports a global section in a config file below the repository root.
+func nestedGlobalError(file string, positions yamlPositions) configError {
+	var errs configErrors
+	errs.add("global", "Global settings are only allowed in the .shipshape file at the repository root")
+	return errs.locate(filepath.ToSlash(file), positions)[0]
+}
+
+// nestedConfig is the configuration from a .shipshape file below the repository root.
+type nestedConfig struct {
+	// dir is the directory of the file, relative to the repository root.
+	dir string
+	cfg *config
+}
+
+// loadNestedConfigs finds the Shipshape config files in the subdirectories of root and
+// loads their configuration for the given event. The config files in the paths that
+// ignore, the ignore list of the config at the root, leaves out are not loaded. Parent
+// directories come before their subdirectories.
+func loadNestedConfigs(root string, eventName string, ignore []string) ([]nestedConfig, error) {
+	rules, err := configIgnoreRules(root, ignore)
 	if err != nil {
 		return nil, err
 	}
-	if err := validateConfig(cfg); err != nil {
+	files, err := findConfigFiles(root, rules)
+	if err != nil {
 		return nil, err
 	}
-	return buildConfig(cfg, eventName), nil
+	var configs []nestedConfig
+	// Keep going after a problem, to report the problems with every config file at once.
+	var errs configErrors
+	for _, file := range files {
+		if file == configFilename {
+			continue
+		}
+		rawConfig, positions, err := readConfig(root, file)
+		if cerrs, ok := err.(configErrors); ok {
+			errs = append(errs, cerrs...)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if rawConfig.Global != nil {
+			errs = append(errs, nestedGlobalError(file, positions))
+			continue
+		}
+		cfg := buildConfig(rawConfig, eventName)
+		cfg.file, cfg.positions = filepath.ToSlash(file), positions
+		configs = append(configs, nestedConfig{filepath.ToSlash(filepath.Dir(file)), cfg})
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return configs, nil
+}
+
+// unknownCategories returns an error located in the config file for each category the
+// config uses that is not in known.
+func (c *config) unknownCategories(known strset.Set) configErrors {
+	if c == nil || c.raw == nil {
+		return nil
+	}
+	return unknownCategories(c.raw, known).locate(c.file, c.positions)
 }
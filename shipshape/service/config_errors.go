@@ -0,0 +1,170 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	yaml "gopkg.in/yaml.v2"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+	rpcpb "github.com/google/shipshape/shipshape/proto/shipshape_rpc_proto"
+	rangepb "github.com/google/shipshape/shipshape/proto/textrange_proto"
+)
+
+// configCategory is the category of the notes reporting problems with a config file.
+const configCategory = "ShipshapeConfig"
+
+// configError is a problem with a Shipshape config file.
+type configError struct {
+	// field is the path of the YAML field with the problem, such as "events[1].event",
+	// or empty if the problem is with the whole file.
+	field string
+	msg   string
+	// file is the path of the config file, relative to the repository root, and
+	// line and column locate the problem in it. They are set by locate.
+	file         string
+	line, column int
+	// minor marks a problem that may not be one, such as a category that an analyzer
+	// image could provide. Its note has the OTHER severity rather than WARNING.
+	minor bool
+}
+
+func (e configError) Error() string {
+	switch {
+	case e.file == "":
+		return e.msg
+	case e.line == 0:
+		return fmt.Sprintf("%s: %s", e.file, e.msg)
+	case e.column == 0:
+		return fmt.Sprintf("%s:%d: %s", e.file, e.line, e.msg)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.file, e.line, e.column, e.msg)
+}
+
+// configErrors holds every problem found with a config file.
+type configErrors []configError
+
+func (e configErrors) Error() string {
+	var msgs []string
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// errorOrNil returns nil if there are no errors, so that the result can be
+// compared to nil as an error.
+func (e configErrors) errorOrNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *configErrors) add(field string, format string, args ...interface{}) {
+	*e = append(*e, configError{field: field, msg: fmt.Sprintf(format, args...)})
+}
+
+// locate sets the file of the errors, looks up their positions, and sorts them by position.
+func (e configErrors) locate(file string, positions yamlPositions) configErrors {
+	located := make(configErrors, len(e))
+	for i, err := range e {
+		err.file = file
+		if pos, ok := positions.find(err.field); ok && err.line == 0 {
+			err.line, err.column = pos.line, pos.column
+		}
+		located[i] = err
+	}
+	located.sortByPosition()
+	return located
+}
+
+// sortByPosition sorts errors for a single file by their position in it.
+func (e configErrors) sortByPosition() {
+	sort.SliceStable(e, func(i, j int) bool {
+		if e[i].line != e[j].line {
+			return e[i].line < e[j].line
+		}
+		return e[i].column < e[j].column
+	})
+}
+
+// notes returns a note located on the config file for each error.
+func (e configErrors) notes() []*notepb.Note {
+	var notes []*notepb.Note
+	for _, err := range e {
+		loc := &notepb.Location{Path: proto.String(err.file)}
+		if err.line > 0 {
+			loc.Range = &rangepb.TextRange{StartLine: proto.Int32(int32(err.line))}
+			if err.column > 0 {
+				loc.Range.StartColumn = proto.Int32(int32(err.column))
+			}
+		}
+		severity := notepb.Note_WARNING
+		if err.minor {
+			severity = notepb.Note_OTHER
+		}
+		notes = append(notes, &notepb.Note{
+			Category:    proto.String(configCategory),
+			Description: proto.String(err.msg),
+			Location:    loc,
+			Severity:    severity.Enum(),
+		})
+	}
+	return notes
+}
+
+var yamlErrorLine = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+// yamlErrors converts an error from the YAML parser into configErrors, keeping the
+// line numbers the parser reports.
+func yamlErrors(err error) configErrors {
+	var msgs []string
+	if terr, ok := err.(*yaml.TypeError); ok {
+		msgs = terr.Errors
+	} else {
+		msgs = []string{strings.TrimPrefix(err.Error(), "yaml: ")}
+	}
+	var errs configErrors
+	for _, msg := range msgs {
+		e := configError{msg: msg}
+		if m := yamlErrorLine.FindStringSubmatch(msg); m != nil {
+			e.line, _ = strconv.Atoi(m[1])
+			e.msg = m[2]
+		}
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// configFailure returns the response reporting that the config could not be loaded. Problems
+// with the contents of a config file are reported as notes located on the file.
+func configFailure(err error) *rpcpb.AnalyzeResponse {
+	errs, ok := err.(configErrors)
+	if !ok {
+		return generateFailure("Driver setup", err.Error())
+	}
+	ar := generateFailure("Driver setup", fmt.Sprintf("The Shipshape config is invalid; see the %s notes", configCategory))
+	ar.Note = errs.notes()
+	return ar
+}
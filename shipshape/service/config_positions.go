@@ -0,0 +1,160 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// yamlPosition is a 1-based line and column in a YAML file.
+type yamlPosition struct {
+	line, column int
+}
+
+// yamlPositions maps the fields of a YAML document to where they start. Fields are named
+// by their path from the root, such as "events[1].categories[0]". Only block style
+// YAML is indexed, which is what Shipshape config files use; entries of flow style
+// collections (such as "[a, b]") are located at the collection.
+type yamlPositions map[string]yamlPosition
+
+const (
+	// A mapping whose keys are at the frame's indent.
+	mappingFrame = iota
+	// A sequence whose items are at the frame's indent.
+	sequenceFrame
+	// A key whose value starts on the next line.
+	keyFrame
+	// A block scalar, whose lines are indented more than the frame.
+	scalarFrame
+)
+
+type yamlFrame struct {
+	kind   int
+	indent int
+	path   string
+	// items counts the items seen so far in a sequence.
+	items int
+}
+
+var yamlKey = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\s*:(?:\s+(.*))?$`)
+
+// indexYAML scans the YAML content and returns the positions of its fields.
+func indexYAML(content string) yamlPositions {
+	pos := make(yamlPositions)
+	frames := []yamlFrame{{kind: mappingFrame}}
+	top := func() *yamlFrame { return &frames[len(frames)-1] }
+
+	for n, line := range strings.Split(content, "\n") {
+		text := strings.TrimLeft(line, " ")
+		indent := len(line) - len(text)
+		text = strings.TrimRight(text, " \t\r")
+		if top().kind == scalarFrame {
+			if text == "" || indent > top().indent {
+				continue
+			}
+			frames = frames[:len(frames)-1]
+		}
+		if text == "" || strings.HasPrefix(text, "#") || text == "---" {
+			continue
+		}
+
+		for text != "" {
+			if text == "-" || strings.HasPrefix(text, "- ") {
+				// A sequence item belongs to the key above it, even at the same indent.
+				for top().indent > indent || (top().indent == indent && top().kind == mappingFrame && len(frames) > 1) {
+					frames = frames[:len(frames)-1]
+				}
+				switch {
+				case top().kind == sequenceFrame && top().indent == indent:
+					top().items++
+				case top().kind == keyFrame:
+					frames = append(frames, yamlFrame{kind: sequenceFrame, indent: indent, path: top().path})
+				default:
+					// Not something we can index.
+					text = ""
+					continue
+				}
+				item := top().path + "[" + strconv.Itoa(top().items) + "]"
+				pos[item] = yamlPosition{n + 1, indent + 1}
+
+				rest := strings.TrimLeft(strings.TrimPrefix(text, "-"), " ")
+				restIndent := indent + len(text) - len(rest)
+				switch {
+				case rest == "" || strings.HasPrefix(rest, "#"):
+					// The item's value starts on the next line.
+					frames = append(frames, yamlFrame{kind: keyFrame, indent: indent, path: item})
+				case yamlKey.MatchString(rest):
+					frames = append(frames, yamlFrame{kind: mappingFrame, indent: restIndent, path: item})
+				}
+				text, indent = rest, restIndent
+				continue
+			}
+
+			m := yamlKey.FindStringSubmatch(text)
+			if m == nil {
+				// A scalar item, or something we cannot index.
+				break
+			}
+			for top().indent > indent || (top().indent == indent && top().kind != mappingFrame) {
+				frames = frames[:len(frames)-1]
+			}
+			if top().kind == keyFrame {
+				// The first key of a mapping nested under a key.
+				frames = append(frames, yamlFrame{kind: mappingFrame, indent: indent, path: top().path})
+			}
+			if top().kind != mappingFrame || top().indent != indent {
+				break
+			}
+			path := m[1]
+			if top().path != "" {
+				path = top().path + "." + m[1]
+			}
+			pos[path] = yamlPosition{n + 1, indent + 1}
+
+			value := m[2]
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+			switch {
+			case value == "" || strings.HasPrefix(value, "#"):
+				frames = append(frames, yamlFrame{kind: keyFrame, indent: indent, path: path})
+			case strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">"):
+				frames = append(frames, yamlFrame{kind: scalarFrame, indent: indent, path: path})
+			}
+			break
+		}
+	}
+	return pos
+}
+
+// find returns the position of the field at path. If the field is not indexed, it
+// returns the position of the closest enclosing field that is, or false if there is none.
+func (p yamlPositions) find(path string) (yamlPosition, bool) {
+	for path != "" {
+		if pos, ok := p[path]; ok {
+			return pos, true
+		}
+		i := strings.LastIndexAny(path, ".[")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return yamlPosition{}, false
+}
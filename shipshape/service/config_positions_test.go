@@ -0,0 +1,104 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIndexYAML(t *testing.T) {
+	content := `# Comment
+global:
+  images:
+    - foo/bar:prod
+  ignore: [third_party/, gen/]
+  timeouts:
+  - category: go vet
+    seconds: 30
+events:
+  - event: review   # trailing comment
+    categories:
+      - JSHint
+      - go vet
+  -
+    event: deploy
+    categories:
+    - PyLint
+paths:
+  - path: tools/
+    description: |
+      enable: not a key
+    enable:
+      - PyLint
+`
+	expect := yamlPositions{
+		"global":                      {2, 1},
+		"global.images":               {3, 3},
+		"global.images[0]":            {4, 5},
+		"global.ignore":               {5, 3},
+		"global.timeouts":             {6, 3},
+		"global.timeouts[0]":          {7, 3},
+		"global.timeouts[0].category": {7, 5},
+		"global.timeouts[0].seconds":  {8, 5},
+		"events":                      {9, 1},
+		"events[0]":                   {10, 3},
+		"events[0].event":             {10, 5},
+		"events[0].categories":        {11, 5},
+		"events[0].categories[0]":     {12, 7},
+		"events[0].categories[1]":     {13, 7},
+		"events[1]":                   {14, 3},
+		"events[1].event":             {15, 5},
+		"events[1].categories":        {16, 5},
+		"events[1].categories[0]":     {17, 5},
+		"paths":                       {18, 1},
+		"paths[0]":                    {19, 3},
+		"paths[0].path":               {19, 5},
+		"paths[0].description":        {20, 5},
+		"paths[0].enable":             {22, 5},
+		"paths[0].enable[0]":          {23, 7},
+	}
+	if got := indexYAML(content); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Incorrect positions:\n got %v\nwant %v", got, expect)
+	}
+}
+
+func TestYAMLPositionsFind(t *testing.T) {
+	positions := yamlPositions{
+		"global":          {1, 1},
+		"global.ignore":   {2, 3},
+		"events[0]":       {3, 3},
+		"events[0].event": {3, 5},
+	}
+	tests := []struct {
+		field  string
+		expect yamlPosition
+		found  bool
+	}{
+		{"global.ignore", yamlPosition{2, 3}, true},
+		{"global.ignore[1]", yamlPosition{2, 3}, true},
+		{"events[0].categories[2]", yamlPosition{3, 3}, true},
+		{"paths[0].path", yamlPosition{}, false},
+		{"", yamlPosition{}, false},
+	}
+	for _, test := range tests {
+		got, found := positions.find(test.field)
+		if got != test.expect || found != test.found {
+			t.Errorf("Incorrect position for %q: got %v, %v, want %v, %v", test.field, got, found, test.expect, test.found)
+		}
+	}
+}
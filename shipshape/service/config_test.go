@@ -19,8 +19,18 @@ package service
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	strset "github.com/google/shipshape/shipshape/util/strings"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+	configpb "github.com/google/shipshape/shipshape/proto/shipshape_config_proto"
 )
 
 type testSpec struct {
@@ -59,6 +69,13 @@ events:
 			[]string{"file=.gitignore", "third_party/"},
 			[]string{"Loadtest"},
 		},
+		{
+			"Event name in a different case",
+			"Deploy",
+			[]string{"foo.com:5050/foo/bar:prod", "bar/baz:hork"},
+			[]string{"file=.gitignore", "third_party/"},
+			[]string{"Loadtest"},
+		},
 		{
 			"Event with no special categories",
 			"something",
@@ -114,6 +131,171 @@ events:
 	}
 }
 
+func TestValidConfigAll(t *testing.T) {
+	yaml := `
+global:
+  ignore:
+    - third_party/
+
+events:
+  - event: All
+    categories:
+      - go vet
+      - JSHint`
+
+	tests := []testSpec{
+		{
+			"Named event",
+			"deploy",
+			nil,
+			[]string{"third_party/"},
+			[]string{"go vet", "JSHint"},
+		},
+		{
+			"Default event",
+			"default",
+			nil,
+			[]string{"third_party/"},
+			[]string{"go vet", "JSHint"},
+		},
+		{
+			"All event in a different case",
+			"all",
+			nil,
+			[]string{"third_party/"},
+			[]string{"go vet", "JSHint"},
+		},
+	}
+
+	for _, test := range tests {
+		if err := validateConfig(mustUnmarshalConfig(t, yaml)); err != nil {
+			t.Errorf("Unexpected error for %q: %v", test.label, err)
+		}
+		if failure := test.run(yaml); failure != nil {
+			t.Error(failure)
+		}
+	}
+}
+
+func TestAllEventMerged(t *testing.T) {
+	// Validation rejects this config, but buildConfig still merges the "All"
+	// categories into the event's, without repeating any.
+	rawCfg := &configpb.ShipshapeConfig{
+		Events: []*configpb.EventConfig{
+			{Event: proto.String("review"), Categories: []string{"JSHint", "PyLint"}},
+			{Event: proto.String("All"), Categories: []string{"pylint", "go vet"}},
+		},
+	}
+	cfg := buildConfig(rawCfg, "review")
+	if expect := []string{"JSHint", "PyLint", "go vet"}; !reflect.DeepEqual(cfg.categories, expect) {
+		t.Errorf("Incorrect categories: got %v, want %v", cfg.categories, expect)
+	}
+}
+
+func mustUnmarshalConfig(t *testing.T, yaml string) *configpb.ShipshapeConfig {
+	rawCfg, err := unmarshalConfigBytes([]byte(yaml))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return rawCfg
+}
+
+func TestConfigTimeouts(t *testing.T) {
+	yaml := `
+global:
+  timeouts:
+    - seconds: 600
+    - category: go vet
+      seconds: 30
+
+events:
+  - event: default
+    categories:
+      - go vet`
+
+	rawCfg, err := unmarshalConfigBytes([]byte(yaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateConfig(rawCfg); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+	cfg := buildConfig(rawCfg, "default")
+	expect := map[string]time.Duration{
+		"":       10 * time.Minute,
+		"go vet": 30 * time.Second,
+	}
+	if !reflect.DeepEqual(cfg.timeouts, expect) {
+		t.Errorf("Incorrect timeouts; got %v, expected %v", cfg.timeouts, expect)
+	}
+}
+
+func TestConfigOptions(t *testing.T) {
+	yaml := `
+global:
+  options:
+    - category: PyLint
+      settings:
+        - rcfile=tools/pylintrc
+    - category: go vet
+      settings:
+        - flags=-shadow -printf=false
+
+events:
+  - event: default
+    categories:
+      - go vet
+      - PyLint`
+
+	rawCfg, err := unmarshalConfigBytes([]byte(yaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateConfig(rawCfg); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+	cfg := buildConfig(rawCfg, "default")
+	expect := map[string][]string{
+		"PyLint": {"rcfile=tools/pylintrc"},
+		"go vet": {"flags=-shadow -printf=false"},
+	}
+	if !reflect.DeepEqual(cfg.options, expect) {
+		t.Errorf("Incorrect options; got %v, expected %v", cfg.options, expect)
+	}
+}
+
+func TestConfigSeverities(t *testing.T) {
+	yaml := `
+global:
+  severities:
+    - category: WordCount
+      severity: OTHER
+    - category: go vet
+      severity: build_error
+
+events:
+  - event: default
+    categories:
+      - go vet
+      - WordCount`
+
+	rawCfg, err := unmarshalConfigBytes([]byte(yaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateConfig(rawCfg); err != nil {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+	cfg := buildConfig(rawCfg, "default")
+	expect := map[string]notepb.Note_Severity{
+		"WordCount": notepb.Note_OTHER,
+		"go vet":    notepb.Note_BUILD_ERROR,
+	}
+	if !reflect.DeepEqual(cfg.severities, expect) {
+		t.Errorf("Incorrect severities; got %v, expected %v", cfg.severities, expect)
+	}
+}
+
 func TestValidYamlInvalidConfig(t *testing.T) {
 	tests := []struct {
 		label string
@@ -162,6 +344,137 @@ events:
       - Benchmark`,
 			errors.New("Multiple events with name \"review\" (indexes 0, 1)"),
 		},
+		{
+			"Multiple events with same name in different cases",
+			`
+events:
+  - event: review
+    categories:
+      - Loadtest
+  - event: Review
+    categories:
+      - Benchmark`,
+			errors.New("Multiple events with name \"review\" (indexes 0, 1)"),
+		},
+		{
+			"All event with another event",
+			`
+events:
+  - event: review
+    categories:
+      - Loadtest
+  - event: All
+    categories:
+      - Benchmark`,
+			errors.New("Event \"All\" applies to every run, so it must be the only event"),
+		},
+		{
+			"All event in a different case with the default event",
+			`
+events:
+  - event: all
+    categories:
+      - Loadtest
+  - event: default
+    categories:
+      - Benchmark`,
+			errors.New("Event \"All\" applies to every run, so it must be the only event"),
+		},
+		{
+			"Timeout with no seconds",
+			`
+global:
+  timeouts:
+    - category: go vet
+      seconds: 30
+    - category: JSHint`,
+			errors.New("Timeout at index 1 must be a positive number of seconds"),
+		},
+		{
+			"Options with no category",
+			`
+global:
+  options:
+    - settings:
+        - rcfile=pylintrc`,
+			errors.New("Options at index 0 are missing a category"),
+		},
+		{
+			"Multiple options for a category",
+			`
+global:
+  options:
+    - category: PyLint
+      settings:
+        - rcfile=pylintrc
+    - category: pylint
+      settings:
+        - jobs=4`,
+			errors.New("Multiple options for category \"pylint\" (indexes 0, 1)"),
+		},
+		{
+			"Setting with no name",
+			`
+global:
+  options:
+    - category: PyLint
+      settings:
+        - =pylintrc`,
+			errors.New("Setting \"=pylintrc\" must be of the form name=value"),
+		},
+		{
+			"Severity with no category",
+			`
+global:
+  severities:
+    - severity: OTHER`,
+			errors.New("Severity at index 0 is missing a category"),
+		},
+		{
+			"Unknown severity",
+			`
+global:
+  severities:
+    - category: WordCount
+      severity: INFO`,
+			errors.New("Severity \"INFO\" must be one of BUILD_ERROR, WARNING or OTHER"),
+		},
+		{
+			"Malformed ignore pattern",
+			`
+global:
+  ignore:
+    - third_party/
+    - "gen/[a-"`,
+			errors.New("Ignore entry at index 1 is invalid: \"gen/[a-\" is not a valid pattern: syntax error in pattern"),
+		},
+		{
+			"Path rule without a path",
+			`
+paths:
+  - enable:
+      - PyLint`,
+			errors.New("Path rule at index 0 is invalid: \"\" is empty"),
+		},
+		{
+			"Path rule with a negated pattern",
+			`
+paths:
+  - path: "!tools/"
+    enable:
+      - PyLint`,
+			errors.New("Path rule at index 0 cannot use a negated pattern"),
+		},
+		{
+			"Path rule without categories",
+			`
+paths:
+  - path: tools/
+    disable:
+      - PyLint
+  - path: third_party/`,
+			errors.New("Path rule at index 1 must enable or disable at least one category"),
+		},
 	}
 
 	for _, test := range tests {
@@ -202,3 +515,275 @@ func (ts *testSpec) run(yaml string) error {
 	}
 	return nil
 }
+
+func TestLoadNestedConfigs(t *testing.T) {
+	root, err := ioutil.TempDir("", "config_test")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	write := func(dir, content string) {
+		path := filepath.Join(root, dir, configFilename)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(".", "events:\n  - event: review\n    categories:\n      - JSHint\n")
+	write("web", "events:\n  - event: review\n    categories:\n      - PyLint\n")
+	write("web/legacy", "paths:\n  - path: old/\n    disable:\n      - PyLint\n")
+	write(".hidden", "events: [")
+
+	configs, err := loadNestedConfigs(root, "review", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var dirs []string
+	for _, n := range configs {
+		dirs = append(dirs, n.dir)
+	}
+	if want := []string{"web", "web/legacy"}; !reflect.DeepEqual(dirs, want) {
+		t.Errorf("Incorrect config directories: got %v, want %v", dirs, want)
+	}
+	if len(configs) == 2 {
+		if want := []string{"PyLint"}; !reflect.DeepEqual(configs[0].cfg.categories, want) {
+			t.Errorf("Incorrect categories for web: got %v, want %v", configs[0].cfg.categories, want)
+		}
+		if got := len(configs[1].cfg.paths); got != 1 {
+			t.Errorf("Incorrect number of path rules for web/legacy: got %d, want 1", got)
+		}
+	}
+
+	write("lib", "global:\n  images:\n    - foo/bar:prod\n")
+	if _, err := loadNestedConfigs(root, "review", nil); err == nil {
+		t.Error("Expected an error for global settings in a nested config")
+	}
+}
+
+func TestLoadNestedConfigsIgnored(t *testing.T) {
+	root, err := ioutil.TempDir("", "config_test")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	write := func(dir, content string) {
+		path := filepath.Join(root, dir, configFilename)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("web", "events:\n  - event: review\n    categories:\n      - PyLint\n")
+	write("third_party/lib", "events: [")
+	write("third_party/other", "global:\n  images:\n    - foo/bar:prod\n")
+	write("gen", "events: [")
+
+	tests := []struct {
+		label  string
+		ignore []string
+		expect []string
+	}{
+		{
+			"Invalid configs in ignored directories are skipped",
+			[]string{"third_party/", "gen/.shipshape"},
+			[]string{"web"},
+		},
+		{
+			"Negated patterns re-include configs",
+			[]string{"third_party/", "!third_party/other/", "gen/"},
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		configs, err := loadNestedConfigs(root, "review", test.ignore)
+		if test.expect == nil {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.label)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.label, err)
+			continue
+		}
+		var dirs []string
+		for _, n := range configs {
+			dirs = append(dirs, n.dir)
+		}
+		if !reflect.DeepEqual(dirs, test.expect) {
+			t.Errorf("%s: got config directories %v, want %v", test.label, dirs, test.expect)
+		}
+	}
+}
+
+func TestReadConfigErrors(t *testing.T) {
+	tests := []struct {
+		label  string
+		yaml   string
+		expect []string
+	}{
+		{
+			"Every problem is reported",
+			`
+global:
+  timeouts:
+    - category: go vet
+      seconds: 0
+events:
+  - categories:
+      - JSHint
+  - event: review
+    categories:
+      - go vet
+  - event: review
+    categorys:
+      - PyLint
+`,
+			[]string{
+				".shipshape:4:5: Timeout at index 0 must be a positive number of seconds",
+				".shipshape:7:3: Event at index 0 is missing an event name",
+				".shipshape:12:3: Event \"review\" must specify at least one category",
+				".shipshape:12:5: Multiple events with name \"review\" (indexes 1, 2)",
+				".shipshape:13:5: Unknown key \"categorys\"",
+			},
+		},
+		{
+			"YAML syntax error",
+			"events:\n  - event: [review\n",
+			[]string{".shipshape:2: did not find expected ',' or ']'"},
+		},
+		{
+			"YAML type error",
+			"events:\n  - event: review\n    categories: JSHint\n",
+			[]string{".shipshape:3: cannot unmarshal !!str `JSHint` into []string"},
+		},
+	}
+
+	for _, test := range tests {
+		root, err := ioutil.TempDir("", "config_test")
+		if err != nil {
+			t.Fatalf("Could not create temp dir: %v", err)
+		}
+		defer os.RemoveAll(root)
+		if err := ioutil.WriteFile(filepath.Join(root, configFilename), []byte(test.yaml), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = readConfig(root, configFilename)
+		errs, ok := err.(configErrors)
+		if !ok {
+			t.Errorf("%s: expected configErrors, got %v", test.label, err)
+			continue
+		}
+		var got []string
+		for _, e := range errs {
+			got = append(got, e.Error())
+		}
+		if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("%s: incorrect errors:\n got %q\nwant %q", test.label, got, test.expect)
+		}
+	}
+}
+
+func TestUnknownCategories(t *testing.T) {
+	yaml := `
+global:
+  timeouts:
+    - seconds: 10
+    - category: Lint
+      seconds: 30
+events:
+  - event: review
+    categories:
+      - jshint
+      - Bogus
+paths:
+  - path: tools/
+    enable:
+      - pylint
+    disable:
+      - Other
+      - PyLnt
+`
+	rawCfg, err := unmarshalConfigBytes([]byte(yaml))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cfg := buildConfig(rawCfg, "review")
+	cfg.file, cfg.positions = configFilename, indexYAML(yaml)
+
+	var got []string
+	for _, e := range cfg.unknownCategories(strset.New("JSHint", "PyLint")) {
+		got = append(got, e.Error())
+	}
+	expect := []string{
+		".shipshape:5:7: Unknown category \"Lint\"; did you mean \"PyLint\"?",
+		".shipshape:11:7: Unknown category \"Bogus\"",
+		".shipshape:17:7: Unknown category \"Other\"",
+		".shipshape:18:7: Unknown category \"PyLnt\"; did you mean \"PyLint\"?",
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Incorrect errors:\n got %q\nwant %q", got, expect)
+	}
+}
+
+func TestValidateConfigFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "config_test")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+	writeFiles(t, root, map[string]string{
+		configFilename:                       "events:\n  - event: review\n    categories:\n      - JSHint\n      - Bogus\n",
+		filepath.Join("sub", configFilename): "events:\n  - categories:\n      - JSHint\n",
+	})
+
+	notes, err := ValidateConfig(root, []string{"JSHint"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var got []string
+	for _, note := range notes {
+		r := note.GetLocation().GetRange()
+		got = append(got, fmt.Sprintf("%s:%d:%d: %s", note.GetLocation().GetPath(), r.GetStartLine(), r.GetStartColumn(), note.GetDescription()))
+	}
+	expect := []string{
+		".shipshape:5:7: Unknown category \"Bogus\"",
+		"sub/.shipshape:2:3: Event at index 0 is missing an event name",
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Incorrect problems:\n got %q\nwant %q", got, expect)
+	}
+	for _, note := range notes {
+		if note.GetSeverity() != notepb.Note_WARNING {
+			t.Errorf("Incorrect severity for %q: got %v, want WARNING", note.GetDescription(), note.GetSeverity())
+		}
+	}
+
+	// An analyzer image can provide the unknown category.
+	writeFiles(t, root, map[string]string{
+		configFilename: "global:\n  images:\n    - foo/bar:prod\nevents:\n  - event: review\n    categories:\n      - Bogus\n",
+	})
+	notes, err = ValidateConfig(root, []string{"JSHint"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	severities := make(map[string]notepb.Note_Severity)
+	for _, note := range notes {
+		severities[note.GetDescription()] = note.GetSeverity()
+	}
+	expectSeverities := map[string]notepb.Note_Severity{
+		"Unknown category \"Bogus\"":                notepb.Note_OTHER,
+		"Event at index 0 is missing an event name": notepb.Note_WARNING,
+	}
+	if !reflect.DeepEqual(severities, expectSeverities) {
+		t.Errorf("Incorrect severities with analyzer images: got %v, want %v", severities, expectSeverities)
+	}
+}
@@ -17,42 +17,54 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/google/shipshape/shipshape/util/defaults"
-	"github.com/google/shipshape/shipshape/util/file"
 	"github.com/google/shipshape/shipshape/util/rpc/client"
 	"github.com/google/shipshape/shipshape/util/rpc/server"
 	strset "github.com/google/shipshape/shipshape/util/strings"
-	//	"kythe.io/kythe/go/platform/kindex"
+	"github.com/google/shipshape/third_party/kythe/go/platform/kindex"
 
 	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+	configpb "github.com/google/shipshape/shipshape/proto/shipshape_config_proto"
 	contextpb "github.com/google/shipshape/shipshape/proto/shipshape_context_proto"
+	reporterpb "github.com/google/shipshape/shipshape/proto/shipshape_reporter_proto"
 	rpcpb "github.com/google/shipshape/shipshape/proto/shipshape_rpc_proto"
-	//	apb "kythe.io/kythe/proto/analysis_proto"
+	apb "github.com/google/shipshape/third_party/kythe/proto/analysis_proto"
 )
 
 const (
 	// How long to wait for an analyzer service to become healthy.
 	analyzerHealthTimeout = 30 * time.Second
-	configFilename        = ".shipshape"
-	compilationsDir       = "compilations"
-	sourceContainer       = "shipping_container"
+	// How long to wait for an analyzer service to analyze, if no timeout is configured.
+	defaultAnalyzerTimeout = 20 * time.Minute
+	configFilename         = ".shipshape"
+	compilationsDir        = "compilations"
+	sourceContainer        = "shipping_container"
 )
 
 var (
-	clients = make(map[string]*client.Client)
+	clients   = make(map[string]*client.Client)
+	clientsMu sync.Mutex
+	// How long each report to the reporters may take, so that a slow reporter does not
+	// hold up the analysis.
+	reportTimeout = 10 * time.Second
 )
 
 type ShipshapeDriver struct {
 	AnalyzerLocations []string
+	// ReporterLocations are the addresses of Reporter services that should be kept
+	// up to date with the status and notes of each category as analysis progresses.
+	ReporterLocations []string
 	// serviceMap is a mapping from analyzer locations to the categories they have available
 	// and the stage they should be run at.
 	// The range of serviceMap is the same as AnalyzerLocations
@@ -67,14 +79,23 @@ type serviceInfo struct {
 }
 
 // NewDriver creates a new driver with with the analyzers at the
-// specified locations. This func makes no rpcs.
-func NewDriver(analyzerLocations []string, defaultCategories strset.Set) *ShipshapeDriver {
-	var addrs []string
+// specified locations, which will report its progress to the reporters
+// at the specified locations. This func makes no rpcs.
+func NewDriver(analyzerLocations []string, defaultCategories strset.Set, reporterLocations []string) *ShipshapeDriver {
+	return &ShipshapeDriver{
+		AnalyzerLocations: trimAddrs(analyzerLocations),
+		ReporterLocations: trimAddrs(reporterLocations),
+		defaultCategories: defaultCategories,
+	}
+}
 
-	for _, addr := range analyzerLocations {
+// trimAddrs removes the http:// scheme, if present, from each of the addresses.
+func trimAddrs(locations []string) []string {
+	var addrs []string
+	for _, addr := range locations {
 		addrs = append(addrs, strings.TrimPrefix(addr, "http://"))
 	}
-	return &ShipshapeDriver{AnalyzerLocations: addrs, defaultCategories: defaultCategories}
+	return addrs
 }
 
 // NewTestDriver is only for testing. It creates a ShipshapeDriver
@@ -99,72 +120,96 @@ func (sd ShipshapeDriver) GetCategory(ctx server.Context, in *rpcpb.GetCategoryR
 }
 
 // Run runs the analyzers that this driver knows about on the provided ShipshapeRequest,
-// taking configuration into account.
+// taking configuration into account. Results are streamed back on out as they become
+// available: each analyzer service's AnalyzeResponse is sent as its own ShipshapeResponse
+// as soon as that service finishes, rather than waiting for all of them.
 func (sd ShipshapeDriver) Run(ctx server.Context, in *rpcpb.ShipshapeRequest, out chan<- *rpcpb.ShipshapeResponse) error {
-	var ars []*rpcpb.AnalyzeResponse
 	log.Printf("Received analysis request for event %v, stage %v, categories %v, repo %v", *in.Event, *in.Stage, in.TriggeredCategory, *in.ShipshapeContext.RepoRoot)
 
-	// However we exit, send back the set of collected AnalyzeResponses
-	// TODO(ciera): we should be streaming back the responses, not sending them all at the end.
-	defer func() {
-		out <- &rpcpb.ShipshapeResponse{
-			AnalyzeResponse: ars,
-		}
-	}()
-
 	if in.ShipshapeContext.RepoRoot == nil {
 		return fmt.Errorf("No repo root was set")
 	}
-	root := *in.ShipshapeContext.RepoRoot
-
-	// cd into the root directory
-	orgDir, restore, err := file.ChangeDir(root)
+	// Resolve everything against an absolute root, rather than changing into it, so that
+	// concurrent requests for different repos do not interfere with each other.
+	root, err := filepath.Abs(*in.ShipshapeContext.RepoRoot)
 	if err != nil {
-		log.Printf("Could not change into directory %s from base %s", root, orgDir)
-		ars = append(ars, generateFailure("Driver setup", fmt.Sprint(err)))
+		log.Printf("Could not find absolute path of %s: %v", *in.ShipshapeContext.RepoRoot, err)
+		sendResponses(out, generateFailure("Driver setup", fmt.Sprint(err)))
 		return err
 	}
-	defer func() {
-		if err := restore(); err != nil {
-			log.Printf("could not return back into %s from %s: %v", orgDir, root, err)
-		}
-	}()
 
-	cfg, err := loadConfig(configFilename, *in.Event)
+	cfg, err := loadConfig(root, *in.Event)
 	if err != nil {
-		log.Print("error loading config")
-		// TODO(collinwinter): attach the error to the config file.
-		ars = append(ars, generateFailure("Driver setup", err.Error()))
+		log.Printf("error loading config: %v", err)
+		sendResponses(out, configFailure(err))
 		return err
 	}
 
 	// Get the list of all categories
 	sd.serviceMap = sd.getAllServiceInfo()
 	allCats := sd.allCats()
+	// Categories are matched ignoring case, so use the analyzers' names throughout.
+	names := newCategoryNames(allCats)
+	cfg.canonicalize(names)
 
 	// Use the triggered categories if specified
 	var desiredCats strset.Set
 	if len(in.TriggeredCategory) > 0 {
-		desiredCats = strset.New(in.TriggeredCategory...)
+		desiredCats = strset.New(names.canonicalSlice(in.TriggeredCategory)...)
 	} else if cfg != nil {
 		desiredCats = strset.New(cfg.categories...)
 		if len(desiredCats) > 0 {
-			log.Printf("Running with categories from .shipshape file: %s" + desiredCats.String())
-		} else if *in.Event != defaults.DefaultEvent {
+			log.Printf("Running with categories from .shipshape file: %s", desiredCats.String())
+		} else if !strings.EqualFold(*in.Event, defaults.DefaultEvent) {
 			return fmt.Errorf("No categories configured for event %s", *in.Event)
 		}
 	}
 
 	if len(desiredCats) == 0 {
 		log.Printf("No categories specified, running with default categories: %s", sd.defaultCategories.String())
-		desiredCats = sd.defaultCategories
+		desiredCats = names.canonicalSet(sd.defaultCategories)
+	}
+
+	// TODO(ciera): move this global ignore stuff into the CLI processing
+	ignorePaths := []string{}
+	if cfg != nil {
+		ignorePaths = cfg.ignore
+	}
+
+	// Narrow down the categories for parts of the repo, according to the path rules and
+	// the .shipshape files in subdirectories.
+	nested, err := loadNestedConfigs(root, *in.Event, ignorePaths)
+	if err != nil {
+		log.Printf("Could not load nested config: %v", err)
+		sendResponses(out, configFailure(err))
+		return err
+	}
+	for _, n := range nested {
+		n.cfg.canonicalize(names)
+	}
+	// Point out the categories in the config files that no analyzer provides. This is
+	// not fatal, since an analyzer may just be unavailable for this run.
+	unknown := cfg.unknownCategories(allCats)
+	for _, n := range nested {
+		unknown = append(unknown, n.cfg.unknownCategories(allCats)...)
+	}
+	if len(unknown) > 0 {
+		sendResponses(out, &rpcpb.AnalyzeResponse{Note: unknown.notes()})
+	}
+	paths := newPathCategories(desiredCats, len(in.TriggeredCategory) > 0, cfg, nested)
+	if paths != nil {
+		desiredCats = paths.all()
 	}
 
 	// Find out what categories we have available, and remove/warn on the missing ones
 	missingCats := strset.New().AddSet(desiredCats).RemoveSet(allCats)
-	for missing := range missingCats {
-		ars = append(ars, generateFailure(missing, fmt.Sprintf("The triggered category %q could not be found at the locations %v", missing, sd.AnalyzerLocations)))
+	var missing []*rpcpb.AnalyzeResponse
+	for cat := range missingCats {
+		msg := fmt.Sprintf("The triggered category %q could not be found at the locations %v%s", cat, sd.AnalyzerLocations, names.didYouMean(cat))
+		missing = append(missing, generateFailure(cat, msg))
+		sd.reportStatus([]string{cat}, reporterpb.AnalyzerStatus_FAILED, msg)
 	}
+	sendResponses(out, missing...)
 	desiredCats = desiredCats.RemoveSet(missingCats)
 
 	if len(desiredCats) == 0 {
@@ -172,19 +217,38 @@ func (sd ShipshapeDriver) Run(ctx server.Context, in *rpcpb.ShipshapeRequest, ou
 		return nil
 	}
 
-	// TODO(ciera): move this global ignore stuff into the CLI processing
-	ignorePaths := []string{}
+	opts := analysisOptions{timeouts: names.canonicalTimeouts(analyzerTimeouts(cfg, in.AnalyzerTimeout)), paths: paths}
 	if cfg != nil {
-		ignorePaths = cfg.ignore
+		opts.settings = cfg.options
+		opts.severities = cfg.severities
+	}
+	opts.changes, err = findChangedLines(root, in.ShipshapeContext.ChangelistDetails, in.GetChangedLinesMode())
+	if err != nil {
+		log.Printf("Could not find the changed lines: %v", err)
+		sendResponses(out, generateFailure("Driver setup", fmt.Sprint(err)))
+		return err
 	}
 	// Fill in the file_paths if they are empty in the context
 	context := proto.Clone(in.ShipshapeContext).(*contextpb.ShipshapeContext)
+	context.RepoRoot = proto.String(root)
 	context.FilePath, err = retrieveAndFilterFiles(*context.RepoRoot, context.FilePath, ignorePaths)
 	if err != nil {
 		log.Printf("Had problems accessing files: %v", err.Error())
-		ars = append(ars, generateFailure("Driver setup", fmt.Sprint(err)))
+		sendResponses(out, generateFailure("Driver setup", fmt.Sprint(err)))
 		return err
 	}
+	// Files deleted by the changelist cannot be analyzed.
+	deleted := strset.New(context.GetChangelistDetails().GetDeletedFilePath()...)
+	if opts.changes != nil {
+		deleted.AddSet(opts.changes.deleted)
+	}
+	var existing []string
+	for _, path := range context.FilePath {
+		if !deleted.Contains(path) {
+			existing = append(existing, path)
+		}
+	}
+	context.FilePath = existing
 	if len(context.FilePath) == 0 {
 		log.Print("No files to run on, doing nothing")
 		return nil
@@ -199,32 +263,64 @@ func (sd ShipshapeDriver) Run(ctx server.Context, in *rpcpb.ShipshapeRequest, ou
 
 	log.Printf("Analyzing stage %s", stage.String())
 	if stage == contextpb.Stage_PRE_BUILD {
-		ars = append(ars, sd.callAllAnalyzers(desiredCats, context, stage)...)
-	} /*else {
+		for ar := range sd.callAllAnalyzers(desiredCats, context, stage, opts) {
+			sendResponses(out, ar)
+		}
+	} else {
 		comps := filepath.Join(*context.RepoRoot, compilationsDir)
-		compUnits, err := findCompilationUnits(comps)
+		compUnits, invalid, err := findCompilationUnits(comps)
 		log.Printf("Found %d compUnits at %s", len(compUnits), comps)
 		if err != nil {
 			log.Printf("Could not retrieve compilation units: %v", err)
-			ars = append(ars, generateFailure("Driver setup", err.Error()))
+			sendResponses(out, generateFailure("Driver setup", err.Error()))
 			return nil
 		}
-		for path, compUnit := range compUnits {
-			context.CompilationDetails = &contextpb.CompilationDetails{
-				CompilationUnit:            compUnit,
+		var failures []*rpcpb.AnalyzeResponse
+		var invalidPaths []string
+		for path := range invalid {
+			invalidPaths = append(invalidPaths, path)
+		}
+		sort.Strings(invalidPaths)
+		for _, path := range invalidPaths {
+			log.Printf("Skipping invalid compilation unit at %s: %v", path, invalid[path])
+			failures = append(failures, generateFailure("Driver setup", fmt.Sprintf("could not open kindex file %s: %v", path, invalid[path])))
+		}
+		sendResponses(out, failures...)
+
+		// Analyze the compilation units in a stable order across runs.
+		var compPaths []string
+		for path := range compUnits {
+			compPaths = append(compPaths, path)
+		}
+		sort.Strings(compPaths)
+		for _, path := range compPaths {
+			compContext := proto.Clone(context).(*contextpb.ShipshapeContext)
+			compContext.CompilationDetails = &contextpb.CompilationDetails{
+				CompilationUnit:            compUnits[path],
 				CompilationDescriptionPath: proto.String(path),
 			}
 			log.Printf("Calling services with comp unit at %s", path)
-			ars = append(ars, sd.callAllAnalyzers(desiredCats, context, stage)...)
+			for ar := range sd.callAllAnalyzers(desiredCats, compContext, stage, opts) {
+				sendResponses(out, ar)
+			}
 		}
-
 	}
-	*/
 
 	log.Print("Analysis completed")
 	return nil
 }
 
+// sendResponses streams the given AnalyzeResponses back to the caller as a single
+// ShipshapeResponse. It does nothing if there are no responses to send.
+func sendResponses(out chan<- *rpcpb.ShipshapeResponse, ars ...*rpcpb.AnalyzeResponse) {
+	if len(ars) == 0 {
+		return
+	}
+	out <- &rpcpb.ShipshapeResponse{
+		AnalyzeResponse: ars,
+	}
+}
+
 // WaitForAnalyzers witll wait for all the given analyzers to become healthy
 // That is, their service is up and ready to serve requests.
 // Returns a mapping of which analyzers had which errors.
@@ -246,7 +342,8 @@ func WaitForAnalyzers(analyzerList []string) map[string]error {
 }
 
 // retrieveAndFilter files returns a list of files (initiated with files if that is non-empty,
-// or from recursing on root if it is) and removes the ones in the ignore list.
+// or from recursing on root if it is) and removes the ones in the ignore list. Entries of the
+// form "file=<path>" in the ignore list import the patterns of a gitignore file.
 func retrieveAndFilterFiles(root string, files []string, ignore []string) ([]string, error) {
 	if len(files) == 0 {
 		log.Printf("No files, getting some")
@@ -257,6 +354,10 @@ func retrieveAndFilterFiles(root string, files []string, ignore []string) ([]str
 		}
 	}
 
+	ignore, err := expandIgnoreEntries(root, ignore)
+	if err != nil {
+		return nil, err
+	}
 	return filterPaths(ignore, files), nil
 }
 
@@ -291,77 +392,194 @@ func collectAllFiles(root string) ([]string, error) {
 	return paths, nil
 }
 
-// filterPaths drops paths that fall under one of the given directories to ignore.
-// All directory names are assumed to end with /.
-func filterPaths(ignoreDirs []string, filePaths []string) []string {
+// filterPaths drops paths that match the given ignore entries. See compileIgnorePattern
+// for the syntax of the entries.
+func filterPaths(ignore []string, filePaths []string) []string {
+	rules := compileIgnoreRules(ignore)
 	var keepPaths []string
-nextFile:
 	for _, file := range filePaths {
-		for _, dir := range ignoreDirs {
-			if strings.HasPrefix(file, dir) {
-				continue nextFile
-			}
+		if !rules.ignored(filepath.ToSlash(file)) {
+			keepPaths = append(keepPaths, file)
 		}
-		keepPaths = append(keepPaths, file)
 	}
 	return keepPaths
 }
 
+// analyzerTimeouts merges the timeouts from the configuration with the ones from the request,
+// with the request taking precedence. The empty category holds the timeout for all other categories.
+func analyzerTimeouts(cfg *config, reqTimeouts []*configpb.TimeoutConfig) map[string]time.Duration {
+	timeouts := make(map[string]time.Duration)
+	if cfg != nil {
+		for cat, timeout := range cfg.timeouts {
+			timeouts[cat] = timeout
+		}
+	}
+	for _, t := range reqTimeouts {
+		if t.GetSeconds() > 0 {
+			timeouts[t.GetCategory()] = time.Duration(t.GetSeconds()) * time.Second
+		}
+	}
+	return timeouts
+}
+
+// categoryTimeout returns how long to wait for the analyzer of the given category.
+func categoryTimeout(timeouts map[string]time.Duration, cat string) time.Duration {
+	if timeout, ok := timeouts[cat]; ok {
+		return timeout
+	}
+	if timeout, ok := timeouts[""]; ok {
+		return timeout
+	}
+	return defaultAnalyzerTimeout
+}
+
+// requestTimeouts returns the timeouts for the given categories, to send to their analyzer
+// service, which stops waiting for each category once its own timeout passes. Timeouts are
+// sent in whole seconds, rounded up.
+func requestTimeouts(timeouts map[string]time.Duration, cats strset.Set) []*configpb.TimeoutConfig {
+	var result []*configpb.TimeoutConfig
+	for _, cat := range sortedCategories(cats) {
+		seconds := (categoryTimeout(timeouts, cat) + time.Second - 1) / time.Second
+		result = append(result, &configpb.TimeoutConfig{Category: proto.String(cat), Seconds: proto.Int32(int32(seconds))})
+	}
+	return result
+}
+
+// serviceTimeout returns how long to wait for the call to an analyzer service that is running
+// the given categories. The service applies the timeout of each category itself, so this is
+// only a backstop, for services that do not: the longest of the timeouts of the categories.
+func serviceTimeout(timeouts map[string]time.Duration, cats strset.Set) time.Duration {
+	var longest time.Duration
+	for cat := range cats {
+		if timeout := categoryTimeout(timeouts, cat); timeout > longest {
+			longest = timeout
+		}
+	}
+	return longest
+}
+
+// analysisOptions holds the settings for a run that apply to every call to an analyzer service.
+type analysisOptions struct {
+	// timeouts maps categories to how long to wait for their analyzers, as returned by
+	// analyzerTimeouts.
+	timeouts map[string]time.Duration
+	// changes limits the notes to the lines touched by a changelist. If nil, all notes are kept.
+	changes *changedLines
+	// paths decides which categories run on which files. If nil, all categories run on all files.
+	paths *pathCategories
+	// settings maps categories to the settings for their analyzers, from the config.
+	settings map[string][]string
+	// severities maps categories to the severity their notes get, from the config.
+	severities map[string]notepb.Note_Severity
+}
+
+// categoryOptions returns the settings for the given categories, to send to their
+// analyzers. Categories without settings are left out.
+func categoryOptions(settings map[string][]string, cats strset.Set) []*configpb.CategoryOptions {
+	var options []*configpb.CategoryOptions
+	for _, cat := range sortedCategories(cats) {
+		if s, ok := settings[cat]; ok {
+			options = append(options, &configpb.CategoryOptions{Category: proto.String(cat), Settings: s})
+		}
+	}
+	return options
+}
+
 // callAllAnalyzers loops through the analyzer services, determines whether analyze should be called
-// on each, and then calls it with the appropriate set of files and categories.
-// It takes the configuration and the original context, and returns a slice of AnalyzeResponses.
-func (sd ShipshapeDriver) callAllAnalyzers(desiredCats strset.Set, context *contextpb.ShipshapeContext, stage contextpb.Stage) []*rpcpb.AnalyzeResponse {
-	var ars []*rpcpb.AnalyzeResponse
-	var chans []chan *rpcpb.AnalyzeResponse
+// on each, and then calls it with the appropriate set of files, categories and timeouts. The
+// service stops each category at its own timeout, and the call is given up on if the service
+// takes longer than the longest of them.
+// It takes the configuration and the original context, and returns a channel on which each
+// service's filtered AnalyzeResponse is sent as soon as that service finishes. The channel is
+// closed once every called service has responded.
+func (sd ShipshapeDriver) callAllAnalyzers(desiredCats strset.Set, context *contextpb.ShipshapeContext, stage contextpb.Stage, opts analysisOptions) <-chan *rpcpb.AnalyzeResponse {
+	var wg sync.WaitGroup
+	out := make(chan *rpcpb.AnalyzeResponse)
 	for analyzer, info := range sd.serviceMap {
 		if info.stage != stage {
 			continue
 		}
 		cats := info.categories.Intersect(desiredCats)
+		files := opts.paths.filesFor(cats, context.FilePath)
 
-		log.Printf("Analyzer %s filtered to categories %v and files %v", analyzer, cats, context.FilePath)
+		log.Printf("Analyzer %s filtered to categories %v and files %v", analyzer, cats, files)
 
-		// If there are any categories to run on for this analyzer service,
+		// If there are any categories and files to run on for this analyzer service,
 		// go ahead and call analyze
-		if len(cats) > 0 {
-			c := make(chan *rpcpb.AnalyzeResponse)
-			chans = append(chans, c)
+		if len(cats) > 0 && len(files) > 0 {
+			wg.Add(1)
+			serviceContext := context
+			if len(files) < len(context.FilePath) {
+				serviceContext = proto.Clone(context).(*contextpb.ShipshapeContext)
+				serviceContext.FilePath = files
+			}
 			req := &rpcpb.AnalyzeRequest{
-				ShipshapeContext: context,
+				ShipshapeContext: serviceContext,
 				Category:         cats.ToSlice(),
+				Options:          categoryOptions(opts.settings, cats),
+				Timeout:          requestTimeouts(opts.timeouts, cats),
 			}
-			go callAnalyze(analyzer, req, c)
+			go func(analyzer string, cats strset.Set) {
+				defer wg.Done()
+				sd.reportStatus(req.Category, reporterpb.AnalyzerStatus_RUNNING, "")
+				c := make(chan *rpcpb.AnalyzeResponse, 1)
+				callAnalyze(analyzer, req, serviceTimeout(opts.timeouts, cats), c)
+				ar := filterResults(serviceContext, <-c, opts)
+				sd.reportResults(cats, ar)
+				out <- ar
+			}(analyzer, cats)
 		}
 	}
 
-	// Collect up all the responses where we actually called analyze
-	for _, c := range chans {
-		ar := <-c
-		ars = append(ars, filterResults(context, ar))
-	}
-	return ars
+	// Close the channel once every service we actually called analyze on has responded
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
 }
 
 // filterResults removes any notes where the category is nil, the category is not specified for
 // the file path by the configuration, or there is no location with a source context.
 // The config category and internal failure category cannot be turned off.
-func filterResults(context *contextpb.ShipshapeContext, response *rpcpb.AnalyzeResponse) *rpcpb.AnalyzeResponse {
+// The remaining notes get the severities configured for their categories, and if opts.changes
+// is not nil, notes outside of the changed lines are then dropped or demoted.
+func filterResults(context *contextpb.ShipshapeContext, response *rpcpb.AnalyzeResponse, opts analysisOptions) *rpcpb.AnalyzeResponse {
 	files := strset.New(context.FilePath...)
 	var keep []*notepb.Note
 	for _, note := range response.Note {
-		if note.Category != nil {
-			if note.Location != nil && (note.Location.Path == nil || files.Contains(*note.Location.Path)) {
+		if note.Category != nil && note.Location != nil {
+			if note.Location.Path == nil {
+				keep = append(keep, note)
+			} else if files.Contains(*note.Location.Path) && opts.paths.allows(*note.Location.Path, *note.Category) {
 				keep = append(keep, note)
 			}
 		}
 	}
 
 	return &rpcpb.AnalyzeResponse{
-		Note:    keep,
+		Note:    opts.changes.filter(overrideSeverities(keep, opts.severities)),
 		Failure: response.Failure,
 	}
 }
 
+// overrideSeverities gives the notes the severities configured for their categories.
+// The notes are copied rather than changed.
+func overrideSeverities(notes []*notepb.Note, severities map[string]notepb.Note_Severity) []*notepb.Note {
+	if len(severities) == 0 {
+		return notes
+	}
+	overridden := make([]*notepb.Note, len(notes))
+	for i, note := range notes {
+		overridden[i] = note
+		if severity, ok := severities[note.GetCategory()]; ok && severity != note.GetSeverity() {
+			overridden[i] = proto.Clone(note).(*notepb.Note)
+			overridden[i].Severity = severity.Enum()
+		}
+	}
+	return overridden
+}
+
 // allCats returns the entire set of categories for the driver, across all analyzers
 func (sd ShipshapeDriver) allCats() strset.Set {
 	var catSet = strset.New()
@@ -420,12 +638,30 @@ func callGetAnalyzerInfo(analyzer string, out chan<- serviceInfo) {
 }
 
 // callAnalyze attempts to call analyze for the specified analyzer with the given request.
-// If anything goes wrong, it puts an AnalysisFailure into the AnalyzeResponse.
-func callAnalyze(analyzer string, req *rpcpb.AnalyzeRequest, out chan<- *rpcpb.AnalyzeResponse) {
+// If the analyzer does not respond within the timeout, the request is cancelled and every
+// requested category gets an AnalysisFailure saying so. If anything else goes wrong, it puts
+// an AnalysisFailure into the AnalyzeResponse.
+func callAnalyze(analyzer string, req *rpcpb.AnalyzeRequest, timeout time.Duration, out chan<- *rpcpb.AnalyzeResponse) {
 	httpClient := getHTTPClient(analyzer)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 	var resp rpcpb.AnalyzeResponse
-	err := httpClient.Call("/AnalyzerService/Analyze", req, &resp)
-	if err != nil {
+	err := httpClient.CallContext(ctx, "/AnalyzerService/Analyze", req, &resp)
+	switch {
+	case err == nil:
+		// A response that made it in just as the deadline passed still counts.
+		out <- &resp
+	case ctx.Err() == context.DeadlineExceeded:
+		log.Printf("Analyzer %s timed out after %v", analyzer, timeout)
+		var failures []*rpcpb.AnalysisFailure
+		for _, cat := range req.Category {
+			failures = append(failures, &rpcpb.AnalysisFailure{
+				Category:       proto.String(cat),
+				FailureMessage: proto.String(fmt.Sprintf("Analyzer %s timed out after %v", analyzer, timeout)),
+			})
+		}
+		out <- &rpcpb.AnalyzeResponse{Failure: failures}
+	default:
 		out <- &rpcpb.AnalyzeResponse{
 			Failure: []*rpcpb.AnalysisFailure{
 				&rpcpb.AnalysisFailure{
@@ -433,37 +669,37 @@ func callAnalyze(analyzer string, req *rpcpb.AnalyzeRequest, out chan<- *rpcpb.A
 				},
 			},
 		}
-	} else {
-		out <- &resp
 	}
 }
 
 // findCompilationUnits takes a path which contains compilation units, and recursively
 // retrieves all the compilation units from it. Currently, kythe puts the compilation units
 // in directories by language. Returns a mapping from the path to the kindex file and the
-// compilation unit found within it.
-/*
-func findCompilationUnits(dir string) (map[string]*apb.CompilationUnit, error) {
+// compilation unit found within it, along with a mapping from the path of each kindex file
+// that could not be opened to the reason why. Only a failure to walk dir is returned as an error.
+func findCompilationUnits(dir string) (map[string]*apb.CompilationUnit, map[string]error, error) {
 	var units = make(map[string]*apb.CompilationUnit)
+	var invalid = make(map[string]error)
 	walkpath := func(path string, file os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		if strings.HasSuffix(file.Name(), ".kindex") {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), kindex.Extension) {
 			info, err := kindex.Open(path)
 			if err != nil {
-				return fmt.Errorf("could not open kindex file %s: %v", path, err)
+				invalid[path] = err
+				return nil
 			}
 			units[path] = info.Proto
 		}
 		return nil
 	}
 	if err := filepath.Walk(dir, walkpath); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return units, nil
+	return units, invalid, nil
 }
-*/
+
 // generateFailure creates a response with an analysis failure containing the given
 // category and message
 func generateFailure(cat string, message string) *rpcpb.AnalyzeResponse {
@@ -479,6 +715,8 @@ func generateFailure(cat string, message string) *rpcpb.AnalyzeResponse {
 
 // getHTTPClient provides a (cached) HTTPClient for the address specified.
 func getHTTPClient(addr string) *client.Client {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
 	httpClient, exists := clients[addr]
 	if !exists {
 		clients[addr] = client.NewHTTPClient(addr)
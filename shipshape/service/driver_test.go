@@ -18,9 +18,14 @@ package service
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/google/shipshape/shipshape/util/rpc/server"
@@ -28,7 +33,9 @@ import (
 	testutil "github.com/google/shipshape/shipshape/util/test"
 
 	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+	configpb "github.com/google/shipshape/shipshape/proto/shipshape_config_proto"
 	ctxpb "github.com/google/shipshape/shipshape/proto/shipshape_context_proto"
+	reporterpb "github.com/google/shipshape/shipshape/proto/shipshape_reporter_proto"
 	rpcpb "github.com/google/shipshape/shipshape/proto/shipshape_rpc_proto"
 )
 
@@ -73,6 +80,85 @@ func (f fakeDispatcher) Analyze(ctx server.Context, in *rpcpb.AnalyzeRequest) (*
 	}, nil
 }
 
+// postBuildDispatcher produces a note for every compilation unit it is called with.
+type postBuildDispatcher struct {
+	category string
+}
+
+func (p postBuildDispatcher) GetCategory(ctx server.Context, in *rpcpb.GetCategoryRequest) (*rpcpb.GetCategoryResponse, error) {
+	return &rpcpb.GetCategoryResponse{
+		Category: []string{p.category},
+	}, nil
+}
+
+func (postBuildDispatcher) GetStage(ctx server.Context, in *rpcpb.GetStageRequest) (*rpcpb.GetStageResponse, error) {
+	return &rpcpb.GetStageResponse{
+		Stage: ctxpb.Stage_POST_BUILD.Enum(),
+	}, nil
+}
+
+func (p postBuildDispatcher) Analyze(ctx server.Context, in *rpcpb.AnalyzeRequest) (*rpcpb.AnalyzeResponse, error) {
+	details := in.ShipshapeContext.GetCompilationDetails()
+	if details.GetCompilationUnit() == nil {
+		return nil, fmt.Errorf("No compilation unit for %s", details.GetCompilationDescriptionPath())
+	}
+	return &rpcpb.AnalyzeResponse{
+		Note: []*notepb.Note{
+			&notepb.Note{
+				Category:    proto.String(p.category),
+				Description: proto.String(filepath.Base(details.GetCompilationDescriptionPath())),
+				Location:    &notepb.Location{},
+			},
+		},
+	}, nil
+}
+
+// optionsDispatcher produces a note on A.cc for every setting it is sent.
+type optionsDispatcher struct {
+	categories []string
+}
+
+func (o optionsDispatcher) GetCategory(ctx server.Context, in *rpcpb.GetCategoryRequest) (*rpcpb.GetCategoryResponse, error) {
+	return &rpcpb.GetCategoryResponse{
+		Category: o.categories,
+	}, nil
+}
+
+func (o optionsDispatcher) GetStage(ctx server.Context, in *rpcpb.GetStageRequest) (*rpcpb.GetStageResponse, error) {
+	return &rpcpb.GetStageResponse{
+		Stage: ctxpb.Stage_PRE_BUILD.Enum(),
+	}, nil
+}
+
+func (o optionsDispatcher) Analyze(ctx server.Context, in *rpcpb.AnalyzeRequest) (*rpcpb.AnalyzeResponse, error) {
+	var nts []*notepb.Note
+	for _, co := range in.Options {
+		for _, setting := range co.Settings {
+			nts = append(nts, &notepb.Note{
+				Category:    co.Category,
+				Description: proto.String(setting),
+				Location:    testutil.CreateLocation("A.cc"),
+			})
+		}
+	}
+	return &rpcpb.AnalyzeResponse{Note: nts}, nil
+}
+
+// timeoutsDispatcher produces a note on A.cc for every timeout it is sent.
+type timeoutsDispatcher struct{}
+
+func (timeoutsDispatcher) Analyze(ctx server.Context, in *rpcpb.AnalyzeRequest) (*rpcpb.AnalyzeResponse, error) {
+	var nts []*notepb.Note
+	for _, t := range in.Timeout {
+		nts = append(nts, &notepb.Note{
+			Category:    t.Category,
+			Description: proto.String(fmt.Sprintf("%ds", t.GetSeconds())),
+			Location:    testutil.CreateLocation("A.cc"),
+		})
+	}
+	return &rpcpb.AnalyzeResponse{Note: nts}, nil
+}
+
 type errDispatcher struct{}
 
 func (errDispatcher) GetCategory(ctx server.Context, in *rpcpb.GetCategoryRequest) (*rpcpb.GetCategoryResponse, error) {
@@ -93,6 +179,47 @@ func (panicDispatcher) GetStage(ctx server.Context, in *rpcpb.GetStageRequest) (
 	panic("panic")
 }
 
+type fakeReporter struct {
+	mu       sync.Mutex
+	statuses map[string][]reporterpb.AnalyzerStatus
+	notes    []*notepb.Note
+}
+
+func (f *fakeReporter) ReportStatus(ctx server.Context, in *reporterpb.ReportAnalyzerStatusRequest) (*reporterpb.ReportAnalyzerStatusResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statuses[in.GetCategory()] = append(f.statuses[in.GetCategory()], in.GetStatus())
+	return &reporterpb.ReportAnalyzerStatusResponse{}, nil
+}
+
+func (f *fakeReporter) ReportNotes(ctx server.Context, in *reporterpb.ReportNotesRequest) (*reporterpb.ReportNotesResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.notes = append(f.notes, in.Notes...)
+	return &reporterpb.ReportNotesResponse{}, nil
+}
+
+// slowReporter takes longer to take a report than any report timeout used in the tests.
+type slowReporter struct{}
+
+func (slowReporter) ReportStatus(ctx server.Context, in *reporterpb.ReportAnalyzerStatusRequest) (*reporterpb.ReportAnalyzerStatusResponse, error) {
+	time.Sleep(time.Second)
+	return &reporterpb.ReportAnalyzerStatusResponse{}, nil
+}
+
+func (slowReporter) ReportNotes(ctx server.Context, in *reporterpb.ReportNotesRequest) (*reporterpb.ReportNotesResponse, error) {
+	time.Sleep(time.Second)
+	return &reporterpb.ReportNotesResponse{}, nil
+}
+
+// slowDispatcher takes longer to analyze than any timeout used in the tests.
+type slowDispatcher struct{}
+
+func (slowDispatcher) Analyze(ctx server.Context, in *rpcpb.AnalyzeRequest) (*rpcpb.AnalyzeResponse, error) {
+	time.Sleep(time.Second)
+	return &rpcpb.AnalyzeResponse{}, nil
+}
+
 type fullFakeDispatcher struct {
 	response *rpcpb.AnalyzeResponse
 }
@@ -138,7 +265,7 @@ func TestGetServiceInfo(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		driver := NewDriver(test.addrs, nil)
+		driver := NewDriver(test.addrs, nil, nil)
 		info := driver.getAllServiceInfo()
 
 		if len(test.result) != len(info) {
@@ -187,10 +314,10 @@ func TestCallAllAnalyzers(t *testing.T) {
 	for _, test := range tests {
 		ctx := &ctxpb.ShipshapeContext{FilePath: test.files}
 
-		ars := driver.callAllAnalyzers(strset.New(test.categories...), ctx, ctxpb.Stage_PRE_BUILD)
+		ars := driver.callAllAnalyzers(strset.New(test.categories...), ctx, ctxpb.Stage_PRE_BUILD, analysisOptions{})
 		var notes []*notepb.Note
 
-		for _, ar := range ars {
+		for ar := range ars {
 			notes = append(notes, ar.Note...)
 			if len(ar.Failure) > 0 {
 				t.Errorf("Received failures from analyze call: %v", ar.Failure)
@@ -281,11 +408,11 @@ func TestCallAllAnalyzersErrorCases(t *testing.T) {
 			serviceInfo{addr, strset.New("Foo"), ctxpb.Stage_PRE_BUILD},
 		})
 
-		ars := driver.callAllAnalyzers(strset.New("Foo"), ctx, ctxpb.Stage_PRE_BUILD)
+		ars := driver.callAllAnalyzers(strset.New("Foo"), ctx, ctxpb.Stage_PRE_BUILD, analysisOptions{})
 		var notes []*notepb.Note
 		var failures []*rpcpb.AnalysisFailure
 
-		for _, ar := range ars {
+		for ar := range ars {
 			notes = append(notes, ar.Note...)
 			failures = append(failures, ar.Failure...)
 		}
@@ -302,6 +429,801 @@ func TestCallAllAnalyzersErrorCases(t *testing.T) {
 	}
 }
 
+func TestCallAllAnalyzersTimeout(t *testing.T) {
+	ctx := &ctxpb.ShipshapeContext{FilePath: []string{"dir1/A"}}
+
+	slowAddr, cleanup, err := testutil.CreatekRPCTestServer(slowDispatcher{}, "AnalyzerService")
+	if err != nil {
+		t.Fatalf("Registering analyzer service failed: %v", err)
+	}
+	defer cleanup()
+
+	fastAddr, cleanup, err := testutil.CreatekRPCTestServer(fakeDispatcher{[]string{"Baz"}, []string{"dir1/A"}}, "AnalyzerService")
+	if err != nil {
+		t.Fatalf("Registering analyzer service failed: %v", err)
+	}
+	defer cleanup()
+
+	driver := NewTestDriver([]serviceInfo{
+		serviceInfo{slowAddr, strset.New("Foo", "Bar"), ctxpb.Stage_PRE_BUILD},
+		serviceInfo{fastAddr, strset.New("Baz"), ctxpb.Stage_PRE_BUILD},
+	})
+
+	timeouts := map[string]time.Duration{"": 50 * time.Millisecond}
+	start := time.Now()
+	var notes []*notepb.Note
+	var failures []*rpcpb.AnalysisFailure
+	for ar := range driver.callAllAnalyzers(strset.New("Foo", "Bar", "Baz"), ctx, ctxpb.Stage_PRE_BUILD, analysisOptions{timeouts: timeouts}) {
+		notes = append(notes, ar.Note...)
+		failures = append(failures, ar.Failure...)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("Analyzers were not cancelled at the timeout: took %v", elapsed)
+	}
+
+	expectNotes := []*notepb.Note{
+		&notepb.Note{
+			Category:    proto.String("Baz"),
+			Description: proto.String("Hello world"),
+			Location:    testutil.CreateLocation("dir1/A"),
+		},
+	}
+	if ok, results := testutil.CheckNoteContainsContent(expectNotes, notes); !ok {
+		t.Errorf("Incorrect notes: %s\n got %v, want %v", results, notes, expectNotes)
+	}
+	msg := fmt.Sprintf("Analyzer %s timed out after 50ms", strings.TrimPrefix(slowAddr, "http://"))
+	expectFailures := []*rpcpb.AnalysisFailure{
+		&rpcpb.AnalysisFailure{
+			Category:       proto.String("Bar"),
+			FailureMessage: proto.String(msg),
+		},
+		&rpcpb.AnalysisFailure{
+			Category:       proto.String("Foo"),
+			FailureMessage: proto.String(msg),
+		},
+	}
+	if ok, results := testutil.CheckFailureContainsContent(expectFailures, failures); !ok {
+		t.Errorf("Incorrect failures: %s\n got %v, want %v", results, failures, expectFailures)
+	}
+}
+
+func TestServiceTimeout(t *testing.T) {
+	tests := []struct {
+		label    string
+		timeouts map[string]time.Duration
+		cats     strset.Set
+		expect   time.Duration
+	}{
+		{
+			"No timeouts",
+			nil,
+			strset.New("Foo"),
+			defaultAnalyzerTimeout,
+		},
+		{
+			"Default timeout",
+			map[string]time.Duration{"": time.Minute},
+			strset.New("Foo"),
+			time.Minute,
+		},
+		{
+			"Longest category timeout",
+			map[string]time.Duration{"Foo": time.Minute, "Bar": time.Hour},
+			strset.New("Foo", "Bar"),
+			time.Hour,
+		},
+		{
+			"Backstop includes the default timeout",
+			map[string]time.Duration{"": time.Hour, "Foo": time.Minute},
+			strset.New("Foo", "Bar"),
+			time.Hour,
+		},
+	}
+
+	for _, test := range tests {
+		if got := serviceTimeout(test.timeouts, test.cats); got != test.expect {
+			t.Errorf("Incorrect timeout for %q: got %v, want %v", test.label, got, test.expect)
+		}
+	}
+}
+
+func TestRequestTimeouts(t *testing.T) {
+	timeouts := map[string]time.Duration{"": time.Hour, "PyLint": time.Minute, "JSHint": 1500 * time.Millisecond}
+	got := requestTimeouts(timeouts, strset.New("PyLint", "JSHint", "go vet"))
+	expect := []*configpb.TimeoutConfig{
+		{Category: proto.String("JSHint"), Seconds: proto.Int32(2)},
+		{Category: proto.String("PyLint"), Seconds: proto.Int32(60)},
+		{Category: proto.String("go vet"), Seconds: proto.Int32(3600)},
+	}
+	if len(got) != len(expect) {
+		t.Fatalf("Incorrect timeouts: got %v, want %v", got, expect)
+	}
+	for i := range got {
+		if !proto.Equal(got[i], expect[i]) {
+			t.Errorf("Incorrect timeout %d: got %v, want %v", i, got[i], expect[i])
+		}
+	}
+
+	if got := requestTimeouts(nil, strset.New("PyLint")); len(got) != 1 || got[0].GetSeconds() != int32(defaultAnalyzerTimeout/time.Second) {
+		t.Errorf("Incorrect timeouts without any configured: got %v", got)
+	}
+}
+
+func TestCallAllAnalyzersSendsTimeouts(t *testing.T) {
+	ctx := &ctxpb.ShipshapeContext{FilePath: []string{"A.cc"}}
+	addr, cleanup, err := testutil.CreatekRPCTestServer(timeoutsDispatcher{}, "AnalyzerService")
+	if err != nil {
+		t.Fatalf("Registering analyzer service failed: %v", err)
+	}
+	defer cleanup()
+
+	driver := NewTestDriver([]serviceInfo{
+		serviceInfo{addr, strset.New("PyLint", "JSHint"), ctxpb.Stage_PRE_BUILD},
+	})
+	timeouts := map[string]time.Duration{"": time.Hour, "PyLint": time.Minute}
+	var notes []*notepb.Note
+	for ar := range driver.callAllAnalyzers(strset.New("PyLint", "JSHint"), ctx, ctxpb.Stage_PRE_BUILD, analysisOptions{timeouts: timeouts}) {
+		notes = append(notes, ar.Note...)
+	}
+
+	expect := []*notepb.Note{
+		&notepb.Note{Category: proto.String("JSHint"), Description: proto.String("3600s"), Location: testutil.CreateLocation("A.cc")},
+		&notepb.Note{Category: proto.String("PyLint"), Description: proto.String("60s"), Location: testutil.CreateLocation("A.cc")},
+	}
+	if ok, results := testutil.CheckNoteContainsContent(expect, notes); !ok {
+		t.Errorf("Incorrect notes: %s\n got %v, want %v", results, notes, expect)
+	}
+}
+
+func TestAnalyzerTimeouts(t *testing.T) {
+	cfg := &config{timeouts: map[string]time.Duration{"": time.Minute, "Foo": time.Hour}}
+	req := []*configpb.TimeoutConfig{
+		&configpb.TimeoutConfig{Category: proto.String("Foo"), Seconds: proto.Int32(5)},
+		&configpb.TimeoutConfig{Category: proto.String("Bar"), Seconds: proto.Int32(10)},
+	}
+	expect := map[string]time.Duration{
+		"":    time.Minute,
+		"Foo": 5 * time.Second,
+		"Bar": 10 * time.Second,
+	}
+	if got := analyzerTimeouts(cfg, req); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Incorrect timeouts: got %v, want %v", got, expect)
+	}
+}
+
+func TestCallAllAnalyzersReports(t *testing.T) {
+	ctx := &ctxpb.ShipshapeContext{FilePath: []string{"dir1/A"}}
+
+	addr, cleanup, err := testutil.CreatekRPCTestServer(&fullFakeDispatcher{&rpcpb.AnalyzeResponse{
+		Note: []*notepb.Note{
+			&notepb.Note{
+				Category:    proto.String("Foo"),
+				Description: proto.String("A note"),
+				Location:    testutil.CreateLocation("dir1/A"),
+			},
+		},
+		Failure: []*rpcpb.AnalysisFailure{
+			&rpcpb.AnalysisFailure{
+				Category:       proto.String("Bar"),
+				FailureMessage: proto.String("badbadbad"),
+			},
+		},
+	}}, "AnalyzerService")
+	if err != nil {
+		t.Fatalf("Registering analyzer service failed: %v", err)
+	}
+	defer cleanup()
+
+	reporter := &fakeReporter{statuses: make(map[string][]reporterpb.AnalyzerStatus)}
+	reporterAddr, cleanup, err := testutil.CreatekRPCTestServer(reporter, "Reporter")
+	if err != nil {
+		t.Fatalf("Registering reporter service failed: %v", err)
+	}
+	defer cleanup()
+
+	driver := NewTestDriver([]serviceInfo{
+		serviceInfo{addr, strset.New("Foo", "Bar"), ctxpb.Stage_PRE_BUILD},
+	})
+	driver.ReporterLocations = []string{strings.TrimPrefix(reporterAddr, "http://")}
+
+	for range driver.callAllAnalyzers(strset.New("Foo", "Bar"), ctx, ctxpb.Stage_PRE_BUILD, analysisOptions{}) {
+	}
+
+	expectStatuses := map[string][]reporterpb.AnalyzerStatus{
+		"Foo": {reporterpb.AnalyzerStatus_RUNNING, reporterpb.AnalyzerStatus_COMPLETED},
+		"Bar": {reporterpb.AnalyzerStatus_RUNNING, reporterpb.AnalyzerStatus_FAILED},
+	}
+	if !reflect.DeepEqual(reporter.statuses, expectStatuses) {
+		t.Errorf("Incorrect statuses reported: got %v, want %v", reporter.statuses, expectStatuses)
+	}
+	expectNotes := []*notepb.Note{
+		&notepb.Note{
+			Category:    proto.String("Foo"),
+			Description: proto.String("A note"),
+			Location:    testutil.CreateLocation("dir1/A"),
+		},
+	}
+	if ok, results := testutil.CheckNoteContainsContent(expectNotes, reporter.notes); !ok {
+		t.Errorf("Incorrect notes reported: %s\n got %v, want %v", results, reporter.notes, expectNotes)
+	}
+}
+
+func TestCallAllAnalyzersSlowReporter(t *testing.T) {
+	defer func(timeout time.Duration) { reportTimeout = timeout }(reportTimeout)
+	reportTimeout = 50 * time.Millisecond
+
+	ctx := &ctxpb.ShipshapeContext{FilePath: []string{"dir1/A"}}
+	addr, cleanup, err := testutil.CreatekRPCTestServer(&fullFakeDispatcher{&rpcpb.AnalyzeResponse{
+		Note: []*notepb.Note{
+			&notepb.Note{
+				Category:    proto.String("Foo"),
+				Description: proto.String("A note"),
+				Location:    testutil.CreateLocation("dir1/A"),
+			},
+		},
+	}}, "AnalyzerService")
+	if err != nil {
+		t.Fatalf("Registering analyzer service failed: %v", err)
+	}
+	defer cleanup()
+
+	reporterAddr, cleanup, err := testutil.CreatekRPCTestServer(slowReporter{}, "Reporter")
+	if err != nil {
+		t.Fatalf("Registering reporter service failed: %v", err)
+	}
+	defer cleanup()
+
+	driver := NewTestDriver([]serviceInfo{
+		serviceInfo{addr, strset.New("Foo", "Bar"), ctxpb.Stage_PRE_BUILD},
+	})
+	driver.ReporterLocations = []string{strings.TrimPrefix(reporterAddr, "http://")}
+
+	start := time.Now()
+	var notes []*notepb.Note
+	for ar := range driver.callAllAnalyzers(strset.New("Foo", "Bar"), ctx, ctxpb.Stage_PRE_BUILD, analysisOptions{}) {
+		notes = append(notes, ar.Note...)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("The slow reporter held up the analysis for %v", elapsed)
+	}
+	if len(notes) != 1 {
+		t.Errorf("Incorrect notes: got %v, want the note from Foo", notes)
+	}
+}
+
+func TestRunStreamsPerService(t *testing.T) {
+	addrFoo, cleanup, err := testutil.CreatekRPCTestServer(&fakeDispatcher{[]string{"Foo"}, []string{"A.cc"}}, "AnalyzerService")
+	if err != nil {
+		t.Fatalf("Registering analyzer service failed: %v", err)
+	}
+	defer cleanup()
+
+	addrBar, cleanup, err := testutil.CreatekRPCTestServer(&fakeDispatcher{[]string{"Bar"}, []string{"A.cc"}}, "AnalyzerService")
+	if err != nil {
+		t.Fatalf("Registering analyzer service failed: %v", err)
+	}
+	defer cleanup()
+
+	root, err := ioutil.TempDir("", "driver_test")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	driver := NewDriver([]string{addrFoo, addrBar}, nil, nil)
+	req := &rpcpb.ShipshapeRequest{
+		TriggeredCategory: []string{"Foo", "Bar", "Baz"},
+		ShipshapeContext: &ctxpb.ShipshapeContext{
+			FilePath: []string{"A.cc"},
+			RepoRoot: proto.String(root),
+		},
+		Event: proto.String("test"),
+		Stage: ctxpb.Stage_PRE_BUILD.Enum(),
+	}
+
+	out := make(chan *rpcpb.ShipshapeResponse)
+	go func() {
+		if err := driver.Run(nil, req, out); err != nil {
+			t.Errorf("Run returned an error: %v", err)
+		}
+		close(out)
+	}()
+
+	var resps []*rpcpb.ShipshapeResponse
+	for resp := range out {
+		resps = append(resps, resp)
+	}
+
+	// One response for the missing category, then one per analyzer service.
+	if got, want := len(resps), 3; got != want {
+		t.Fatalf("Incorrect number of streamed responses: got %d, want %d (%v)", got, want, resps)
+	}
+	var notes []*notepb.Note
+	var failures []*rpcpb.AnalysisFailure
+	for _, resp := range resps {
+		if got, want := len(resp.AnalyzeResponse), 1; got != want {
+			t.Errorf("Incorrect number of AnalyzeResponses in %v: got %d, want %d", resp, got, want)
+		}
+		for _, ar := range resp.AnalyzeResponse {
+			notes = append(notes, ar.Note...)
+			failures = append(failures, ar.Failure...)
+		}
+	}
+
+	expectNotes := []*notepb.Note{
+		{Category: proto.String("Foo"), Description: proto.String("Hello world"), Location: testutil.CreateLocation("A.cc")},
+		{Category: proto.String("Bar"), Description: proto.String("Hello world"), Location: testutil.CreateLocation("A.cc")},
+	}
+	if ok, results := testutil.CheckNoteContainsContent(expectNotes, notes); !ok {
+		t.Errorf("Incorrect notes: %s\n got %v, want %v", results, notes, expectNotes)
+	}
+	expectFailures := []*rpcpb.AnalysisFailure{
+		{Category: proto.String("Baz"), FailureMessage: proto.String("could not be found")},
+	}
+	if ok, results := testutil.CheckFailureContainsContent(expectFailures, failures); !ok {
+		t.Errorf("Incorrect failures: %s\n got %v, want %v", results, failures, expectFailures)
+	}
+}
+
+func TestRunChangedLines(t *testing.T) {
+	addr, cleanup, err := testutil.CreatekRPCTestServer(&fakeDispatcher{[]string{"Foo"}, []string{"A.cc", "B.cc", "C.cc"}}, "AnalyzerService")
+	if err != nil {
+		t.Fatalf("Registering analyzer service failed: %v", err)
+	}
+	defer cleanup()
+
+	root, err := ioutil.TempDir("", "driver_test")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	driver := NewDriver([]string{addr}, nil, nil)
+	req := &rpcpb.ShipshapeRequest{
+		TriggeredCategory: []string{"Foo"},
+		ShipshapeContext: &ctxpb.ShipshapeContext{
+			FilePath: []string{"A.cc", "B.cc", "C.cc"},
+			RepoRoot: proto.String(root),
+			ChangelistDetails: &ctxpb.ChangelistDetails{
+				DeletedFilePath: []string{"B.cc"},
+				Diff:            proto.String("--- a/C.cc\n+++ b/C.cc\n@@ -1 +1 @@\n-old\n+new\n"),
+			},
+		},
+		Event:            proto.String("test"),
+		Stage:            ctxpb.Stage_PRE_BUILD.Enum(),
+		ChangedLinesMode: rpcpb.ShipshapeRequest_DROP_UNCHANGED.Enum(),
+	}
+
+	out := make(chan *rpcpb.ShipshapeResponse)
+	go func() {
+		if err := driver.Run(nil, req, out); err != nil {
+			t.Errorf("Run returned an error: %v", err)
+		}
+		close(out)
+	}()
+
+	var notes []*notepb.Note
+	for resp := range out {
+		for _, ar := range resp.AnalyzeResponse {
+			notes = append(notes, ar.Note...)
+			if len(ar.Failure) > 0 {
+				t.Errorf("Unexpected failures: %v", ar.Failure)
+			}
+		}
+	}
+
+	// A.cc is not in the change, and B.cc was deleted.
+	expectNotes := []*notepb.Note{
+		{Category: proto.String("Foo"), Description: proto.String("Hello world"), Location: testutil.CreateLocation("C.cc")},
+	}
+	if ok, results := testutil.CheckNoteContainsContent(expectNotes, notes); !ok {
+		t.Errorf("Incorrect notes: %s\n got %v, want %v", results, notes, expectNotes)
+	}
+}
+
+func TestRunPathRules(t *testing.T) {
+	files := []string{"tools/a.py", "b.py", "third_party/c.js", "sub/d.py"}
+	addrFoo, cleanup, err := testutil.CreatekRPCTestServer(&fakeDispatcher{[]string{"Foo"}, files}, "AnalyzerService")
+	if err != nil {
+		t.Fatalf("Registering analyzer service failed: %v", err)
+	}
+	defer cleanup()
+
+	addrBar, cleanup, err := testutil.CreatekRPCTestServer(&fakeDispatcher{[]string{"Bar"}, files}, "AnalyzerService")
+	if err != nil {
+		t.Fatalf("Registering analyzer service failed: %v", err)
+	}
+	defer cleanup()
+
+	root, err := ioutil.TempDir("", "driver_test")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	configs := map[string]string{
+		configFilename: `
+events:
+  - event: test
+    categories:
+      - Bar
+paths:
+  - path: tools/
+    enable:
+      - Foo
+  - path: third_party/
+    disable:
+      - Bar
+`,
+		filepath.Join("sub", configFilename): `
+events:
+  - event: test
+    categories:
+      - Foo
+`,
+	}
+	for path, content := range configs {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	driver := NewDriver([]string{addrFoo, addrBar}, nil, nil)
+	req := &rpcpb.ShipshapeRequest{
+		ShipshapeContext: &ctxpb.ShipshapeContext{
+			FilePath: files,
+			RepoRoot: proto.String(root),
+		},
+		Event: proto.String("test"),
+		Stage: ctxpb.Stage_PRE_BUILD.Enum(),
+	}
+
+	out := make(chan *rpcpb.ShipshapeResponse)
+	go func() {
+		if err := driver.Run(nil, req, out); err != nil {
+			t.Errorf("Run returned an error: %v", err)
+		}
+		close(out)
+	}()
+
+	var notes []*notepb.Note
+	for resp := range out {
+		for _, ar := range resp.AnalyzeResponse {
+			notes = append(notes, ar.Note...)
+			if len(ar.Failure) > 0 {
+				t.Errorf("Unexpected failures: %v", ar.Failure)
+			}
+		}
+	}
+
+	expectNotes := []*notepb.Note{
+		{Category: proto.String("Foo"), Description: proto.String("Hello world"), Location: testutil.CreateLocation("tools/a.py")},
+		{Category: proto.String("Foo"), Description: proto.String("Hello world"), Location: testutil.CreateLocation("sub/d.py")},
+		{Category: proto.String("Bar"), Description: proto.String("Hello world"), Location: testutil.CreateLocation("tools/a.py")},
+		{Category: proto.String("Bar"), Description: proto.String("Hello world"), Location: testutil.CreateLocation("b.py")},
+	}
+	if ok, results := testutil.CheckNoteContainsContent(expectNotes, notes); !ok {
+		t.Errorf("Incorrect notes: %s\n got %v, want %v", results, notes, expectNotes)
+	}
+}
+
+func TestRunConfigProblems(t *testing.T) {
+	addr, cleanup, err := testutil.CreatekRPCTestServer(&fakeDispatcher{[]string{"Foo"}, []string{"A.cc"}}, "AnalyzerService")
+	if err != nil {
+		t.Fatalf("Registering analyzer service failed: %v", err)
+	}
+	defer cleanup()
+
+	tests := []struct {
+		label          string
+		config         string
+		expectNotes    []*notepb.Note
+		expectFailures []*rpcpb.AnalysisFailure
+	}{
+		{
+			"Invalid config",
+			"events:\n  - event: test\n    categories:\n      - Foo\n  - categories:\n      - Foo\n",
+			[]*notepb.Note{
+				{Category: proto.String(configCategory), Description: proto.String("missing an event name"), Location: testutil.CreateLocation(configFilename)},
+			},
+			[]*rpcpb.AnalysisFailure{
+				{Category: proto.String("Driver setup"), FailureMessage: proto.String("config is invalid")},
+			},
+		},
+		{
+			"Unknown category",
+			"events:\n  - event: test\n    categories:\n      - Foo\n      - Baz\n",
+			[]*notepb.Note{
+				{Category: proto.String(configCategory), Description: proto.String("Unknown category \"Baz\""), Location: testutil.CreateLocation(configFilename)},
+				{Category: proto.String("Foo"), Description: proto.String("Hello world"), Location: testutil.CreateLocation("A.cc")},
+			},
+			[]*rpcpb.AnalysisFailure{
+				{Category: proto.String("Baz"), FailureMessage: proto.String("could not be found")},
+			},
+		},
+		{
+			"Names in a different case",
+			"events:\n  - event: Test\n    categories:\n      - foo\n      - Fooo\n",
+			[]*notepb.Note{
+				{Category: proto.String(configCategory), Description: proto.String("Unknown category \"Fooo\"; did you mean \"Foo\"?"), Location: testutil.CreateLocation(configFilename)},
+				{Category: proto.String("Foo"), Description: proto.String("Hello world"), Location: testutil.CreateLocation("A.cc")},
+			},
+			[]*rpcpb.AnalysisFailure{
+				{Category: proto.String("Fooo"), FailureMessage: proto.String("did you mean \"Foo\"?")},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		root, err := ioutil.TempDir("", "driver_test")
+		if err != nil {
+			t.Fatalf("Could not create temp dir: %v", err)
+		}
+		defer os.RemoveAll(root)
+		if err := ioutil.WriteFile(filepath.Join(root, configFilename), []byte(test.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		driver := NewDriver([]string{addr}, nil, nil)
+		req := &rpcpb.ShipshapeRequest{
+			ShipshapeContext: &ctxpb.ShipshapeContext{
+				FilePath: []string{"A.cc"},
+				RepoRoot: proto.String(root),
+			},
+			Event: proto.String("test"),
+			Stage: ctxpb.Stage_PRE_BUILD.Enum(),
+		}
+
+		out := make(chan *rpcpb.ShipshapeResponse)
+		go func() {
+			driver.Run(nil, req, out)
+			close(out)
+		}()
+
+		var notes []*notepb.Note
+		var failures []*rpcpb.AnalysisFailure
+		for resp := range out {
+			for _, ar := range resp.AnalyzeResponse {
+				notes = append(notes, ar.Note...)
+				failures = append(failures, ar.Failure...)
+			}
+		}
+		if ok, results := testutil.CheckNoteContainsContent(test.expectNotes, notes); !ok {
+			t.Errorf("%s: incorrect notes: %s\n got %v, want %v", test.label, results, notes, test.expectNotes)
+		}
+		if ok, results := testutil.CheckFailureContainsContent(test.expectFailures, failures); !ok {
+			t.Errorf("%s: incorrect failures: %s\n got %v, want %v", test.label, results, failures, test.expectFailures)
+		}
+	}
+}
+
+func TestRunForwardsOptions(t *testing.T) {
+	addr, cleanup, err := testutil.CreatekRPCTestServer(&optionsDispatcher{[]string{"PyLint", "JSHint"}}, "AnalyzerService")
+	if err != nil {
+		t.Fatalf("Registering analyzer service failed: %v", err)
+	}
+	defer cleanup()
+
+	root, err := ioutil.TempDir("", "driver_test")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+	config := `
+global:
+  options:
+    - category: pylint
+      settings:
+        - rcfile=tools/pylintrc
+    - category: go vet
+      settings:
+        - flags=-shadow
+events:
+  - event: test
+    categories:
+      - PyLint
+      - JSHint
+`
+	if err := ioutil.WriteFile(filepath.Join(root, configFilename), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	driver := NewDriver([]string{addr}, nil, nil)
+	req := &rpcpb.ShipshapeRequest{
+		ShipshapeContext: &ctxpb.ShipshapeContext{
+			FilePath: []string{"A.cc"},
+			RepoRoot: proto.String(root),
+		},
+		Event: proto.String("test"),
+		Stage: ctxpb.Stage_PRE_BUILD.Enum(),
+	}
+
+	out := make(chan *rpcpb.ShipshapeResponse)
+	go func() {
+		if err := driver.Run(nil, req, out); err != nil {
+			t.Errorf("Run returned an error: %v", err)
+		}
+		close(out)
+	}()
+
+	var notes []*notepb.Note
+	for resp := range out {
+		for _, ar := range resp.AnalyzeResponse {
+			notes = append(notes, ar.Note...)
+		}
+	}
+	expectNotes := []*notepb.Note{
+		{Category: proto.String(configCategory), Description: proto.String("Unknown category \"go vet\""), Location: testutil.CreateLocation(configFilename)},
+		{Category: proto.String("PyLint"), Description: proto.String("rcfile=tools/pylintrc"), Location: testutil.CreateLocation("A.cc")},
+	}
+	if ok, results := testutil.CheckNoteContainsContent(expectNotes, notes); !ok {
+		t.Errorf("Incorrect notes: %s\n got %v, want %v", results, notes, expectNotes)
+	}
+}
+
+func TestRunPostBuild(t *testing.T) {
+	addr, cleanup, err := testutil.CreatekRPCTestServer(&postBuildDispatcher{"Foo"}, "AnalyzerService")
+	if err != nil {
+		t.Fatalf("Registering analyzer service failed: %v", err)
+	}
+	defer cleanup()
+
+	root, err := ioutil.TempDir("", "driver_test")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	const testDir = "shipshape/service/testdata/service_test"
+	const kindexName = "2b1a94f4695c38fd074cb80cb8a49c4951b8a12e773073e6dd180d3ffa3fbdfe.kindex"
+	comps := filepath.Join(root, compilationsDir, "java")
+	if err := os.MkdirAll(comps, 0755); err != nil {
+		t.Fatalf("Could not create compilations dir: %v", err)
+	}
+	for src, dst := range map[string]string{"valid_kindex": "valid.kindex", "invalid_kindex": "invalid.kindex"} {
+		data, err := ioutil.ReadFile(filepath.Join(testDir, src, kindexName))
+		if err != nil {
+			t.Fatalf("Could not read test kindex: %v", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(comps, dst), data, 0644); err != nil {
+			t.Fatalf("Could not write test kindex: %v", err)
+		}
+	}
+
+	driver := NewDriver([]string{addr}, nil, nil)
+	req := &rpcpb.ShipshapeRequest{
+		TriggeredCategory: []string{"Foo"},
+		ShipshapeContext: &ctxpb.ShipshapeContext{
+			FilePath: []string{"A.java"},
+			RepoRoot: proto.String(root),
+		},
+		Event: proto.String("test"),
+		Stage: ctxpb.Stage_POST_BUILD.Enum(),
+	}
+
+	out := make(chan *rpcpb.ShipshapeResponse)
+	go func() {
+		if err := driver.Run(nil, req, out); err != nil {
+			t.Errorf("Run returned an error: %v", err)
+		}
+		close(out)
+	}()
+
+	var notes []*notepb.Note
+	var failures []*rpcpb.AnalysisFailure
+	for resp := range out {
+		for _, ar := range resp.AnalyzeResponse {
+			notes = append(notes, ar.Note...)
+			failures = append(failures, ar.Failure...)
+		}
+	}
+
+	expectNotes := []*notepb.Note{
+		{Category: proto.String("Foo"), Description: proto.String("valid.kindex")},
+	}
+	if ok, results := testutil.CheckNoteContainsContent(expectNotes, notes); !ok {
+		t.Errorf("Incorrect notes: %s\n got %v, want %v", results, notes, expectNotes)
+	}
+	expectFailures := []*rpcpb.AnalysisFailure{
+		{Category: proto.String("Driver setup"), FailureMessage: proto.String("invalid.kindex")},
+	}
+	if ok, results := testutil.CheckFailureContainsContent(expectFailures, failures); !ok {
+		t.Errorf("Incorrect failures: %s\n got %v, want %v", results, failures, expectFailures)
+	}
+}
+
+func TestFindCompilationUnits(t *testing.T) {
+	const testDir = "shipshape/service/testdata/service_test"
+	tests := []struct {
+		label        string
+		dir          string
+		expectUnits  []string
+		expectFailed []string
+	}{
+		{
+			"Valid kindex",
+			"valid_kindex",
+			[]string{"2b1a94f4695c38fd074cb80cb8a49c4951b8a12e773073e6dd180d3ffa3fbdfe.kindex"},
+			nil,
+		},
+		{
+			"Invalid kindex",
+			"invalid_kindex",
+			nil,
+			[]string{"2b1a94f4695c38fd074cb80cb8a49c4951b8a12e773073e6dd180d3ffa3fbdfe.kindex"},
+		},
+		{
+			"No kindex",
+			"no_kindex",
+			nil,
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		dir := filepath.Join(testDir, test.dir)
+		units, invalid, err := findCompilationUnits(dir)
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", test.label, err)
+			continue
+		}
+		var gotUnits, gotFailed []string
+		for path, unit := range units {
+			if unit == nil {
+				t.Errorf("Nil compilation unit for %s in %q", path, test.label)
+			}
+			gotUnits = append(gotUnits, filepath.Base(path))
+		}
+		for path := range invalid {
+			gotFailed = append(gotFailed, filepath.Base(path))
+		}
+		if !strset.Equal(gotUnits, test.expectUnits) {
+			t.Errorf("Incorrect compilation units for %q: got %v, want %v", test.label, gotUnits, test.expectUnits)
+		}
+		if !strset.Equal(gotFailed, test.expectFailed) {
+			t.Errorf("Incorrect invalid kindex files for %q: got %v, want %v", test.label, gotFailed, test.expectFailed)
+		}
+	}
+
+	if _, _, err := findCompilationUnits(filepath.Join(testDir, "does_not_exist")); err == nil {
+		t.Error("Expected an error for a missing compilations directory")
+	}
+}
+
+func TestOverrideSeverities(t *testing.T) {
+	notes := []*notepb.Note{
+		{Category: proto.String("WordCount"), Description: proto.String("Counted")},
+		{Category: proto.String("go vet"), Severity: notepb.Note_WARNING.Enum()},
+		{Category: proto.String("PyLint"), Severity: notepb.Note_BUILD_ERROR.Enum()},
+	}
+	severities := map[string]notepb.Note_Severity{
+		"WordCount": notepb.Note_OTHER,
+		"go vet":    notepb.Note_BUILD_ERROR,
+	}
+
+	got := overrideSeverities(notes, severities)
+	expect := []*notepb.Note{
+		{Category: proto.String("WordCount"), Description: proto.String("Counted"), Severity: notepb.Note_OTHER.Enum()},
+		{Category: proto.String("go vet"), Severity: notepb.Note_BUILD_ERROR.Enum()},
+		{Category: proto.String("PyLint"), Severity: notepb.Note_BUILD_ERROR.Enum()},
+	}
+	if len(got) != len(expect) {
+		t.Fatalf("Incorrect number of notes: got %v, want %v", got, expect)
+	}
+	for i := range expect {
+		if !proto.Equal(got[i], expect[i]) {
+			t.Errorf("Incorrect note %d: got %v, want %v", i, got[i], expect[i])
+		}
+	}
+	if notes[0].Severity != nil {
+		t.Errorf("The original note was changed: %v", notes[0])
+	}
+}
+
 func TestFilterPaths(t *testing.T) {
 	tests := []struct {
 		label         string
@@ -339,64 +1261,36 @@ func TestFilterPaths(t *testing.T) {
 			[]string{"dir1/a", "dir1/b", "dir1/c"},
 			nil,
 		},
-	}
-
-	for _, test := range tests {
-		out := filterPaths(test.ignoreDirs, test.inputFiles)
-		if !reflect.DeepEqual(out, test.expectedFiles) {
-			t.Errorf("Error on %q: got %v, expected %v", test.label, out, test.expectedFiles)
-		}
-	}
-}
-
-/*
-func TestFindCompilationUnitsGood(t *testing.T) {
-	tests := []struct {
-		dir           string
-		expectedPaths []string
-	}{
 		{
-			"valid_kindex",
-			[]string{"shipshape/service/testdata/service_test/valid_kindex/2b1a94f4695c38fd074cb80cb8a49c4951b8a12e773073e6dd180d3ffa3fbdfe.kindex"},
+			"Glob matches files at any depth",
+			[]string{"**/*.pb.go"},
+			[]string{"a.pb.go", "a.go", "dir1/dir2/b.pb.go", "dir1/b.go"},
+			[]string{"a.go", "dir1/b.go"},
 		},
 		{
-			"no_kindex",
-			[]string{},
+			"Glob anchored at the root",
+			[]string{"*.pb.go", "dir1/*/gen"},
+			[]string{"a.pb.go", "dir1/b.pb.go", "dir1/dir2/gen/c", "dir1/gen/c"},
+			[]string{"dir1/b.pb.go", "dir1/gen/c"},
+		},
+		{
+			"Negation re-includes files",
+			[]string{"**/*.go", "dir1/", "!dir1/keep.go", "!**/main.go"},
+			[]string{"dir1/a", "dir1/keep.go", "dir2/b.go", "dir2/main.go", "c.txt"},
+			[]string{"dir1/keep.go", "dir2/main.go", "c.txt"},
+		},
+		{
+			"Directory pattern does not match files",
+			[]string{"build/"},
+			[]string{"build", "build/a"},
+			[]string{"build"},
 		},
 	}
 
 	for _, test := range tests {
-		out, err := findCompilationUnits(filepath.Join("shipshape/service/testdata/service_test", test.dir))
-
-		if err != nil {
-			t.Errorf("Received error from directory %s: %v", test.dir, err.Error())
-		}
-
-		paths := make([]string, 0, len(out))
-		for p, cu := range out {
-			paths = append(paths, p)
-			if cu == nil {
-				t.Errorf("Received no compilation unit for path %s in %s", p, test.dir)
-			}
-		}
-		if !strset.Equal(test.expectedPaths, paths) {
-			t.Errorf("Did not get the right paths for %s: got %v, want %v", test.dir, paths, test.expectedPaths)
-		}
-	}
-}
-
-func TestFindCompilationUnitsError(t *testing.T) {
-	tests := []string{
-		"invalid_kindex",
-		"invalid_dir",
-	}
-
-	for _, test := range tests {
-		_, err := findCompilationUnits(filepath.Join("shipshape/service/testdata/service_test", test))
-
-		if err == nil {
-			t.Errorf("Expected an error, but did not get one for directory %s", test)
+		out := filterPaths(test.ignoreDirs, test.inputFiles)
+		if !reflect.DeepEqual(out, test.expectedFiles) {
+			t.Errorf("Error on %q: got %v, expected %v", test.label, out, test.expectedFiles)
 		}
 	}
 }
-*/
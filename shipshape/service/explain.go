@@ -0,0 +1,137 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/shipshape/shipshape/util/defaults"
+	strset "github.com/google/shipshape/shipshape/util/strings"
+)
+
+// Explanation describes how Shipshape would treat a file in a run.
+type Explanation struct {
+	// IgnoredBy describes why the file is left out of the analysis, or is empty if it
+	// is analyzed.
+	IgnoredBy string
+	// Categories are the categories that would run on the file, in sorted order.
+	Categories []string
+	// Steps describe how the configuration arrives at the categories, in order.
+	Steps []string
+}
+
+// ExplainConfig explains which categories Shipshape would run on a file for the given
+// event, using the config files in the repository at root. The file is given relative
+// to root. If categories is not empty, it is treated as the categories requested
+// explicitly, as with ShipshapeRequest.triggered_category. Like the analysis itself,
+// this does not check that analyzers exist for the categories; names are matched
+// ignoring case against the built-in categories.
+func ExplainConfig(root, event, file string, categories []string) (*Explanation, error) {
+	cfg, err := loadConfig(root, event)
+	if err != nil {
+		return nil, err
+	}
+	names := newCategoryNames(strset.New(BuiltinCategories...))
+	cfg.canonicalize(names)
+	categories = names.canonicalSlice(categories)
+	file = filepath.ToSlash(filepath.Clean(file))
+	exp := new(Explanation)
+
+	if exp.IgnoredBy, err = explainIgnored(root, cfg, file); err != nil {
+		return nil, err
+	}
+
+	var base strset.Set
+	switch {
+	case len(categories) > 0:
+		base = strset.New(categories...)
+		exp.Steps = append(exp.Steps, fmt.Sprintf("Categories requested explicitly: %v", sortedCategories(base)))
+	case cfg != nil && len(cfg.categories) > 0:
+		base = strset.New(cfg.categories...)
+		name := event
+		if eventWithName(cfg.raw, event) == nil {
+			name = defaultName
+			if eventWithName(cfg.raw, allName) != nil {
+				name = allName
+			}
+		}
+		exp.Steps = append(exp.Steps, fmt.Sprintf("Event %q in %s selects %v", name, configFilename, sortedCategories(base)))
+	case cfg != nil && !strings.EqualFold(event, defaults.DefaultEvent):
+		return nil, fmt.Errorf("No categories configured for event %s", event)
+	default:
+		base = names.canonicalSet(strset.New(DefaultCategories...))
+		exp.Steps = append(exp.Steps, fmt.Sprintf("No categories configured for event %q; using the default categories %v", event, sortedCategories(base)))
+	}
+
+	var ignore []string
+	if cfg != nil {
+		ignore = cfg.ignore
+	}
+	nested, err := loadNestedConfigs(root, event, ignore)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range nested {
+		n.cfg.canonicalize(names)
+	}
+	cats := base
+	if paths := newPathCategories(base, len(categories) > 0, cfg, nested); paths != nil {
+		cats = paths.resolve(file, func(format string, args ...interface{}) {
+			exp.Steps = append(exp.Steps, fmt.Sprintf(format, args...))
+		})
+	}
+	exp.Categories = sortedCategories(cats)
+	return exp, nil
+}
+
+// explainIgnored returns why the file is left out of the analysis, or the empty
+// string if it is not.
+func explainIgnored(root string, cfg *config, file string) (string, error) {
+	for _, part := range strings.Split(file, "/") {
+		if strings.HasPrefix(part, ".") {
+			return "Files and directories starting with \".\" are not analyzed", nil
+		}
+	}
+	if cfg == nil {
+		return "", nil
+	}
+	// The last matching pattern decides, as in filterPaths.
+	reason := ""
+	for i, entry := range cfg.ignore {
+		patterns, err := expandIgnoreEntry(root, entry)
+		if err != nil {
+			return "", err
+		}
+		for _, pattern := range patterns {
+			p, ok := compileIgnorePattern(pattern)
+			if !ok || !p.matches(file) {
+				continue
+			}
+			switch {
+			case p.negate:
+				reason = ""
+			case pattern == entry:
+				reason = fmt.Sprintf("Ignore entry %d (%q) in %s", i, entry, configFilename)
+			default:
+				reason = fmt.Sprintf("Pattern %q from ignore entry %d (%q) in %s", pattern, i, entry, configFilename)
+			}
+		}
+	}
+	return reason, nil
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeFiles creates the files, given by their path relative to root.
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for path, content := range files {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExplainConfig(t *testing.T) {
+	root, err := ioutil.TempDir("", "explain_test")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+	writeFiles(t, root, map[string]string{
+		configFilename: `
+global:
+  ignore:
+    - third_party/
+    - file=.gitignore
+events:
+  - event: review
+    categories:
+      - JSHint
+      - go vet
+paths:
+  - path: tools/
+    enable:
+      - PyLint
+`,
+		".gitignore": "*.o\n",
+		filepath.Join("web", configFilename): `
+events:
+  - event: review
+    categories:
+      - JSHint
+paths:
+  - path: legacy/
+    disable:
+      - JSHint
+`,
+	})
+
+	tests := []struct {
+		label  string
+		event  string
+		file   string
+		cats   []string
+		expect Explanation
+	}{
+		{
+			"Event categories",
+			"review",
+			"main.go",
+			nil,
+			Explanation{
+				Categories: []string{"JSHint", "go vet"},
+				Steps:      []string{`Event "review" in .shipshape selects [JSHint go vet]`},
+			},
+		},
+		{
+			"Path rule",
+			"review",
+			"tools/lint.py",
+			nil,
+			Explanation{
+				Categories: []string{"JSHint", "PyLint", "go vet"},
+				Steps: []string{
+					`Event "review" in .shipshape selects [JSHint go vet]`,
+					`path rule 0 ("tools/") in .shipshape enables [PyLint]`,
+				},
+			},
+		},
+		{
+			"Nested config",
+			"review",
+			"web/legacy/app.js",
+			nil,
+			Explanation{
+				Categories: []string{},
+				Steps: []string{
+					`Event "review" in .shipshape selects [JSHint go vet]`,
+					`web/.shipshape replaces the categories with [JSHint]`,
+					`path rule 0 ("legacy/") in web/.shipshape disables [JSHint]`,
+				},
+			},
+		},
+		{
+			"Explicit categories",
+			"review",
+			"tools/lint.py",
+			[]string{"CodeAlert"},
+			Explanation{
+				Categories: []string{"CodeAlert"},
+				Steps:      []string{`Categories requested explicitly: [CodeAlert]`},
+			},
+		},
+		{
+			"Ignored directory",
+			"review",
+			"third_party/lib.go",
+			nil,
+			Explanation{
+				IgnoredBy:  `Ignore entry 0 ("third_party/") in .shipshape`,
+				Categories: []string{"JSHint", "go vet"},
+				Steps:      []string{`Event "review" in .shipshape selects [JSHint go vet]`},
+			},
+		},
+		{
+			"Ignored by gitignore",
+			"review",
+			"lib/a.o",
+			nil,
+			Explanation{
+				IgnoredBy:  `Pattern "**/*.o" from ignore entry 1 ("file=.gitignore") in .shipshape`,
+				Categories: []string{"JSHint", "go vet"},
+				Steps:      []string{`Event "review" in .shipshape selects [JSHint go vet]`},
+			},
+		},
+		{
+			"Hidden file",
+			"review",
+			".github/a.js",
+			nil,
+			Explanation{
+				IgnoredBy:  `Files and directories starting with "." are not analyzed`,
+				Categories: []string{"JSHint", "go vet"},
+				Steps:      []string{`Event "review" in .shipshape selects [JSHint go vet]`},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		exp, err := ExplainConfig(root, test.event, test.file, test.cats)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.label, err)
+			continue
+		}
+		if exp.Categories == nil {
+			exp.Categories = []string{}
+		}
+		if !reflect.DeepEqual(*exp, test.expect) {
+			t.Errorf("%s: got %+v, want %+v", test.label, *exp, test.expect)
+		}
+	}
+
+	if _, err := ExplainConfig(root, "deploy", "main.go", nil); err == nil {
+		t.Error("Expected an error for an event without categories")
+	}
+}
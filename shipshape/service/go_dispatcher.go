@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"runtime"
 
 	"github.com/google/shipshape/shipshape/analyzers/codealert"
 	"github.com/google/shipshape/shipshape/analyzers/govet"
@@ -36,6 +37,7 @@ import (
 
 var (
 	servicePort = flag.Int("port", 10005, "Service port")
+	concurrency = flag.Int("analyzer_concurrency", runtime.NumCPU(), "Maximum number of analyzers to run at once")
 )
 
 func main() {
@@ -52,6 +54,7 @@ func main() {
 		new(govet.GoVetAnalyzer),
 	}
 	analyzerService := api.CreateAnalyzerService(analyzers, ctxpb.Stage_PRE_BUILD)
+	analyzerService.SetConcurrency(*concurrency)
 
 	s1 := server.Service{Name: "AnalyzerService"}
 	if err := s1.Register(analyzerService); err != nil {
@@ -0,0 +1,249 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const ignoreFilePrefix = "file="
+
+// ignorePattern is a compiled entry from the ignore list. Patterns are always
+// relative to the repository root.
+type ignorePattern struct {
+	// negate re-includes the paths the pattern matches.
+	negate bool
+	// dirOnly restricts the pattern to directories.
+	dirOnly bool
+	// segments holds the slash-separated parts of the pattern. A "**"
+	// segment matches any number of directories.
+	segments []string
+}
+
+// compileIgnorePattern compiles a single ignore entry. Entries use gitignore
+// syntax, except that they are always anchored at the repository root:
+// "dir/" ignores the top-level directory dir, and "**/dir/" ignores a
+// directory named dir anywhere. It returns false for an empty entry.
+func compileIgnorePattern(entry string) (ignorePattern, bool) {
+	var p ignorePattern
+	if strings.HasPrefix(entry, "!") {
+		p.negate = true
+		entry = entry[1:]
+	}
+	if strings.HasSuffix(entry, "/") {
+		p.dirOnly = true
+		entry = strings.TrimRight(entry, "/")
+	}
+	entry = strings.TrimLeft(entry, "/")
+	if entry == "" {
+		return p, false
+	}
+	p.segments = strings.Split(entry, "/")
+	return p, true
+}
+
+// validateIgnoreEntry returns an error if the entry from the ignore list
+// cannot be used.
+func validateIgnoreEntry(entry string) error {
+	if strings.HasPrefix(entry, ignoreFilePrefix) {
+		if strings.TrimPrefix(entry, ignoreFilePrefix) == "" {
+			return fmt.Errorf("%q does not name a file", entry)
+		}
+		return nil
+	}
+	_, err := validPattern(entry)
+	return err
+}
+
+// validPattern compiles the pattern, returning an error if it is empty or malformed.
+func validPattern(pattern string) (ignorePattern, error) {
+	p, ok := compileIgnorePattern(pattern)
+	if !ok {
+		return p, fmt.Errorf("%q is empty", pattern)
+	}
+	for _, seg := range p.segments {
+		if _, err := path.Match(seg, ""); err != nil {
+			return p, fmt.Errorf("%q is not a valid pattern: %v", pattern, err)
+		}
+	}
+	return p, nil
+}
+
+// matches reports whether the pattern matches the file at the given path,
+// either directly or by matching one of the directories containing it.
+func (p ignorePattern) matches(file string) bool {
+	parts := strings.Split(file, "/")
+	if !p.dirOnly && matchSegments(p.segments, parts) {
+		return true
+	}
+	for i := 1; i < len(parts); i++ {
+		if matchSegments(p.segments, parts[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches the pattern segments against the path segments.
+// Malformed segments never match.
+func matchSegments(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchSegments(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], parts[1:])
+}
+
+// ignoreRules decides which files to leave out of the analysis. The last
+// pattern matching a file wins, so a negated pattern can re-include files
+// that an earlier pattern ignored. Unlike git, this works even for files in
+// an ignored directory.
+type ignoreRules []ignorePattern
+
+func compileIgnoreRules(entries []string) ignoreRules {
+	var rules ignoreRules
+	for _, entry := range entries {
+		if p, ok := compileIgnorePattern(entry); ok {
+			rules = append(rules, p)
+		}
+	}
+	return rules
+}
+
+func (r ignoreRules) ignored(file string) bool {
+	ignored := false
+	for _, p := range r {
+		if p.matches(file) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+// ignoredDir reports whether the directory dir, and so everything in it, is ignored. Since
+// a negated pattern can re-include files in an ignored directory, no directory counts as
+// ignored if there is one.
+func (r ignoreRules) ignoredDir(dir string) bool {
+	for _, p := range r {
+		if p.negate {
+			return false
+		}
+	}
+	parts := strings.Split(dir, "/")
+	for _, p := range r {
+		for i := 1; i <= len(parts); i++ {
+			if matchSegments(p.segments, parts[:i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// expandIgnoreEntries replaces each "file=<path>" entry in the ignore list with the
+// patterns from that gitignore file, relative to the repository root. Missing files
+// are skipped.
+func expandIgnoreEntries(root string, entries []string) ([]string, error) {
+	var expanded []string
+	for _, entry := range entries {
+		patterns, err := expandIgnoreEntry(root, entry)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, patterns...)
+	}
+	return expanded, nil
+}
+
+// expandIgnoreEntry returns the patterns for a single entry of the ignore list.
+func expandIgnoreEntry(root string, entry string) ([]string, error) {
+	if !strings.HasPrefix(entry, ignoreFilePrefix) {
+		return []string{entry}, nil
+	}
+	rel := filepath.ToSlash(strings.TrimPrefix(entry, ignoreFilePrefix))
+	content, err := ioutil.ReadFile(filepath.Join(root, rel))
+	if os.IsNotExist(err) {
+		log.Printf("Ignore file %s does not exist, skipping it", rel)
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read ignore file %s: %v", rel, err)
+	}
+	return gitignorePatterns(string(content), path.Dir(rel)), nil
+}
+
+// gitignorePatterns converts the contents of a gitignore file in the directory dir
+// into ignore entries anchored at the repository root.
+func gitignorePatterns(content, dir string) []string {
+	if dir == "." {
+		dir = ""
+	}
+	var patterns []string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		negate := ""
+		if strings.HasPrefix(line, "!") {
+			negate = "!"
+			line = line[1:]
+		}
+		if strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		trailing := ""
+		if strings.HasSuffix(line, "/") {
+			trailing = "/"
+			line = strings.TrimRight(line, "/")
+		}
+		// Nothing is left of a line like "/" or "!", which must not become a pattern
+		// that matches everything.
+		if line == "" {
+			continue
+		}
+		// A pattern without a slash matches at any depth below dir.
+		if strings.Contains(line, "/") {
+			line = strings.TrimLeft(line, "/")
+		} else {
+			line = "**/" + line
+		}
+		if dir != "" {
+			line = dir + "/" + line
+		}
+		patterns = append(patterns, negate+line+trailing)
+	}
+	return patterns
+}
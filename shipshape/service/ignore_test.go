@@ -0,0 +1,145 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGitignorePatterns(t *testing.T) {
+	tests := []struct {
+		label   string
+		content string
+		dir     string
+		expect  []string
+	}{
+		{
+			"Comments and blank lines",
+			"# generated\n\n*.o  \r\n",
+			".",
+			[]string{"**/*.o"},
+		},
+		{
+			"Anchored patterns",
+			"/build/\ndocs/out\n",
+			".",
+			[]string{"build/", "docs/out"},
+		},
+		{
+			"Negation and escapes",
+			"*.log\n!keep.log\n\\#notes\n",
+			".",
+			[]string{"**/*.log", "!**/keep.log", "**/#notes"},
+		},
+		{
+			"Lines without a pattern",
+			"/\n!/\n//\n!\n*.o\n",
+			".",
+			[]string{"**/*.o"},
+		},
+		{
+			"Nested gitignore",
+			"*.tmp\n/out/\n",
+			"sub",
+			[]string{"sub/**/*.tmp", "sub/out/"},
+		},
+	}
+
+	for _, test := range tests {
+		if got := gitignorePatterns(test.content, test.dir); !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("%s: got %v, want %v", test.label, got, test.expect)
+		}
+	}
+}
+
+func TestIgnoredDir(t *testing.T) {
+	tests := []struct {
+		label   string
+		entries []string
+		dir     string
+		expect  bool
+	}{
+		{"Ignored directory", []string{"third_party/"}, "third_party", true},
+		{"Subdirectory of an ignored directory", []string{"third_party/"}, "third_party/lib/src", true},
+		{"Glob pattern", []string{"**/node_modules/"}, "web/node_modules", true},
+		{"Other directory", []string{"third_party/"}, "web", false},
+		{"File pattern", []string{"**/*.go"}, "web", false},
+		{"Negated pattern", []string{"third_party/", "!third_party/keep.go"}, "third_party", false},
+	}
+
+	for _, test := range tests {
+		if got := compileIgnoreRules(test.entries).ignoredDir(test.dir); got != test.expect {
+			t.Errorf("%s: got %v, want %v", test.label, got, test.expect)
+		}
+	}
+}
+
+func TestValidateIgnoreEntry(t *testing.T) {
+	for _, entry := range []string{"third_party/", "**/*.pb.go", "!keep.go", "file=.gitignore"} {
+		if err := validateIgnoreEntry(entry); err != nil {
+			t.Errorf("Unexpected error for %q: %v", entry, err)
+		}
+	}
+	for _, entry := range []string{"", "/", "!", "file=", "dir/[a-"} {
+		if err := validateIgnoreEntry(entry); err == nil {
+			t.Errorf("Expected an error for %q", entry)
+		}
+	}
+}
+
+func TestRetrieveAndFilterFilesGitignore(t *testing.T) {
+	root, err := ioutil.TempDir("", "ignore_test")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	files := map[string]string{
+		".gitignore":       "*.o\nout/\n",
+		"sub/.gitignore":   "/gen/\n!keep.o\n",
+		"a.go":             "",
+		"a.o":              "",
+		"out/b.go":         "",
+		"sub/gen/c.go":     "",
+		"sub/keep.o":       "",
+		"sub/d.go":         "",
+		"third_party/e.go": "",
+	}
+	for path, content := range files {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ignore := []string{"file=.gitignore", "file=sub/.gitignore", "file=missing/.gitignore", "third_party/"}
+	got, err := retrieveAndFilterFiles(root, nil, ignore)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expect := []string{"a.go", "sub/d.go", "sub/keep.o"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Incorrect files: got %v, want %v", got, expect)
+	}
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	strset "github.com/google/shipshape/shipshape/util/strings"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+	configpb "github.com/google/shipshape/shipshape/proto/shipshape_config_proto"
+)
+
+// categoryNames matches category names case-insensitively against the categories the
+// analyzers provide. It maps lowercased names to the names the analyzers use.
+type categoryNames map[string]string
+
+func newCategoryNames(available strset.Set) categoryNames {
+	// Go through the names in order, so that the choice is stable if two analyzers
+	// provide categories that only differ in case.
+	sorted := available.ToSlice()
+	sort.Strings(sorted)
+	names := make(categoryNames)
+	for _, cat := range sorted {
+		if _, ok := names[strings.ToLower(cat)]; !ok {
+			names[strings.ToLower(cat)] = cat
+		}
+	}
+	return names
+}
+
+// canonical returns the name the analyzers use for the category, or the category itself
+// if no analyzer provides it.
+func (n categoryNames) canonical(cat string) string {
+	if name, ok := n[strings.ToLower(cat)]; ok {
+		return name
+	}
+	return cat
+}
+
+// contains reports whether an analyzer provides the category, ignoring case.
+func (n categoryNames) contains(cat string) bool {
+	_, ok := n[strings.ToLower(cat)]
+	return ok
+}
+
+func (n categoryNames) canonicalSlice(cats []string) []string {
+	if cats == nil {
+		return nil
+	}
+	canonical := make([]string, len(cats))
+	for i, cat := range cats {
+		canonical[i] = n.canonical(cat)
+	}
+	return canonical
+}
+
+func (n categoryNames) canonicalSet(cats strset.Set) strset.Set {
+	canonical := strset.New()
+	for cat := range cats {
+		canonical.Add(n.canonical(cat))
+	}
+	return canonical
+}
+
+// canonicalTimeouts returns the timeouts keyed by the names the analyzers use.
+func (n categoryNames) canonicalTimeouts(timeouts map[string]time.Duration) map[string]time.Duration {
+	if timeouts == nil {
+		return nil
+	}
+	canonical := make(map[string]time.Duration)
+	for cat, timeout := range timeouts {
+		canonical[n.canonical(cat)] = timeout
+	}
+	return canonical
+}
+
+// suggest returns the category that the given, unknown one was most likely meant to be,
+// or the empty string if none is close enough.
+func (n categoryNames) suggest(cat string) string {
+	lower := strings.ToLower(cat)
+	best, bestDist := "", 0
+	for l, name := range n {
+		d := editDistance(lower, l)
+		if best == "" || d < bestDist || (d == bestDist && name < best) {
+			best, bestDist = name, d
+		}
+	}
+	if best == "" || bestDist > 2 || bestDist >= len(lower) {
+		return ""
+	}
+	return best
+}
+
+// didYouMean returns a suggestion to append to a message about an unknown category.
+func (n categoryNames) didYouMean(cat string) string {
+	if s := n.suggest(cat); s != "" {
+		return fmt.Sprintf("; did you mean %q?", s)
+	}
+	return ""
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// canonicalize rewrites the categories of the config to the names the analyzers use.
+func (c *config) canonicalize(names categoryNames) {
+	if c == nil {
+		return
+	}
+	c.categories = names.canonicalSlice(c.categories)
+	c.timeouts = names.canonicalTimeouts(c.timeouts)
+	if c.options != nil {
+		options := make(map[string][]string)
+		for cat, settings := range c.options {
+			options[names.canonical(cat)] = settings
+		}
+		c.options = options
+	}
+	if c.severities != nil {
+		severities := make(map[string]notepb.Note_Severity)
+		for cat, severity := range c.severities {
+			severities[names.canonical(cat)] = severity
+		}
+		c.severities = severities
+	}
+	// The path rules are shared with the raw config, so rewrite copies of them.
+	var paths []*configpb.PathConfig
+	if c.paths != nil {
+		paths = make([]*configpb.PathConfig, len(c.paths))
+	}
+	for i, pc := range c.paths {
+		paths[i] = &configpb.PathConfig{
+			Path:    pc.Path,
+			Enable:  names.canonicalSlice(pc.Enable),
+			Disable: names.canonicalSlice(pc.Disable),
+		}
+	}
+	c.paths = paths
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	strset "github.com/google/shipshape/shipshape/util/strings"
+)
+
+func TestCategoryNames(t *testing.T) {
+	names := newCategoryNames(strset.New("PyLint", "JSHint", "go vet", "Pylint"))
+
+	tests := []struct {
+		cat       string
+		canonical string
+		contains  bool
+		suggest   string
+	}{
+		{"PyLint", "PyLint", true, "PyLint"},
+		{"pylint", "PyLint", true, "PyLint"},
+		{"JSHINT", "JSHint", true, "JSHint"},
+		{"Go Vet", "go vet", true, "go vet"},
+		{"JSHnit", "JSHnit", false, "JSHint"},
+		{"govet", "govet", false, "go vet"},
+		{"Bogus", "Bogus", false, ""},
+		{"JS", "JS", false, ""},
+	}
+
+	for _, test := range tests {
+		if got := names.canonical(test.cat); got != test.canonical {
+			t.Errorf("canonical(%q): got %q, want %q", test.cat, got, test.canonical)
+		}
+		if got := names.contains(test.cat); got != test.contains {
+			t.Errorf("contains(%q): got %v, want %v", test.cat, got, test.contains)
+		}
+		if got := names.suggest(test.cat); got != test.suggest {
+			t.Errorf("suggest(%q): got %q, want %q", test.cat, got, test.suggest)
+		}
+	}
+}
+
+func TestCanonicalizeConfig(t *testing.T) {
+	rawCfg, err := unmarshalConfigBytes([]byte(`
+global:
+  timeouts:
+    - category: JSHINT
+      seconds: 30
+events:
+  - event: review
+    categories:
+      - pylint
+      - Other
+paths:
+  - path: tools/
+    disable:
+      - jshint
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cfg := buildConfig(rawCfg, "Review")
+	cfg.canonicalize(newCategoryNames(strset.New("PyLint", "JSHint")))
+
+	if expect := []string{"PyLint", "Other"}; !reflect.DeepEqual(cfg.categories, expect) {
+		t.Errorf("Incorrect categories: got %v, want %v", cfg.categories, expect)
+	}
+	if expect := map[string]time.Duration{"JSHint": 30 * time.Second}; !reflect.DeepEqual(cfg.timeouts, expect) {
+		t.Errorf("Incorrect timeouts: got %v, want %v", cfg.timeouts, expect)
+	}
+	if got, expect := cfg.paths[0].Disable, []string{"JSHint"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Incorrect disabled categories: got %v, want %v", got, expect)
+	}
+	// The raw config keeps the names as written.
+	if got, expect := rawCfg.Paths[0].Disable, []string{"jshint"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("Raw config was modified: got %v, want %v", got, expect)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		expect int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"pylint", "pylint", 0},
+		{"pylnt", "pylint", 1},
+		{"jshnit", "jshint", 2},
+		{"kitten", "sitting", 3},
+	}
+
+	for _, test := range tests {
+		if got := editDistance(test.a, test.b); got != test.expect {
+			t.Errorf("editDistance(%q, %q): got %d, want %d", test.a, test.b, got, test.expect)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	strset "github.com/google/shipshape/shipshape/util/strings"
+
+	configpb "github.com/google/shipshape/shipshape/proto/shipshape_config_proto"
+)
+
+// pathRule changes the categories that run on the files matching its pattern.
+type pathRule struct {
+	pattern ignorePattern
+	enable  strset.Set
+	disable strset.Set
+	// source describes where the rule comes from, for explaining the categories.
+	source string
+}
+
+// pathCategories decides which categories run on which files, based on the path rules
+// and the nested .shipshape files in a repository. A nil *pathCategories runs every
+// category on every file.
+type pathCategories struct {
+	// base holds the categories for files that no nested config overrides.
+	base strset.Set
+	// dirs holds the directories with a nested config for the event, dirCats
+	// their categories, and dirFiles their config files. Parent directories come first.
+	dirs     []string
+	dirCats  map[string]strset.Set
+	dirFiles map[string]string
+	// rules are applied in order to the categories for a file.
+	rules []pathRule
+}
+
+// newPathCategories builds the per-path categories for a run on the base categories,
+// using the path rules from the root config and the nested configs. If explicit is
+// true, the categories were requested explicitly, so the configuration can only
+// disable categories. It returns nil if nothing depends on the path.
+func newPathCategories(base strset.Set, explicit bool, root *config, nested []nestedConfig) *pathCategories {
+	pc := &pathCategories{base: base, dirCats: make(map[string]strset.Set), dirFiles: make(map[string]string)}
+	addRules := func(dir string, file string, rules []*configpb.PathConfig) {
+		for i, rule := range rules {
+			pattern, ok := compileIgnorePattern(rule.GetPath())
+			if !ok {
+				continue
+			}
+			if dir != "" {
+				pattern.segments = append(strings.Split(dir, "/"), pattern.segments...)
+			}
+			r := pathRule{
+				pattern: pattern,
+				enable:  strset.New(),
+				disable: strset.New(rule.Disable...),
+				source:  fmt.Sprintf("path rule %d (%q) in %s", i, rule.GetPath(), file),
+			}
+			if !explicit {
+				r.enable.AddSlice(rule.Enable)
+			}
+			pc.rules = append(pc.rules, r)
+		}
+	}
+	if root != nil {
+		addRules("", configFilename, root.paths)
+	}
+	for _, n := range nested {
+		if !explicit && len(n.cfg.categories) > 0 {
+			pc.dirs = append(pc.dirs, n.dir)
+			pc.dirCats[n.dir] = strset.New(n.cfg.categories...)
+			pc.dirFiles[n.dir] = n.cfg.file
+		}
+		addRules(n.dir, n.cfg.file, n.cfg.paths)
+	}
+	if len(pc.dirs) == 0 && len(pc.rules) == 0 {
+		return nil
+	}
+	return pc
+}
+
+// all returns every category that runs on some file.
+func (pc *pathCategories) all() strset.Set {
+	cats := strset.New().AddSet(pc.base)
+	for _, dirCats := range pc.dirCats {
+		cats.AddSet(dirCats)
+	}
+	for _, r := range pc.rules {
+		cats.AddSet(r.enable)
+	}
+	return cats
+}
+
+// categories returns the categories that run on the given file.
+func (pc *pathCategories) categories(file string) strset.Set {
+	return pc.resolve(file, nil)
+}
+
+// resolve returns the categories that run on the given file. If trace is not nil, it is
+// called to describe each change to the categories.
+func (pc *pathCategories) resolve(file string, trace func(format string, args ...interface{})) strset.Set {
+	if trace == nil {
+		trace = func(string, ...interface{}) {}
+	}
+	base := pc.base
+	for _, dir := range pc.dirs {
+		if strings.HasPrefix(file, dir+"/") {
+			base = pc.dirCats[dir]
+			trace("%s replaces the categories with %v", pc.dirFiles[dir], sortedCategories(base))
+		}
+	}
+	cats := strset.New().AddSet(base)
+	for _, r := range pc.rules {
+		if !r.pattern.matches(file) {
+			continue
+		}
+		if len(r.enable) > 0 {
+			trace("%s enables %v", r.source, sortedCategories(r.enable))
+		}
+		if len(r.disable) > 0 {
+			trace("%s disables %v", r.source, sortedCategories(r.disable))
+		}
+		cats.AddSet(r.enable).RemoveSet(r.disable)
+	}
+	return cats
+}
+
+// filesFor returns the files on which at least one of the given categories runs.
+func (pc *pathCategories) filesFor(cats strset.Set, files []string) []string {
+	if pc == nil {
+		return files
+	}
+	var keep []string
+	for _, file := range files {
+		if len(pc.categories(file).Intersect(cats)) > 0 {
+			keep = append(keep, file)
+		}
+	}
+	return keep
+}
+
+// allows reports whether the category runs on the given file.
+func (pc *pathCategories) allows(file, category string) bool {
+	return pc == nil || pc.categories(file).Contains(category)
+}
+
+// sortedCategories returns the categories in the set in sorted order.
+func sortedCategories(cats strset.Set) []string {
+	sorted := cats.ToSlice()
+	sort.Strings(sorted)
+	return sorted
+}
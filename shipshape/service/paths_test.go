@@ -0,0 +1,111 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	strset "github.com/google/shipshape/shipshape/util/strings"
+
+	configpb "github.com/google/shipshape/shipshape/proto/shipshape_config_proto"
+)
+
+func TestPathCategories(t *testing.T) {
+	root := &config{
+		categories: []string{"JSHint", "go vet"},
+		paths: []*configpb.PathConfig{
+			{Path: proto.String("tools/"), Enable: []string{"PyLint"}},
+			{Path: proto.String("third_party/"), Disable: []string{"JSHint", "go vet"}},
+			{Path: proto.String("**/*_test.go"), Disable: []string{"go vet"}},
+		},
+	}
+	nested := []nestedConfig{
+		{"web", &config{categories: []string{"JSHint"}}},
+		{"web/legacy", &config{paths: []*configpb.PathConfig{
+			{Path: proto.String("*.js"), Disable: []string{"JSHint"}},
+		}}},
+	}
+
+	tests := []struct {
+		label    string
+		explicit bool
+		file     string
+		expect   strset.Set
+	}{
+		{"No rules", false, "main.go", strset.New("JSHint", "go vet")},
+		{"Enabled for a directory", false, "tools/lint.py", strset.New("JSHint", "go vet", "PyLint")},
+		{"Disabled for a directory", false, "third_party/lib/a.js", strset.New()},
+		{"Disabled by a glob", false, "pkg/a_test.go", strset.New("JSHint")},
+		{"Nested config replaces the event categories", false, "web/app.js", strset.New("JSHint")},
+		{"Nested rule applies below its directory", false, "web/legacy/old.js", strset.New()},
+		{"Nested rule does not apply elsewhere", false, "legacy/old.js", strset.New("JSHint", "go vet")},
+		{"Explicit categories ignore enable", true, "tools/lint.py", strset.New("JSHint", "go vet")},
+		{"Explicit categories ignore nested events", true, "web/app.go", strset.New("JSHint", "go vet")},
+		{"Explicit categories still disable", true, "third_party/a.js", strset.New()},
+	}
+
+	for _, test := range tests {
+		pc := newPathCategories(strset.New("JSHint", "go vet"), test.explicit, root, nested)
+		if got := pc.categories(test.file); !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("%s: got %v, want %v", test.label, got, test.expect)
+		}
+	}
+}
+
+func TestPathCategoriesFiles(t *testing.T) {
+	root := &config{
+		paths: []*configpb.PathConfig{
+			{Path: proto.String("tools/"), Enable: []string{"PyLint"}},
+			{Path: proto.String("third_party/"), Disable: []string{"JSHint"}},
+		},
+	}
+	pc := newPathCategories(strset.New("JSHint"), false, root, nil)
+	if got, want := pc.all(), strset.New("JSHint", "PyLint"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Incorrect categories: got %v, want %v", got, want)
+	}
+
+	files := []string{"a.js", "tools/b.py", "third_party/c.js"}
+	tests := []struct {
+		cats   strset.Set
+		expect []string
+	}{
+		{strset.New("JSHint"), []string{"a.js", "tools/b.py"}},
+		{strset.New("PyLint"), []string{"tools/b.py"}},
+		{strset.New("go vet"), nil},
+	}
+	for _, test := range tests {
+		if got := pc.filesFor(test.cats, files); !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Incorrect files for %v: got %v, want %v", test.cats, got, test.expect)
+		}
+	}
+	if pc.allows("third_party/c.js", "JSHint") {
+		t.Error("JSHint should not run on third_party/c.js")
+	}
+
+	var none *pathCategories
+	if got := none.filesFor(strset.New("JSHint"), files); !reflect.DeepEqual(got, files) {
+		t.Errorf("Incorrect files without rules: got %v, want %v", got, files)
+	}
+	if !none.allows("third_party/c.js", "JSHint") {
+		t.Error("All categories should run without rules")
+	}
+	if pc := newPathCategories(strset.New("JSHint"), false, &config{}, nil); pc != nil {
+		t.Errorf("Expected no path categories without rules, got %v", pc)
+	}
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	strset "github.com/google/shipshape/shipshape/util/strings"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+	reporterpb "github.com/google/shipshape/shipshape/proto/shipshape_reporter_proto"
+	rpcpb "github.com/google/shipshape/shipshape/proto/shipshape_rpc_proto"
+)
+
+// reportStatus tells every reporter that the given categories are now at the given status.
+// Problems talking to a reporter are logged, but never affect the analysis itself, and the
+// reporters are given up on after reportTimeout.
+func (sd ShipshapeDriver) reportStatus(cats []string, status reporterpb.AnalyzerStatus, message string) {
+	if len(sd.ReporterLocations) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), reportTimeout)
+	defer cancel()
+	for _, reporter := range sd.ReporterLocations {
+		for _, cat := range cats {
+			req := &reporterpb.ReportAnalyzerStatusRequest{
+				Category: proto.String(cat),
+				Status:   status.Enum(),
+			}
+			if message != "" {
+				req.Message = proto.String(message)
+			}
+			var resp reporterpb.ReportAnalyzerStatusResponse
+			if err := getHTTPClient(reporter).CallContext(ctx, "/Reporter/ReportStatus", req, &resp); err != nil {
+				log.Printf("Could not report status %v for %s to %s: %v", status, cat, reporter, err)
+			}
+		}
+	}
+}
+
+// reportNotes sends the notes to every reporter, batched by category. Like reportStatus, it
+// gives up on the reporters after reportTimeout.
+func (sd ShipshapeDriver) reportNotes(notes []*notepb.Note) {
+	if len(sd.ReporterLocations) == 0 || len(notes) == 0 {
+		return
+	}
+	byCat := make(map[string][]*notepb.Note)
+	for _, note := range notes {
+		byCat[note.GetCategory()] = append(byCat[note.GetCategory()], note)
+	}
+	var cats []string
+	for cat := range byCat {
+		cats = append(cats, cat)
+	}
+	sort.Strings(cats)
+
+	ctx, cancel := context.WithTimeout(context.Background(), reportTimeout)
+	defer cancel()
+	for _, reporter := range sd.ReporterLocations {
+		for _, cat := range cats {
+			req := &reporterpb.ReportNotesRequest{Notes: byCat[cat]}
+			var resp reporterpb.ReportNotesResponse
+			if err := getHTTPClient(reporter).CallContext(ctx, "/Reporter/ReportNotes", req, &resp); err != nil {
+				log.Printf("Could not report notes for %s to %s: %v", cat, reporter, err)
+			}
+		}
+	}
+}
+
+// reportResults sends the notes from an analyzer service's response to every reporter,
+// and then marks each of the categories the service was called with as either COMPLETED or
+// FAILED. A failure without a category counts against every category in the call.
+func (sd ShipshapeDriver) reportResults(cats strset.Set, ar *rpcpb.AnalyzeResponse) {
+	if len(sd.ReporterLocations) == 0 {
+		return
+	}
+	sd.reportNotes(ar.Note)
+
+	failures := make(map[string][]string)
+	for _, failure := range ar.Failure {
+		if failure.Category == nil {
+			for cat := range cats {
+				failures[cat] = append(failures[cat], failure.GetFailureMessage())
+			}
+		} else {
+			failures[*failure.Category] = append(failures[*failure.Category], failure.GetFailureMessage())
+		}
+	}
+
+	sorted := cats.ToSlice()
+	sort.Strings(sorted)
+	for _, cat := range sorted {
+		if msgs, failed := failures[cat]; failed {
+			sd.reportStatus([]string{cat}, reporterpb.AnalyzerStatus_FAILED, strings.Join(msgs, "\n"))
+		} else {
+			sd.reportStatus([]string{cat}, reporterpb.AnalyzerStatus_COMPLETED, "")
+		}
+	}
+}
@@ -37,6 +37,7 @@ var (
 	servicePort = flag.Int("port", 10007, "Service port")
 	// TODO(supertri): add a stringList flag option
 	analyzers    = flag.String("analyzer_services", "localhost:10005,localhost:10006,localhost:10008", "Addresses of analyzer services (comma-separated)")
+	reporters    = flag.String("reporter_services", "", "Addresses of reporter services to send progress to (comma-separated)")
 	startService = flag.Bool("start_service", false, "Start a shipshape service, if false we use streams to handle requests (stdin/stdout)")
 )
 
@@ -65,14 +66,12 @@ func main() {
 		log.Printf("All analyzers deemed healthy")
 	}
 
-	defaultCategories := strset.New(
-		"CheckstyleGoogle",
-		"ErrorProne",
-		"CodeAlert",
-		"JSHint",
-		"PyLint",
-		"go vet")
-	shipshapeService := service.NewDriver(analyzerList, defaultCategories)
+	defaultCategories := strset.New(service.DefaultCategories...)
+	var reporterList []string
+	if *reporters != "" {
+		reporterList = strings.Split(*reporters, ",")
+	}
+	shipshapeService := service.NewDriver(analyzerList, defaultCategories, reporterList)
 
 	if *startService {
 		// Start shipshape service
@@ -110,11 +109,17 @@ func main() {
 			if err := shipshapeService.Run(nil, request, c); err != nil {
 				log.Printf("Failed to run on server: %v", err)
 			}
+			close(c)
 		}()
 
 		log.Print("Sent request to driver")
 
-		response := <-c
+		// The driver streams back one response per analyzer; callers on stdout
+		// expect a single response, so merge them together.
+		response := new(rpcpb.ShipshapeResponse)
+		for resp := range c {
+			response.AnalyzeResponse = append(response.AnalyzeResponse, resp.AnalyzeResponse...)
+		}
 
 		log.Printf("Shipshape response: [%s]", response)
 
@@ -0,0 +1,325 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package fixes validates the fixes suggested by notes and applies them to the contents
+// of files. A Merger combines the fixes of several notes, leaving out the ones that
+// conflict with each other.
+//
+// The ranges of replacements are either line or byte based; see FixRange in note.proto.
+// Applying a fix converts them to Edits, which are byte based.
+package fixes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+)
+
+// Validate checks that fix holds to the invariants documented in note.proto. It must
+// have replacements, each with a path and either no range, which replaces the whole
+// file, or a range whose start and end are both lines or both bytes, with the start not
+// after the end. The replacements must be grouped by file, and within a file use the
+// same kind of range, be ordered by their range and not overlap.
+func Validate(fix *notepb.Fix) error {
+	if len(fix.Replacement) == 0 {
+		return errors.New("the fix has no replacements")
+	}
+	seen := make(map[string]bool)
+	var prev *notepb.Replacement
+	for i, r := range fix.Replacement {
+		path := r.GetPath()
+		if path == "" {
+			return fmt.Errorf("replacement %d has no path", i)
+		}
+		if err := validateRange(r.Range); err != nil {
+			return fmt.Errorf("invalid replacement for %s: %v", path, err)
+		}
+		if prev != nil && prev.GetPath() == path {
+			if err := checkOrder(prev.Range, r.Range); err != nil {
+				return fmt.Errorf("the replacements for %s %v", path, err)
+			}
+		} else if seen[path] {
+			return fmt.Errorf("the replacements for %s are not grouped together", path)
+		}
+		seen[path] = true
+		prev = r
+	}
+	return nil
+}
+
+func validateRange(r *notepb.FixRange) error {
+	if r == nil {
+		return nil
+	}
+	start, end := r.GetStart(), r.GetEnd()
+	if start == nil || end == nil {
+		return errors.New("the range needs both a start and an end")
+	}
+	if (start.Line == nil) == (start.Byte == nil) || (end.Line == nil) == (end.Byte == nil) {
+		return errors.New("a position must have either a line or a byte")
+	}
+	if (start.Line == nil) != (end.Line == nil) {
+		return errors.New("the range must use either lines or bytes for both its start and end")
+	}
+	if s, e := position(start), position(end); s > e {
+		return fmt.Errorf("the start %d is after the end %d", s, e)
+	}
+	return nil
+}
+
+// checkOrder checks that the valid range b can follow the valid range a in the same
+// file. The returned error completes the sentence "the replacements for <path> ...".
+func checkOrder(a, b *notepb.FixRange) error {
+	if a == nil || b == nil {
+		return errors.New("overlap")
+	}
+	if (a.GetStart().Line == nil) != (b.GetStart().Line == nil) {
+		return errors.New("mix lines and bytes")
+	}
+	e1 := Edit{int(position(a.GetStart())), int(position(a.GetEnd())), ""}
+	e2 := Edit{int(position(b.GetStart())), int(position(b.GetEnd())), ""}
+	if e2.Start < e1.Start || e2.Start == e1.Start && e2.End < e1.End {
+		return errors.New("are not ordered by their range")
+	}
+	if e1.Overlaps(e2) {
+		return errors.New("overlap")
+	}
+	return nil
+}
+
+// position returns the line or byte of a valid position.
+func position(p *notepb.FixRange_Position) uint32 {
+	if p.Line != nil {
+		return p.GetLine()
+	}
+	return p.GetByte()
+}
+
+// An Edit replaces the bytes [Start, End) of a file with Content.
+type Edit struct {
+	Start, End int
+	Content    string
+}
+
+// Overlaps reports whether e and o change the same part of a file. Two insertions at
+// the same place overlap, since the order to insert them in is ambiguous.
+func (e Edit) Overlaps(o Edit) bool {
+	if e.Start == e.End && o.Start == o.End {
+		return e.Start == o.Start
+	}
+	return e.Start < o.End && o.Start < e.End
+}
+
+// byStart sorts edits by their start, then by their end.
+type byStart []Edit
+
+func (b byStart) Len() int      { return len(b) }
+func (b byStart) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byStart) Less(i, j int) bool {
+	if b[i].Start != b[j].Start {
+		return b[i].Start < b[j].Start
+	}
+	return b[i].End < b[j].End
+}
+
+// Edits validates fix and returns its edits to each file, in order. contents maps the
+// paths of the files that fix changes to their contents.
+func Edits(fix *notepb.Fix, contents map[string][]byte) (map[string][]Edit, error) {
+	if err := Validate(fix); err != nil {
+		return nil, err
+	}
+	edits := make(map[string][]Edit)
+	for _, r := range fix.Replacement {
+		path := r.GetPath()
+		if strings.HasSuffix(path, "/") {
+			return nil, fmt.Errorf("cannot apply a replacement to the directory %s", path)
+		}
+		content, ok := contents[path]
+		if !ok {
+			return nil, fmt.Errorf("no contents for %s", path)
+		}
+		start, end, err := byteRange(r.Range, content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid replacement for %s: %v", path, err)
+		}
+		edits[path] = append(edits[path], Edit{start, end, r.GetNewContent()})
+	}
+	return edits, nil
+}
+
+// byteRange returns the byte offsets in content that the valid range r spans. A nil
+// range spans the whole file.
+func byteRange(r *notepb.FixRange, content []byte) (int, int, error) {
+	if r == nil {
+		return 0, len(content), nil
+	}
+	start, end := r.GetStart(), r.GetEnd()
+	if start.Byte != nil {
+		if int(end.GetByte()) > len(content) {
+			return 0, 0, fmt.Errorf("byte %d is past the end of the file", end.GetByte())
+		}
+		return int(start.GetByte()), int(end.GetByte()), nil
+	}
+	s, ok := lineOffset(content, int(start.GetLine()))
+	e, ok2 := lineOffset(content, int(end.GetLine()))
+	if !ok || !ok2 {
+		return 0, 0, fmt.Errorf("line %d is past the end of the file", end.GetLine())
+	}
+	return s, e, nil
+}
+
+// lineOffset returns the offset of the start of the zero-based line in content. The
+// line after the last one starts at the end of content.
+func lineOffset(content []byte, line int) (int, bool) {
+	offset := 0
+	for i := 0; i < line; i++ {
+		j := bytes.IndexByte(content[offset:], '\n')
+		if j < 0 {
+			// The last line has no newline at its end.
+			if i == line-1 && offset < len(content) {
+				return len(content), true
+			}
+			return 0, false
+		}
+		offset += j + 1
+	}
+	return offset, true
+}
+
+// ApplyEdits returns content with the edits, which must be sorted and not overlap,
+// applied.
+func ApplyEdits(content []byte, edits []Edit) []byte {
+	var buf bytes.Buffer
+	pos := 0
+	for _, e := range edits {
+		buf.Write(content[pos:e.Start])
+		buf.WriteString(e.Content)
+		pos = e.End
+	}
+	buf.Write(content[pos:])
+	return buf.Bytes()
+}
+
+// Apply applies fix to contents, which maps the paths of the files that it changes to
+// their contents. It returns the new contents of the changed files, and leaves contents
+// as it is.
+func Apply(fix *notepb.Fix, contents map[string][]byte) (map[string][]byte, error) {
+	edits, err := Edits(fix, contents)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string][]byte)
+	for path, es := range edits {
+		result[path] = ApplyEdits(contents[path], es)
+	}
+	return result, nil
+}
+
+// ConflictError is returned by Merger.Add for a fix that overlaps a fix merged before.
+type ConflictError struct {
+	// Path is the file in which the fixes overlap.
+	Path string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("the fix conflicts with an earlier one in %s", e.Path)
+}
+
+// A Merger merges fixes into a single set of edits. A fix is merged as a whole or not at
+// all, and fixes that conflict with the ones merged before them are left out.
+type Merger struct {
+	contents map[string][]byte
+	edits    map[string][]Edit
+}
+
+// NewMerger returns a Merger for fixes to the files in contents, which maps their paths
+// to their contents. Files can be added to contents between calls to Add.
+func NewMerger(contents map[string][]byte) *Merger {
+	return &Merger{contents: contents, edits: make(map[string][]Edit)}
+}
+
+// Add merges fix. If fix is not valid, or if it overlaps a fix merged before, it is left
+// out and an error is returned, which is a *ConflictError for an overlap. Replacements
+// identical to ones that are already merged do not conflict.
+func (m *Merger) Add(fix *notepb.Fix) error {
+	edits, err := Edits(fix, m.contents)
+	if err != nil {
+		return err
+	}
+	added := make(map[string][]Edit)
+	for path, es := range edits {
+	next:
+		for _, e := range es {
+			for _, o := range m.edits[path] {
+				if e == o {
+					continue next
+				}
+				if e.Overlaps(o) {
+					return &ConflictError{path}
+				}
+			}
+			added[path] = append(added[path], e)
+		}
+	}
+	for path, es := range added {
+		m.edits[path] = append(m.edits[path], es...)
+		sort.Sort(byStart(m.edits[path]))
+	}
+	return nil
+}
+
+// Edits returns the merged edits to each file, in order.
+func (m *Merger) Edits() map[string][]Edit {
+	return m.edits
+}
+
+// Apply returns the new contents of the files changed by the merged fixes.
+func (m *Merger) Apply() map[string][]byte {
+	result := make(map[string][]byte)
+	for path, es := range m.edits {
+		result[path] = ApplyEdits(m.contents[path], es)
+	}
+	return result
+}
+
+// Fix returns the merged fixes as a single fix, with byte based replacements.
+func (m *Merger) Fix() *notepb.Fix {
+	var paths []string
+	for path := range m.edits {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	fix := &notepb.Fix{}
+	for _, path := range paths {
+		for _, e := range m.edits[path] {
+			fix.Replacement = append(fix.Replacement, &notepb.Replacement{
+				Path: proto.String(path),
+				Range: &notepb.FixRange{
+					Start: &notepb.FixRange_Position{Byte: proto.Uint32(uint32(e.Start))},
+					End:   &notepb.FixRange_Position{Byte: proto.Uint32(uint32(e.End))},
+				},
+				NewContent: proto.String(e.Content),
+			})
+		}
+	}
+	return fix
+}
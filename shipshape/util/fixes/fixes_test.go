@@ -0,0 +1,255 @@
+/*
+ * Copyright 2015 Google Inc. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fixes
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	notepb "github.com/google/shipshape/shipshape/proto/note_proto"
+)
+
+func lineSpan(start, end uint32) *notepb.FixRange {
+	return &notepb.FixRange{Start: &notepb.FixRange_Position{Line: proto.Uint32(start)}, End: &notepb.FixRange_Position{Line: proto.Uint32(end)}}
+}
+
+func byteSpan(start, end uint32) *notepb.FixRange {
+	return &notepb.FixRange{Start: &notepb.FixRange_Position{Byte: proto.Uint32(start)}, End: &notepb.FixRange_Position{Byte: proto.Uint32(end)}}
+}
+
+func replacement(path string, r *notepb.FixRange, content string) *notepb.Replacement {
+	return &notepb.Replacement{Path: proto.String(path), Range: r, NewContent: proto.String(content)}
+}
+
+func fix(replacements ...*notepb.Replacement) *notepb.Fix {
+	return &notepb.Fix{Replacement: replacements}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		desc    string
+		fix     *notepb.Fix
+		wantErr bool
+	}{
+		{"Byte range", fix(replacement("a", byteSpan(1, 2), "x")), false},
+		{"Line range", fix(replacement("a", lineSpan(1, 2), "x")), false},
+		{"Whole file", fix(replacement("a", nil, "x")), false},
+		{"Empty ranges", fix(replacement("a", byteSpan(0, 0), "x"), replacement("a", byteSpan(1, 1), "y")), false},
+		{"Insertion before a replacement", fix(replacement("a", byteSpan(1, 1), "x"), replacement("a", byteSpan(1, 2), "y")), false},
+		{"Adjacent replacements", fix(replacement("a", lineSpan(0, 1), "x"), replacement("a", lineSpan(1, 2), "y")), false},
+		{"Grouped files", fix(replacement("a", byteSpan(0, 1), ""), replacement("a", byteSpan(2, 3), ""), replacement("b", byteSpan(0, 1), "")), false},
+		{"Different kinds of ranges in different files", fix(replacement("a", byteSpan(0, 1), ""), replacement("b", lineSpan(0, 1), "")), false},
+		{"No replacements", fix(), true},
+		{"No path", fix(replacement("", byteSpan(0, 1), "x")), true},
+		{"No end", fix(&notepb.Replacement{Path: proto.String("a"), Range: &notepb.FixRange{Start: &notepb.FixRange_Position{Byte: proto.Uint32(0)}}}), true},
+		{"Empty position", fix(replacement("a", &notepb.FixRange{Start: &notepb.FixRange_Position{}, End: &notepb.FixRange_Position{Byte: proto.Uint32(1)}}, "")), true},
+		{"Line and byte in a position", fix(replacement("a", &notepb.FixRange{Start: &notepb.FixRange_Position{Line: proto.Uint32(0), Byte: proto.Uint32(0)}, End: &notepb.FixRange_Position{Byte: proto.Uint32(1)}}, "")), true},
+		{"Mixed range", fix(replacement("a", &notepb.FixRange{Start: &notepb.FixRange_Position{Line: proto.Uint32(0)}, End: &notepb.FixRange_Position{Byte: proto.Uint32(1)}}, "")), true},
+		{"Start after end", fix(replacement("a", lineSpan(2, 1), "")), true},
+		{"Not grouped", fix(replacement("a", byteSpan(0, 1), ""), replacement("b", byteSpan(0, 1), ""), replacement("a", byteSpan(2, 3), "")), true},
+		{"Not ordered", fix(replacement("a", byteSpan(2, 3), ""), replacement("a", byteSpan(0, 1), "")), true},
+		{"Overlapping", fix(replacement("a", byteSpan(0, 2), ""), replacement("a", byteSpan(1, 3), "")), true},
+		{"Insertions at the same place", fix(replacement("a", byteSpan(1, 1), "x"), replacement("a", byteSpan(1, 1), "y")), true},
+		{"Whole file and a range", fix(replacement("a", nil, "x"), replacement("a", byteSpan(1, 1), "y")), true},
+		{"Lines and bytes in a file", fix(replacement("a", lineSpan(0, 1), ""), replacement("a", byteSpan(10, 11), "")), true},
+	}
+
+	for _, test := range tests {
+		err := Validate(test.fix)
+		if test.wantErr && err == nil {
+			t.Errorf("%s: expected an error", test.desc)
+		} else if !test.wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.desc, err)
+		}
+	}
+}
+
+func TestEdits(t *testing.T) {
+	contents := map[string][]byte{
+		"a":  []byte("ab\ncd\nef"),
+		"b":  []byte("x\n"),
+		"d/": nil,
+	}
+	tests := []struct {
+		desc    string
+		fix     *notepb.Fix
+		want    map[string][]Edit
+		wantErr bool
+	}{
+		{
+			desc: "Bytes",
+			fix:  fix(replacement("a", byteSpan(1, 4), "z")),
+			want: map[string][]Edit{"a": {{1, 4, "z"}}},
+		},
+		{
+			desc: "Lines",
+			fix:  fix(replacement("a", lineSpan(0, 1), ""), replacement("a", lineSpan(2, 3), "gh")),
+			want: map[string][]Edit{"a": {{0, 3, ""}, {6, 8, "gh"}}},
+		},
+		{
+			desc: "Line after the last",
+			fix:  fix(replacement("a", lineSpan(3, 3), "\n"), replacement("b", lineSpan(1, 1), "y\n")),
+			want: map[string][]Edit{"a": {{8, 8, "\n"}}, "b": {{2, 2, "y\n"}}},
+		},
+		{
+			desc: "Whole file",
+			fix:  fix(replacement("b", nil, "y\n")),
+			want: map[string][]Edit{"b": {{0, 2, "y\n"}}},
+		},
+		{
+			desc:    "Invalid fix",
+			fix:     fix(replacement("a", byteSpan(2, 1), "")),
+			wantErr: true,
+		},
+		{
+			desc:    "Line past the end",
+			fix:     fix(replacement("b", lineSpan(0, 2), "")),
+			wantErr: true,
+		},
+		{
+			desc:    "Byte past the end",
+			fix:     fix(replacement("b", byteSpan(0, 3), "")),
+			wantErr: true,
+		},
+		{
+			desc:    "Unknown file",
+			fix:     fix(replacement("c", byteSpan(0, 0), "")),
+			wantErr: true,
+		},
+		{
+			desc:    "Directory",
+			fix:     fix(replacement("d/", nil, "")),
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := Edits(test.fix, contents)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %v", test.desc, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.desc, err)
+		} else if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got edits %v, want %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	contents := map[string][]byte{
+		"a.py": []byte("import os\nimport sys\nprint 'hi'\n"),
+		"b.js": []byte("var b = 1"),
+		"c.go": []byte("package c\n"),
+	}
+	f := fix(
+		replacement("a.py", lineSpan(0, 1), ""),
+		replacement("a.py", lineSpan(2, 3), "print('hi')\n"),
+		replacement("b.js", byteSpan(0, 3), "let"),
+		replacement("b.js", byteSpan(9, 9), ";"),
+	)
+	got, err := Apply(f, contents)
+	if err != nil {
+		t.Fatalf("Apply: unexpected error: %v", err)
+	}
+	want := map[string][]byte{
+		"a.py": []byte("import sys\nprint('hi')\n"),
+		"b.js": []byte("let b = 1;"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply: got %q, want %q", got, want)
+	}
+	if string(contents["a.py"]) != "import os\nimport sys\nprint 'hi'\n" {
+		t.Errorf("Apply changed its input to %q", contents["a.py"])
+	}
+
+	if _, err := Apply(fix(replacement("c.go", byteSpan(0, 100), "")), contents); err == nil {
+		t.Errorf("Apply: expected an error for a range past the end of the file")
+	}
+}
+
+func TestMerger(t *testing.T) {
+	contents := map[string][]byte{
+		"a.js": []byte("var a = 1\nvar b = 2\n"),
+		"b.py": []byte("import os\nimport sys\n"),
+	}
+	tests := []struct {
+		desc     string
+		fix      *notepb.Fix
+		conflict bool
+		wantErr  bool
+	}{
+		{"First fix", fix(replacement("a.js", byteSpan(9, 9), ";")), false, false},
+		{"Another file", fix(replacement("b.py", lineSpan(0, 2), "import os, sys\n")), false, false},
+		{"Identical replacement", fix(replacement("a.js", byteSpan(9, 9), ";"), replacement("a.js", byteSpan(19, 19), ";")), false, false},
+		{"Overlapping byte range", fix(replacement("a.js", byteSpan(4, 10), "c = 1\n")), true, true},
+		{"Overlapping line range", fix(replacement("a.js", lineSpan(1, 2), "")), true, true},
+		{"Conflict in one of the files", fix(replacement("a.js", byteSpan(0, 3), "let"), replacement("b.py", lineSpan(1, 2), "")), true, true},
+		{"Invalid fix", fix(replacement("a.js", byteSpan(3, 0), "")), false, true},
+		{"Adjacent replacement", fix(replacement("a.js", byteSpan(0, 3), "let")), false, false},
+	}
+
+	m := NewMerger(contents)
+	for _, test := range tests {
+		err := m.Add(test.fix)
+		if !test.wantErr {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.desc, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: expected an error", test.desc)
+			continue
+		}
+		if _, ok := err.(*ConflictError); ok != test.conflict {
+			t.Errorf("%s: got error %v, want a conflict: %v", test.desc, err, test.conflict)
+		}
+	}
+
+	wantEdits := map[string][]Edit{
+		"a.js": {{0, 3, "let"}, {9, 9, ";"}, {19, 19, ";"}},
+		"b.py": {{0, 21, "import os, sys\n"}},
+	}
+	if got := m.Edits(); !reflect.DeepEqual(got, wantEdits) {
+		t.Errorf("Edits: got %v, want %v", got, wantEdits)
+	}
+	wantContents := map[string][]byte{
+		"a.js": []byte("let a = 1;\nvar b = 2;\n"),
+		"b.py": []byte("import os, sys\n"),
+	}
+	if got := m.Apply(); !reflect.DeepEqual(got, wantContents) {
+		t.Errorf("Apply: got %q, want %q", got, wantContents)
+	}
+	wantFix := fix(
+		replacement("a.js", byteSpan(0, 3), "let"),
+		replacement("a.js", byteSpan(9, 9), ";"),
+		replacement("a.js", byteSpan(19, 19), ";"),
+		replacement("b.py", byteSpan(0, 21), "import os, sys\n"),
+	)
+	if got := m.Fix(); !proto.Equal(got, wantFix) {
+		t.Errorf("Fix: got %v, want %v", got, wantFix)
+	}
+	if got, err := Apply(m.Fix(), contents); err != nil || !reflect.DeepEqual(got, wantContents) {
+		t.Errorf("Applying the merged fix: got %q, %v, want %q", got, err, wantContents)
+	}
+}
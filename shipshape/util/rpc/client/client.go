@@ -65,6 +65,7 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -112,6 +113,13 @@ type Transport interface {
 	SendRequest(version string, serviceMethod string, params interface{}) (io.ReadCloser, error)
 }
 
+// A ContextTransport is a Transport that can abandon a request, including reading
+// its response, once the given context is done.
+type ContextTransport interface {
+	Transport
+	SendRequestContext(ctx context.Context, version string, serviceMethod string, params interface{}) (io.ReadCloser, error)
+}
+
 // A Client to a handle to a K-RPC server
 type Client struct {
 	Transport
@@ -168,11 +176,16 @@ func encodeRequest(version string, id *uint64, serviceMethod string, params inte
 
 // SendRequest implements the Transport interface over HTTP
 func (c *httpTransport) SendRequest(version string, serviceMethod string, params interface{}) (io.ReadCloser, error) {
+	return c.SendRequestContext(context.Background(), version, serviceMethod, params)
+}
+
+// SendRequestContext implements the ContextTransport interface over HTTP
+func (c *httpTransport) SendRequestContext(ctx context.Context, version string, serviceMethod string, params interface{}) (io.ReadCloser, error) {
 	req, err := encodeRequest(version, &c.id, serviceMethod, params)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := httpClient.Do(&http.Request{
+	resp, err := httpClient.Do((&http.Request{
 		Method: "POST",
 		URL:    c.url,
 		Header: map[string][]string{
@@ -181,7 +194,7 @@ func (c *httpTransport) SendRequest(version string, serviceMethod string, params
 		},
 		Body:          ioutil.NopCloser(bytes.NewBuffer(req)),
 		ContentLength: int64(len(req)),
-	})
+	}).WithContext(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("HTTP failure: %v", err)
 	}
@@ -222,7 +235,19 @@ func unmarshalResult(dec *json.Decoder, result interface{}) (*protocol.Response,
 // Call calls the given method, expecting a single result that will be
 // unmarshalled into the output parameter.
 func (c *Client) Call(serviceMethod string, params interface{}, result interface{}) error {
-	resp, err := c.SendRequest(protocol.Version2, serviceMethod, params)
+	return c.CallContext(context.Background(), serviceMethod, params, result)
+}
+
+// CallContext is like Call, but gives up on the call once ctx is done. If the
+// Client's Transport is not a ContextTransport, ctx is ignored.
+func (c *Client) CallContext(ctx context.Context, serviceMethod string, params interface{}, result interface{}) error {
+	var resp io.ReadCloser
+	var err error
+	if t, ok := c.Transport.(ContextTransport); ok {
+		resp, err = t.SendRequestContext(ctx, protocol.Version2, serviceMethod, params)
+	} else {
+		resp, err = c.SendRequest(protocol.Version2, serviceMethod, params)
+	}
 	if err != nil {
 		return err
 	}
@@ -307,7 +307,7 @@ func (e Endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	de := json.NewDecoder(r.Body)
 	en := json.NewEncoder(cw)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	if err := e.handleRequest(r.Header, de, en); err != nil {
+	if err := e.handleRequest(WithRequestContext(r.Header, r.Context()), de, en); err != nil {
 		log.Printf("HTTP RPC Error: %v", err)
 	}
 }
@@ -33,6 +33,7 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -336,3 +337,26 @@ func (m Map) Set(key, value string) { m[key] = value }
 
 // Del removes the value associated with a given key.
 func (m Map) Del(key string) { delete(m, key) }
+
+// requestContext is a Context that also carries the context.Context of the
+// request it belongs to.
+type requestContext struct {
+	Context
+	ctx context.Context
+}
+
+// WithRequestContext returns a Context with the same metadata as ctx that is
+// cancelled along with reqCtx.
+func WithRequestContext(ctx Context, reqCtx context.Context) Context {
+	return requestContext{ctx, reqCtx}
+}
+
+// RequestContext returns the context.Context of the request that ctx belongs
+// to, which is done when the caller gives up on the request. If ctx does not
+// carry one, it returns context.Background().
+func RequestContext(ctx Context) context.Context {
+	if rc, ok := ctx.(requestContext); ok {
+		return rc.ctx
+	}
+	return context.Background()
+}
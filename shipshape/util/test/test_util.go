@@ -52,19 +52,12 @@ func CreateLocation(path string) *notepb.Location {
 
 // RunAnalyzer does any preparation for running the analyzer, and runs
 // it. Errors from setup/teardown will cause the test t to stop. Errors from the
-// analysis will be returned, along with the notes
+// analysis will be returned, along with the notes. Analyzers resolve the files
+// in the context against its repo root, so no directory change is needed.
 func RunAnalyzer(ctx *ctxpb.ShipshapeContext, a Analyzer, t *testing.T) ([]*notepb.Note, error) {
-	oDir, err := os.Getwd()
-	if err != nil {
-		t.Fatalf("Could not get the current directory: %v", err)
-	}
-
-	if err := os.Chdir(*ctx.RepoRoot); err != nil {
-		t.Fatalf("Could not change into test directory %s: %v", ctx.GetRepoRoot(), err)
+	if _, err := os.Stat(ctx.GetRepoRoot()); err != nil {
+		t.Fatalf("Could not access test directory %s: %v", ctx.GetRepoRoot(), err)
 	}
-
-	defer os.Chdir(oDir)
-
 	return a.Analyze(ctx)
 }
 